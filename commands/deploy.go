@@ -1,13 +1,16 @@
 package commands
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
 	"time"
 
-	"github.com/aws/aws-sdk-go/service/cloudformation"
+	forge "github.com/nathandines/forge/v2/forgelib"
+
 	"github.com/spf13/cobra"
 )
 
@@ -16,127 +19,260 @@ var templateFile string
 var parameterFiles []string
 var parameterOverrides []string
 var stackPolicyFile string
+var stackPolicyDuringUpdateFile string
+var stackSettingsFile string
+var notificationARNs []string
+var resultFile string
+
+// deployResult is written to the result file for each stack which was deployed
+type deployResult struct {
+	forge.DeployOut
+	DurationSeconds float64
+	Error           string `json:",omitempty"`
+	Region          string `json:",omitempty"`
+}
 
 var deployCmd = &cobra.Command{
 	Use:   "deploy",
 	Short: "Deploy a CloudFormation Stack",
 	Run: func(cmd *cobra.Command, args []string) {
-		// Read template-file
-		if templateFile == "" {
-			if err := cmd.Usage(); err != nil {
+		readStackFiles(cmd)
+
+		// Read stack-policy-file
+		if stackPolicyFile != "" {
+			stackPolicyBody, err := ioutil.ReadFile(stackPolicyFile)
+			if err != nil {
 				log.Fatal(err)
 			}
-			fmt.Printf("\nArgument 'template-file' is required\n")
-			os.Exit(1)
-		}
-		templateBody, err := ioutil.ReadFile(templateFile)
-		if err != nil {
-			log.Fatal(err)
+			stack.StackPolicyBody = string(stackPolicyBody)
 		}
-		stack.TemplateBody = string(templateBody)
 
-		// Read tags-file
-		if tagsFile != "" {
-			tagsBody, err := ioutil.ReadFile(tagsFile)
+		// Read stack-policy-during-update-file
+		if stackPolicyDuringUpdateFile != "" {
+			stackPolicyDuringUpdateBody, err := ioutil.ReadFile(stackPolicyDuringUpdateFile)
 			if err != nil {
 				log.Fatal(err)
 			}
-			stack.TagsBody = string(tagsBody)
+			stack.StackPolicyDuringUpdateBody = string(stackPolicyDuringUpdateBody)
 		}
 
-		// Read parameters-file
-		for _, p := range parameterFiles {
-			parametersBody, err := ioutil.ReadFile(p)
+		// Read stack-settings-file, with explicitly set flags taking precedence
+		if stackSettingsFile != "" {
+			stackSettingsBody, err := ioutil.ReadFile(stackSettingsFile)
 			if err != nil {
 				log.Fatal(err)
 			}
-			stack.ParameterBodies = append(stack.ParameterBodies, string(parametersBody))
-		}
-
-		// Parse parameter overrides
-		stack.ParameterOverrides, err = parseParameterOverrideArgs(parameterOverrides)
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		// Read stack-policy-file
-		if stackPolicyFile != "" {
-			stackPolicyBody, err := ioutil.ReadFile(stackPolicyFile)
+			stack.Settings, err = forge.ParseStackSettings(string(stackSettingsBody))
 			if err != nil {
 				log.Fatal(err)
 			}
-			stack.StackPolicyBody = string(stackPolicyBody)
+			if err := configureFromFile(cmd, stack.Settings.Profile, stack.Settings.Region); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if cmd.Flags().Changed("termination-protection") {
+			stack.Settings.TerminationProtection = &stack.TerminationProtection
+		}
+		if cmd.Flags().Changed("notification-arns") {
+			stack.Settings.NotificationARNs = &notificationARNs
 		}
 
-		if assumeRoleArn != "" {
+		if len(assumeRoleArns) > 0 {
 			if err := assumeRole(); err != nil {
 				log.Fatal(err)
 			}
 		}
 
-		// Populate Stack ID
-		// Deliberately ignore errors here, as the stack might not exist yet
-		stack.GetStackInfo()
-
-		after, err := stack.GetLastEventTime()
-		if err != nil {
-			// default to epoch as the time to look for events from
-			epoch := time.Unix(0, 0)
-			after = &epoch
+		stacks := []*forge.Stack{&stack}
+		if len(regions) > 0 {
+			stacks = stacksInRegions(stack, regions)
 		}
 
-		output, err := stack.Deploy()
-		if err != nil {
-			log.Fatal(err)
-		}
+		var reductions []string
+		for _, s := range stacks {
+			// Populate Stack ID
+			// Deliberately ignore errors here, as the stack might not exist yet
+			s.GetStackInfo()
 
-		if t := "No updates are to be performed."; output.Message == t {
-			fmt.Println(t)
-			return
+			stackReductions, err := s.ProtectionReductionsWithContext(commandContext)
+			if err != nil {
+				log.Fatal(err)
+			}
+			for _, r := range stackReductions {
+				if s.Region != "" {
+					r = fmt.Sprintf("[%s] %s", s.Region, r)
+				}
+				reductions = append(reductions, r)
+			}
 		}
-
-		for {
-		refresh_stack_status:
-			if err := stack.GetStackInfo(); err != nil {
-				if assumeRoleArn == "" {
+		if len(reductions) > 0 {
+			for _, r := range reductions {
+				fmt.Println(r)
+			}
+			if !assumeYes {
+				confirmed, err := confirmByTypingName(
+					os.Stdin,
+					os.Stdout,
+					fmt.Sprintf("\nThe protection of stack %s will be reduced as described above.", stack.StackName),
+					stack.StackName,
+				)
+				if err != nil {
 					log.Fatal(err)
 				}
-				if err2 := rotateRoleCredentials(err); err2 != nil {
-					log.Fatal(err)
+				if !confirmed {
+					fmt.Println("Stack name did not match. Aborting.")
+					os.Exit(1)
 				}
-				goto refresh_stack_status
 			}
+			for _, s := range stacks {
+				s.AllowProtectionReduction = true
+			}
+		}
 
-			printStackEvents(&stack, after)
-
-			status := *stack.StackInfo.StackStatus
-			switch {
-			case stackInProgressRegexp.MatchString(status):
-			case status == cloudformation.StackStatusCreateComplete:
-				return
-			case status == cloudformation.StackStatusUpdateComplete:
-				return
-			default:
-				fmt.Print("\n")
-				log.Fatal(fmt.Errorf("Stack deploy failed! Stack Status: %s", status))
+		// Results are kept in the same order as the stacks, to be written to
+		// the result file
+		results := make([]deployResult, len(stacks))
+		deployAndRecord := func(s *forge.Stack, out io.Writer) error {
+			output, err := deployStack(s, out)
+			for i := range stacks {
+				if stacks[i] == s {
+					results[i] = newDeployResult(s, output, err)
+				}
 			}
+			return err
+		}
 
-			time.Sleep(time.Duration(eventPollingPeriod) * time.Second)
+		if len(regions) > 0 {
+			succeeded := runInRegions(stacks, deployAndRecord)
+			if err := writeDeployResults(resultFile, results, true); err != nil {
+				log.Fatal(err)
+			}
+			if !succeeded {
+				os.Exit(1)
+			}
+			return
+		}
+		deployErr := deployAndRecord(&stack, os.Stdout)
+		if err := writeDeployResults(resultFile, results, false); err != nil {
+			log.Fatal(err)
+		}
+		if deployErr != nil {
+			fmt.Print("\n")
+			log.Fatal(deployErr)
 		}
 	},
 }
 
-func init() {
-	deployCmd.PersistentFlags().StringVarP(
+func newDeployResult(s *forge.Stack, output forge.DeployOut, err error) deployResult {
+	result := deployResult{
+		DeployOut:       output,
+		DurationSeconds: output.Duration.Seconds(),
+		Region:          s.Region,
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// writeDeployResults writes the results of the deployment to the result file
+// as JSON, if one was given. The results of a deployment to several regions are
+// written as a list
+func writeDeployResults(path string, results []deployResult, list bool) error {
+	if path == "" {
+		return nil
+	}
+	var content interface{} = results
+	if !list {
+		content = results[0]
+	}
+	jsonData, err := json.MarshalIndent(content, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(jsonData, '\n'), 0644)
+}
+
+// deployStack deploys the stack, and follows its events until the deployment
+// has finished. The output describes as much of the deployment as was done,
+// even when an error is returned
+func deployStack(s *forge.Stack, out io.Writer) (forge.DeployOut, error) {
+	after, err := s.GetLastEventTimeWithContext(commandContext)
+	if err != nil {
+		// default to epoch as the time to look for events from
+		epoch := time.Unix(0, 0)
+		after = &epoch
+	}
+
+	output, err := s.DeployWithContext(commandContext)
+	if err != nil {
+		return output, err
+	}
+
+	if output.Operation == forge.DeployNoOp {
+		fmt.Fprintln(out, output.Message)
+		return output, nil
+	}
+
+	result, err := waitForStack(s, out, after, forge.OperationDeploy)
+	output.AddWaitResult(s, result)
+	return output, err
+}
+
+// readStackFiles reads the template, tags and parameters for the stack from
+// the files given in the flags added by addStackFileFlags
+func readStackFiles(cmd *cobra.Command) {
+	// Read template-file
+	if templateFile == "" {
+		if err := cmd.Usage(); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("\nArgument 'template-file' is required\n")
+		os.Exit(1)
+	}
+	templateBody, err := ioutil.ReadFile(templateFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	stack.TemplateBody = string(templateBody)
+
+	// Read tags-file
+	if tagsFile != "" {
+		tagsBody, err := ioutil.ReadFile(tagsFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		stack.TagsBody = string(tagsBody)
+	}
+
+	// Read parameters-file
+	for _, p := range parameterFiles {
+		parametersBody, err := ioutil.ReadFile(p)
+		if err != nil {
+			log.Fatal(err)
+		}
+		stack.ParameterBodies = append(stack.ParameterBodies, string(parametersBody))
+		stack.ParameterSources = append(stack.ParameterSources, p)
+	}
+
+	// Parse parameter overrides
+	stack.ParameterOverrides, err = parseParameterOverrideArgs(parameterOverrides)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func addStackFileFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVarP(
 		&templateFile,
 		"template-file",
 		"t",
 		"",
 		"Path to the CloudFormation template to be deployed",
 	)
-	deployCmd.MarkFlagFilename("template-file")
+	cmd.MarkFlagFilename("template-file")
 
-	deployCmd.PersistentFlags().StringSliceVarP(
+	cmd.PersistentFlags().StringSliceVarP(
 		&parameterFiles,
 		"parameters-file",
 		"p",
@@ -144,9 +280,9 @@ func init() {
 		"Path to the file which contains the parameters for this stack. Can be defined multiple\n"+
 			"times to merge files, later ones overriding earlier ones.",
 	)
-	deployCmd.MarkFlagFilename("parameters-file")
+	cmd.MarkFlagFilename("parameters-file")
 
-	deployCmd.PersistentFlags().StringSliceVarP(
+	cmd.PersistentFlags().StringSliceVarP(
 		&parameterOverrides,
 		"parameter-override",
 		"o",
@@ -155,13 +291,39 @@ func init() {
 			"multiple overrides.",
 	)
 
-	deployCmd.PersistentFlags().StringVar(
+	cmd.PersistentFlags().BoolVar(
+		&stack.StrictParameters,
+		"strict-parameters",
+		false,
+		"Fail if the parameters files or overrides have keys which aren't parameters of the\n"+
+			"template, or if a template parameter without a default has no value",
+	)
+
+	cmd.PersistentFlags().StringVar(
 		&tagsFile,
 		"tags-file",
 		"",
 		"Path to the file which contains the tags for this stack",
 	)
-	deployCmd.MarkFlagFilename("tags-file")
+	cmd.MarkFlagFilename("tags-file")
+}
+
+// addUsePreviousParametersFlag adds the flag for keeping the previous values
+// of parameters which aren't given, for commands which update a stack
+func addUsePreviousParametersFlag(cmd *cobra.Command) {
+	cmd.PersistentFlags().BoolVar(
+		&stack.UsePreviousParameters,
+		"use-previous-parameters",
+		false,
+		"Keep the current values of stack parameters which aren't given in the parameters files\n"+
+			"or overrides, rather than falling back to the template defaults",
+	)
+}
+
+func init() {
+	addStackFileFlags(deployCmd)
+	addUsePreviousParametersFlag(deployCmd)
+	addRegionsFlag(deployCmd, "deploy")
 
 	deployCmd.PersistentFlags().StringVar(
 		&stackPolicyFile,
@@ -171,11 +333,48 @@ func init() {
 	)
 	deployCmd.MarkFlagFilename("stack-policy-file")
 
+	deployCmd.PersistentFlags().StringVar(
+		&stackPolicyDuringUpdateFile,
+		"stack-policy-during-update-file",
+		"",
+		"Path to the file which contains a stack policy to use for this update only, overriding\n"+
+			"the permanent stack policy without changing it",
+	)
+	deployCmd.MarkFlagFilename("stack-policy-during-update-file")
+
+	deployCmd.PersistentFlags().StringVar(
+		&stackSettingsFile,
+		"stack-settings-file",
+		"",
+		"Path to the file which declares the stack-level settings (TerminationProtection,\n"+
+			"StackPolicy, NotificationARNs and CfnRoleName) that this stack is reconciled to, and\n"+
+			"the Profile and Region to manage it with",
+	)
+	deployCmd.MarkFlagFilename("stack-settings-file")
+
+	deployCmd.PersistentFlags().StringSliceVar(
+		&notificationARNs,
+		"notification-arns",
+		[]string{},
+		"SNS topic ARNs to send stack events to. Can be defined multiple times, or set to an\n"+
+			"empty value to remove all notification ARNs",
+	)
+
+	deployCmd.PersistentFlags().StringVar(
+		&resultFile,
+		"result-file",
+		"",
+		"Path to write the result of the deployment to as JSON (the operation, stack ID,\n"+
+			"parameters, tags, final status, duration and outputs), for use by later pipeline steps",
+	)
+	deployCmd.MarkFlagFilename("result-file")
+
 	deployCmd.PersistentFlags().BoolVar(
 		&stack.TerminationProtection,
 		"termination-protection",
 		false,
-		"Set termination protection for this stack",
+		"Set termination protection for this stack. Use \"--termination-protection=false\" to\n"+
+			"disable it on an existing stack",
 	)
 	deployCmd.MarkFlagFilename("stack-policy-file")
 
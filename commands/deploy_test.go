@@ -0,0 +1,108 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	forge "github.com/nathandines/forge/v2/forgelib"
+)
+
+func TestWriteDeployResults(t *testing.T) {
+	cases := []struct {
+		path         string
+		results      []deployResult
+		list         bool
+		expectOutput string
+	}{
+		{
+			path: "result.json",
+			results: []deployResult{
+				newDeployResult(
+					&forge.Stack{},
+					forge.DeployOut{Operation: forge.DeployUpdate, Duration: 90 * time.Second, StackID: "test-stack/id0"},
+					nil,
+				),
+			},
+			expectOutput: `{"Operation":"update","DurationSeconds":90,"StackID":"test-stack/id0"}`,
+		},
+		{
+			path: "result.json",
+			results: []deployResult{
+				newDeployResult(&forge.Stack{Region: "us-east-1"}, forge.DeployOut{Operation: forge.DeployNoOp}, nil),
+				newDeployResult(&forge.Stack{Region: "eu-west-1"}, forge.DeployOut{Operation: forge.DeployCreate}, fmt.Errorf("Stack deploy failed!")),
+			},
+			list:         true,
+			expectOutput: `[{"Operation":"no-op","Region":"us-east-1"},{"Operation":"create","Error":"Stack deploy failed!","Region":"eu-west-1"}]`,
+		},
+		// Nothing is written without a result file
+		{
+			path:    "",
+			results: []deployResult{{}},
+		},
+	}
+
+	for i, c := range cases {
+		path := c.path
+		if path != "" {
+			path = filepath.Join(t.TempDir(), path)
+		}
+		if err := writeDeployResults(path, c.results, c.list); err != nil {
+			t.Fatalf("%d, unexpected error, %v", i, err)
+		}
+		if path == "" {
+			continue
+		}
+		written, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf("%d, unexpected error, %v", i, err)
+		}
+
+		// Compare only the fields which were expected, as empty fields are
+		// still written
+		var got, expected interface{}
+		if err := json.Unmarshal(written, &got); err != nil {
+			t.Fatalf("%d, unexpected error, %v", i, err)
+		}
+		if err := json.Unmarshal([]byte(c.expectOutput), &expected); err != nil {
+			t.Fatalf("%d, unexpected error, %v", i, err)
+		}
+		if !containsJSON(got, expected) {
+			t.Errorf("%d, expected %s to contain %s", i, written, c.expectOutput)
+		}
+	}
+}
+
+// containsJSON reports whether every field in expected has the same value in
+// got
+func containsJSON(got, expected interface{}) bool {
+	switch e := expected.(type) {
+	case map[string]interface{}:
+		g, ok := got.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for k, v := range e {
+			if !containsJSON(g[k], v) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		g, ok := got.([]interface{})
+		if !ok || len(g) != len(e) {
+			return false
+		}
+		for i := range e {
+			if !containsJSON(g[i], e[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return got == expected
+	}
+}
@@ -2,66 +2,150 @@ package commands
 
 import (
 	"fmt"
+	"io"
 	"log"
-	"time"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	forge "github.com/nathandines/forge/v2/forgelib"
 
-	"github.com/aws/aws-sdk-go/service/cloudformation"
 	"github.com/spf13/cobra"
 )
 
+var emptyBuckets bool
+
 var destroyCmd = &cobra.Command{
 	Use:   "destroy",
 	Short: "Destroy a CloudFormation Stack",
 	Run: func(cmd *cobra.Command, args []string) {
-		if assumeRoleArn != "" {
+		if len(assumeRoleArns) > 0 {
 			if err := assumeRole(); err != nil {
 				log.Fatal(err)
 			}
 		}
 
-		// Populate Stack ID
-		if err := stack.GetStackInfo(); err != nil {
-			log.Fatal(err)
+		stacks := []*forge.Stack{&stack}
+		if len(regions) > 0 {
+			stacks = stacksInRegions(stack, regions)
 		}
 
-		after, err := stack.GetLastEventTime()
-		if err != nil {
-			log.Fatal(err)
-		}
+		for _, s := range stacks {
+			if s.Region != "" {
+				fmt.Printf("Region: %s\n\n", s.Region)
+			}
 
-		if err := stack.Destroy(); err != nil {
-			log.Fatal(err)
-		}
+			// Populate Stack ID
+			if err := s.GetStackInfo(); err != nil {
+				log.Fatal(err)
+			}
 
-		for {
-		refresh_stack_status:
-			if err := stack.GetStackInfo(); err != nil {
-				if assumeRoleArn == "" {
-					log.Fatal(err)
-				}
-				if err2 := rotateRoleCredentials(err); err2 != nil {
-					log.Fatal(err)
+			// Refuse to destroy a stack whose exports are still in use, as
+			// CloudFormation will only fail part way through the deletion
+			imports, err := s.ListExportImports()
+			if err != nil {
+				log.Fatal(err)
+			}
+			if len(imports) > 0 {
+				for _, i := range imports {
+					fmt.Printf("Export \"%s\" is imported by: %s\n", i.ExportName, strings.Join(i.ImportingStacks, ", "))
 				}
-				goto refresh_stack_status
+				log.Fatal(fmt.Errorf("Stack %s has exports which are still imported by other stacks", s.StackName))
 			}
 
-			printStackEvents(&stack, after)
-
-			status := *stack.StackInfo.StackStatus
-			switch {
-			case stackInProgressRegexp.MatchString(status):
-			case status == cloudformation.StackStatusDeleteComplete:
-				return
-			default:
+			resources, err := s.ListResources()
+			if err != nil {
+				log.Fatal(err)
+			}
+			printDestroyPreview(resources)
+			if s.Region != "" {
 				fmt.Print("\n")
-				log.Fatal(fmt.Errorf("Stack destroy failed! Stack Status: %s", status))
 			}
+		}
 
-			time.Sleep(time.Duration(eventPollingPeriod) * time.Second)
+		if !assumeYes {
+			confirmed, err := confirmByTypingName(
+				os.Stdin,
+				os.Stdout,
+				fmt.Sprintf("\nStack %s and the resources above will be destroyed.", stack.StackName),
+				stack.StackName,
+			)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if !confirmed {
+				fmt.Println("Stack name did not match. Aborting.")
+				os.Exit(1)
+			}
+		}
+
+		if len(regions) > 0 {
+			if !runInRegions(stacks, destroyStack) {
+				os.Exit(1)
+			}
+			return
+		}
+		if err := destroyStack(&stack, os.Stdout); err != nil {
+			fmt.Print("\n")
+			log.Fatal(err)
 		}
 	},
 }
 
+// destroyStack empties the buckets of the stack if requested, then destroys
+// the stack and follows its events until it has been deleted
+func destroyStack(s *forge.Stack, out io.Writer) error {
+	if emptyBuckets {
+		emptied, err := s.EmptyBuckets()
+		if err != nil {
+			return err
+		}
+		for _, b := range emptied {
+			fmt.Fprintf(out, "Emptied bucket %s\n", b)
+		}
+	}
+
+	after, err := s.GetLastEventTimeWithContext(commandContext)
+	if err != nil {
+		return err
+	}
+
+	if err := s.DestroyWithContext(commandContext); err != nil {
+		return err
+	}
+
+	_, err = waitForStack(s, out, after, forge.OperationDelete)
+	return err
+}
+
+func printDestroyPreview(resources []forge.StackResource) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "LogicalResourceId\tResourceType\tPhysicalResourceId\tDeletionPolicy")
+	var retained bool
+	for _, r := range resources {
+		deletionPolicy := r.DeletionPolicy
+		if r.Retained() {
+			deletionPolicy += " *"
+			retained = true
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.LogicalResourceID, r.ResourceType, r.PhysicalResourceID, deletionPolicy)
+	}
+	w.Flush()
+	if retained {
+		fmt.Println("\n* Resource (or a snapshot of it) will be kept after the stack is destroyed")
+	}
+}
+
 func init() {
+	destroyCmd.PersistentFlags().BoolVar(
+		&emptyBuckets,
+		"empty-buckets",
+		false,
+		"Delete all objects (including old versions) from the stack's S3 buckets before destroying\n"+
+			"the stack. Buckets with a Retain deletion policy are left untouched",
+	)
+
+	addRegionsFlag(destroyCmd, "destroy")
+
 	rootCmd.AddCommand(destroyCmd)
 }
@@ -0,0 +1,128 @@
+package commands
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	forge "github.com/nathandines/forge/v2/forgelib"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/spf13/cobra"
+)
+
+var resourcesToImportFile string
+
+var importCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Import existing resources into a CloudFormation Stack",
+	Run: func(cmd *cobra.Command, args []string) {
+		readStackFiles(cmd)
+
+		// Read resources-to-import-file
+		if resourcesToImportFile == "" {
+			if err := cmd.Usage(); err != nil {
+				log.Fatal(err)
+			}
+			fmt.Printf("\nArgument 'resources-to-import-file' is required\n")
+			os.Exit(1)
+		}
+		resourcesToImportBody, err := ioutil.ReadFile(resourcesToImportFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		stack.ResourcesToImportBody = string(resourcesToImportBody)
+
+		if len(assumeRoleArns) > 0 {
+			if err := assumeRole(); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		// Populate Stack ID
+		// Deliberately ignore errors here, as the stack might not exist yet
+		stack.GetStackInfo()
+
+		after, err := stack.GetLastEventTime()
+		if err != nil {
+			// default to epoch as the time to look for events from
+			epoch := time.Unix(0, 0)
+			after = &epoch
+		}
+
+		output, err := stack.CreateImportChangeSetWithContext(commandContext)
+		if err != nil {
+			if output.ChangeSetID != "" {
+				if err := stack.DiscardImportChangeSetWithContext(commandContext, output); err != nil {
+					log.Print(err)
+				}
+			}
+			log.Fatal(err)
+		}
+		printChanges(output.Changes)
+
+		if !assumeYes {
+			confirmed, err := confirmByTypingName(
+				os.Stdin,
+				os.Stdout,
+				fmt.Sprintf("\nThe resources above will be imported into stack %s.", stack.StackName),
+				stack.StackName,
+			)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if !confirmed {
+				if err := stack.DiscardImportChangeSetWithContext(commandContext, output); err != nil {
+					log.Fatal(err)
+				}
+				fmt.Println("Stack name did not match. Aborting.")
+				os.Exit(1)
+			}
+		}
+
+		if err := stack.ExecuteChangeSetWithContext(commandContext, output.ChangeSetID); err != nil {
+			log.Fatal(err)
+		}
+
+		if _, err := waitForStack(&stack, os.Stdout, after, forge.OperationImport); err != nil {
+			fmt.Print("\n")
+			log.Fatal(err)
+		}
+	},
+}
+
+func printChanges(changes []*cloudformation.Change) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Action\tLogicalResourceId\tResourceType\tPhysicalResourceId")
+	for _, c := range changes {
+		if r := c.ResourceChange; r != nil {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n",
+				aws.StringValue(r.Action),
+				aws.StringValue(r.LogicalResourceId),
+				aws.StringValue(r.ResourceType),
+				aws.StringValue(r.PhysicalResourceId),
+			)
+		}
+	}
+	w.Flush()
+}
+
+func init() {
+	addStackFileFlags(importCmd)
+	addUsePreviousParametersFlag(importCmd)
+
+	importCmd.PersistentFlags().StringVar(
+		&resourcesToImportFile,
+		"resources-to-import-file",
+		"",
+		"Path to the file which maps the logical IDs of the resources to import to their resource\n"+
+			"identifiers (e.g. \"Bucket: {BucketName: my-bucket}\")",
+	)
+	importCmd.MarkFlagFilename("resources-to-import-file")
+
+	rootCmd.AddCommand(importCmd)
+}
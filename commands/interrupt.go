@@ -0,0 +1,149 @@
+package commands
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+
+	forge "github.com/nathandines/forge/v2/forgelib"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+)
+
+// commandContext is cancelled when the operator chooses to detach from the
+// stack operations which are being followed
+var commandContext, detach = context.WithCancel(context.Background())
+
+// Stacks with an operation in progress which is being followed, and which an
+// interrupt applies to
+var activeStacks = map[*forge.Stack]bool{}
+var activeStacksMutex sync.Mutex
+
+const (
+	interruptCancel = "cancel"
+	interruptDetach = "detach"
+	interruptWait   = "wait"
+)
+
+// followStack marks the stack as having an operation in progress, until the
+// returned function is called
+func followStack(s *forge.Stack) func() {
+	activeStacksMutex.Lock()
+	defer activeStacksMutex.Unlock()
+	activeStacks[s] = true
+	return func() {
+		activeStacksMutex.Lock()
+		defer activeStacksMutex.Unlock()
+		delete(activeStacks, s)
+	}
+}
+
+func followedStacks() (stacks []*forge.Stack) {
+	activeStacksMutex.Lock()
+	defer activeStacksMutex.Unlock()
+	for s := range activeStacks {
+		stacks = append(stacks, s)
+	}
+	return stacks
+}
+
+// updatingStacks returns the stacks which have an update in progress, as only
+// updates can be cancelled
+func updatingStacks(stacks []*forge.Stack) (updating []*forge.Stack) {
+	for _, s := range stacks {
+		// Described with a copy, as the stack is in use by the operation which
+		// is being followed
+		current := forge.Stack{Client: s.Client, Region: s.Region, StackID: s.StackID, StackName: s.StackName}
+		if err := current.GetStackInfoWithContext(commandContext); err != nil {
+			continue
+		}
+		if aws.StringValue(current.StackInfo.StackStatus) == cloudformation.StackStatusUpdateInProgress {
+			updating = append(updating, s)
+		}
+	}
+	return updating
+}
+
+// handleInterrupts takes over Ctrl-C. While a stack operation is being
+// followed, the first Ctrl-C asks whether to detach from it, leaving it
+// running, or keep waiting for it, and for stack updates whether to cancel the
+// update. A second Ctrl-C exits straight away
+func handleInterrupts() {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt)
+	go func() {
+		<-signals
+		stacks := followedStacks()
+		if len(stacks) == 0 {
+			fmt.Fprintln(os.Stderr, "\nInterrupted")
+			os.Exit(130)
+		}
+		go func() {
+			<-signals
+			fmt.Fprintln(os.Stderr, "\nInterrupted again, exiting without waiting for the stack operation")
+			os.Exit(130)
+		}()
+
+		updating := updatingStacks(stacks)
+		choice, err := promptInterruptChoice(os.Stdin, os.Stderr, len(updating) > 0)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		switch choice {
+		case interruptDetach:
+			detach()
+			return
+		case interruptWait:
+			return
+		}
+		for _, s := range updating {
+			if err := s.CancelUpdateWithContext(commandContext); err != nil {
+				fmt.Fprintf(os.Stderr, "Unable to cancel the update of stack %s: %s\n", s.StackName, err)
+				continue
+			}
+			fmt.Fprintf(os.Stderr, "Cancelling the update of stack %s, following its rollback\n", s.StackName)
+		}
+	}()
+}
+
+// promptInterruptChoice asks the operator whether to detach from the stack
+// operation or wait for it, and whether to cancel it when canCancel is set.
+// Anything which can't be read detaches, so that the stack is never changed
+// without an answer
+func promptInterruptChoice(in io.Reader, out io.Writer, canCancel bool) (string, error) {
+	reader := bufio.NewReader(in)
+	for {
+		if canCancel {
+			fmt.Fprint(out, "\nInterrupted. Cancel the stack update and roll it back, detach and leave the\n"+
+				"operation running, or wait for it? Press Ctrl-C again to exit straight away.\n"+
+				"[cancel/detach/wait]: ")
+		} else {
+			fmt.Fprint(out, "\nInterrupted. Only stack updates can be cancelled. Detach and leave the\n"+
+				"operation running, or wait for it? Press Ctrl-C again to exit straight away.\n"+
+				"[detach/wait]: ")
+		}
+		line, err := reader.ReadString('\n')
+		switch strings.ToLower(strings.TrimSpace(line)) {
+		case "c", interruptCancel:
+			if canCancel {
+				return interruptCancel, nil
+			}
+		case "d", interruptDetach:
+			return interruptDetach, nil
+		case "w", interruptWait:
+			return interruptWait, nil
+		}
+		if err != nil {
+			if err == io.EOF {
+				return interruptDetach, nil
+			}
+			return interruptDetach, err
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package commands
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestPromptInterruptChoice(t *testing.T) {
+	cases := []struct {
+		input     string
+		canCancel bool
+		expected  string
+	}{
+		{input: "cancel\n", canCancel: true, expected: interruptCancel},
+		{input: "  C \r\n", canCancel: true, expected: interruptCancel},
+		{input: "detach\n", canCancel: true, expected: interruptDetach},
+		{input: "d\n", canCancel: true, expected: interruptDetach},
+		{input: "wait\n", canCancel: true, expected: interruptWait},
+		{input: "maybe\ncancel\n", canCancel: true, expected: interruptCancel},
+		{input: "cancel", canCancel: true, expected: interruptCancel},
+		{input: "", canCancel: true, expected: interruptDetach},
+		{input: "maybe\n", canCancel: true, expected: interruptDetach},
+		// Only updates can be cancelled, so cancel is asked again
+		{input: "cancel\nw\n", expected: interruptWait},
+		{input: "cancel\n", expected: interruptDetach},
+		{input: "detach\n", expected: interruptDetach},
+	}
+
+	for i, c := range cases {
+		var out bytes.Buffer
+		choice, err := promptInterruptChoice(strings.NewReader(c.input), &out, c.canCancel)
+		if err != nil {
+			t.Fatalf("%d, unexpected error, %v", i, err)
+		}
+		if e, g := c.expected, choice; e != g {
+			t.Errorf("%d, expected %s, got %s", i, e, g)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+
+	forge "github.com/nathandines/forge/v2/forgelib"
+
+	"github.com/spf13/cobra"
+)
+
+var resourceSpecFile string
+
+var lintCmd = &cobra.Command{
+	Use:   "lint [template-file...]",
+	Short: "Check CloudFormation templates for problems without deploying them",
+	Long: `
+Check YAML or JSON CloudFormation templates for problems which ValidateTemplate
+doesn't catch, such as references to resources which don't exist, unused
+parameters, circular dependencies and templates over the CloudFormation limits.
+Resource properties are checked against the CloudFormation resource
+specification bundled with Forge, or the one given with --resource-spec-file.
+
+No requests are made to AWS, so no credentials are needed. Exits unsuccessfully
+if any errors are found.
+`,
+	// Linting doesn't need an AWS session
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+	Run: func(cmd *cobra.Command, args []string) {
+		files := args
+		if templateFile != "" {
+			files = append([]string{templateFile}, files...)
+		}
+		if len(files) == 0 {
+			if err := cmd.Usage(); err != nil {
+				log.Fatal(err)
+			}
+			fmt.Printf("\nArgument 'template-file' is required\n")
+			os.Exit(1)
+		}
+
+		options := forge.LintOptions{}
+		if resourceSpecFile != "" {
+			specBody, err := ioutil.ReadFile(resourceSpecFile)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if options.ResourceSpec, err = forge.ParseResourceSpec(specBody); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		failed := false
+		for _, f := range files {
+			body, err := ioutil.ReadFile(f)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if printLintFindings(os.Stdout, f, body, options) {
+				failed = true
+			}
+		}
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
+
+// printLintFindings prints the problems found in a template, reporting whether
+// any of them were errors. A template which can't be parsed is an error
+func printLintFindings(out io.Writer, path string, body []byte, options forge.LintOptions) (failed bool) {
+	findings, err := forge.LintTemplateWithOptions(body, options)
+	if err != nil {
+		fmt.Fprintf(out, "%s: error: %s\n", path, err)
+		return true
+	}
+	for _, f := range findings {
+		fmt.Fprintf(out, "%s:%s\n", path, f)
+		if f.Severity == forge.LintError {
+			failed = true
+		}
+	}
+	return failed
+}
+
+func init() {
+	lintCmd.PersistentFlags().StringVarP(
+		&templateFile,
+		"template-file",
+		"t",
+		"",
+		"Path to the CloudFormation template to be checked",
+	)
+	lintCmd.MarkFlagFilename("template-file")
+
+	lintCmd.PersistentFlags().StringVar(
+		&resourceSpecFile,
+		"resource-spec-file",
+		"",
+		"Path to a CloudFormation resource specification (JSON, optionally gzipped) to check\n"+
+			"resource properties against, instead of the one bundled with Forge",
+	)
+	lintCmd.MarkFlagFilename("resource-spec-file")
+
+	rootCmd.AddCommand(lintCmd)
+}
@@ -0,0 +1,52 @@
+package commands
+
+import (
+	"bytes"
+	"testing"
+
+	forge "github.com/nathandines/forge/v2/forgelib"
+)
+
+func TestPrintLintFindings(t *testing.T) {
+	cases := []struct {
+		body         string
+		expectFailed bool
+		expectOutput string
+	}{
+		{
+			body: "Parameters:\n" +
+				"  Unused:\n" +
+				"    Type: String\n" +
+				"Resources:\n" +
+				"  Topic:\n" +
+				"    Type: AWS::SNS::Topic\n",
+			expectFailed: false,
+			expectOutput: "template.yml:2:3: warning: Parameter \"Unused\" is not used (unused-parameter)\n",
+		},
+		{
+			body: "Resources:\n" +
+				"  Topic:\n" +
+				"    Type: AWS::SNS::Topic\n" +
+				"    Properties:\n" +
+				"      TopicName: !Ref Missing\n",
+			expectFailed: true,
+			expectOutput: "template.yml:5:18: error: Ref to \"Missing\", which is not a parameter or resource (missing-reference)\n",
+		},
+		{
+			body:         "Resources: [",
+			expectFailed: true,
+			expectOutput: "template.yml: error: yaml: line 1: did not find expected node content\n",
+		},
+	}
+
+	for i, c := range cases {
+		var out bytes.Buffer
+		failed := printLintFindings(&out, "template.yml", []byte(c.body), forge.LintOptions{})
+		if e, g := c.expectFailed, failed; e != g {
+			t.Errorf("%d, expected failed %t, got %t", i, e, g)
+		}
+		if e, g := c.expectOutput, out.String(); e != g {
+			t.Errorf("%d, expected output %q, got %q", i, e, g)
+		}
+	}
+}
@@ -6,11 +6,19 @@ import (
 )
 
 func parseParameterOverrideArgs(input []string) (map[string]string, error) {
+	return parseKeyValueArgs(input, "Parameter override")
+}
+
+func parseSessionTagArgs(input []string) (map[string]string, error) {
+	return parseKeyValueArgs(input, "Session tag")
+}
+
+func parseKeyValueArgs(input []string, description string) (map[string]string, error) {
 	output := map[string]string{}
 	for _, i := range input {
 		inputSlice := strings.Split(i, "=")
 		if len(inputSlice) < 2 {
-			return output, fmt.Errorf("Parameter override \"%s\" is invalid. Must be of the format \"<key>=<value>\"", i)
+			return output, fmt.Errorf("%s \"%s\" is invalid. Must be of the format \"<key>=<value>\"", description, i)
 		}
 
 		key := inputSlice[0]
@@ -62,3 +62,16 @@ func TestParseParameterOverrideArgsError(t *testing.T) {
 		}
 	}
 }
+
+func TestParseSessionTagArgs(t *testing.T) {
+	if _, err := parseSessionTagArgs([]string{"Project"}); err == nil {
+		t.Errorf("expected error, got success")
+	}
+	output, err := parseSessionTagArgs([]string{"Project=forge", "Pipeline=a=b"})
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	if e, g := (map[string]string{"Project": "forge", "Pipeline": "a=b"}), output; !reflect.DeepEqual(e, g) {
+		t.Errorf("expected %v, got %v", e, g)
+	}
+}
@@ -0,0 +1,19 @@
+package commands
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// confirmByTypingName asks the operator to type the expected name back, and
+// reports whether what was entered matches it exactly
+func confirmByTypingName(in io.Reader, out io.Writer, prompt, expected string) (bool, error) {
+	fmt.Fprintf(out, "%s\nType \"%s\" to confirm: ", prompt, expected)
+	line, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	return strings.TrimSpace(line) == expected, nil
+}
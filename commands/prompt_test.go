@@ -0,0 +1,35 @@
+package commands
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestConfirmByTypingName(t *testing.T) {
+	cases := []struct {
+		input    string
+		expected bool
+	}{
+		{input: "test-stack\n", expected: true},
+		{input: "  test-stack  \r\n", expected: true},
+		{input: "test-stack", expected: true},
+		{input: "test-stack-2\n", expected: false},
+		{input: "yes\n", expected: false},
+		{input: "", expected: false},
+	}
+
+	for i, c := range cases {
+		var out bytes.Buffer
+		confirmed, err := confirmByTypingName(strings.NewReader(c.input), &out, "Delete?", "test-stack")
+		if err != nil {
+			t.Fatalf("%d, unexpected error, %v", i, err)
+		}
+		if e, g := c.expected, confirmed; e != g {
+			t.Errorf("%d, expected %t, got %t", i, e, g)
+		}
+		if !strings.Contains(out.String(), "test-stack") {
+			t.Errorf("%d, expected prompt to contain the stack name, got \"%s\"", i, out.String())
+		}
+	}
+}
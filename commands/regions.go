@@ -0,0 +1,116 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"text/tabwriter"
+
+	forge "github.com/nathandines/forge/v2/forgelib"
+
+	"github.com/spf13/cobra"
+)
+
+var regions []string
+
+// outputMutex keeps lines written by stacks in different regions from being
+// interleaved with each other
+var outputMutex sync.Mutex
+
+// prefixWriter writes each complete line written to it to the underlying
+// writer, with a prefix added to the start of the line
+type prefixWriter struct {
+	buffer bytes.Buffer
+	out    io.Writer
+	prefix string
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.buffer.Write(p)
+	for {
+		line, err := w.buffer.ReadBytes('\n')
+		if err != nil {
+			// Keep the incomplete line until the rest of it is written
+			w.buffer.Write(line)
+			return len(p), nil
+		}
+		outputMutex.Lock()
+		_, err = fmt.Fprintf(w.out, "%s%s", w.prefix, line)
+		outputMutex.Unlock()
+		if err != nil {
+			return len(p), err
+		}
+	}
+}
+
+type regionResult struct {
+	err    error
+	region string
+	status string
+}
+
+// stacksInRegions makes a copy of the stack for each of the regions
+func stacksInRegions(s forge.Stack, regions []string) (stacks []*forge.Stack) {
+	for _, r := range regions {
+		regionalStack := s
+		regionalStack.Region = r
+		stacks = append(stacks, &regionalStack)
+	}
+	return stacks
+}
+
+// runInRegions runs the same action against each of the regional stacks at
+// once, with the output for each prefixed by its region. A table of the results
+// is printed once they have all finished, and false is returned if the action
+// failed in any of the regions
+func runInRegions(stacks []*forge.Stack, action func(s *forge.Stack, out io.Writer) error) bool {
+	results := make([]regionResult, len(stacks))
+	var wg sync.WaitGroup
+	for i, s := range stacks {
+		wg.Add(1)
+		go func(i int, s *forge.Stack) {
+			defer wg.Done()
+			out := &prefixWriter{out: os.Stdout, prefix: fmt.Sprintf("[%s] ", s.Region)}
+			results[i] = regionResult{err: action(s, out), region: s.Region}
+			if s.StackInfo != nil {
+				results[i].status = *s.StackInfo.StackStatus
+			}
+		}(i, s)
+	}
+	wg.Wait()
+
+	return printRegionResults(os.Stdout, results)
+}
+
+func printRegionResults(out io.Writer, results []regionResult) bool {
+	succeeded := true
+	fmt.Fprintln(out)
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "REGION\tSTACK STATUS\tRESULT")
+	for _, r := range results {
+		result := "OK"
+		if r.err != nil {
+			result = r.err.Error()
+			succeeded = false
+		}
+		status := r.status
+		if status == "" {
+			status = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", r.region, status, result)
+	}
+	w.Flush()
+	return succeeded
+}
+
+func addRegionsFlag(cmd *cobra.Command, action string) {
+	cmd.PersistentFlags().StringSliceVar(
+		&regions,
+		"regions",
+		[]string{},
+		fmt.Sprintf("Regions to %s the stack in at once. Can be defined multiple times. The exit code\n"+
+			"is unsuccessful if the stack failed in any of them", action),
+	)
+}
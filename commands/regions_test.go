@@ -0,0 +1,76 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestPrefixWriter(t *testing.T) {
+	cases := []struct {
+		writes   []string
+		expected string
+	}{
+		{writes: []string{"one\ntwo\n"}, expected: "[r] one\n[r] two\n"},
+		{writes: []string{"on", "e\ntw", "o\n"}, expected: "[r] one\n[r] two\n"},
+		{writes: []string{"one\n", "incomplete"}, expected: "[r] one\n"},
+		{writes: []string{"\n"}, expected: "[r] \n"},
+	}
+
+	for i, c := range cases {
+		var out bytes.Buffer
+		w := &prefixWriter{out: &out, prefix: "[r] "}
+		for _, s := range c.writes {
+			if n, err := w.Write([]byte(s)); err != nil {
+				t.Fatalf("%d, unexpected error, %v", i, err)
+			} else if n != len(s) {
+				t.Errorf("%d, expected %d bytes written, got %d", i, len(s), n)
+			}
+		}
+		if e, g := c.expected, out.String(); e != g {
+			t.Errorf("%d, expected %q, got %q", i, e, g)
+		}
+	}
+}
+
+func TestPrintRegionResults(t *testing.T) {
+	cases := []struct {
+		results       []regionResult
+		expectSuccess bool
+		expectLines   []string
+	}{
+		{
+			results: []regionResult{
+				{region: "us-east-1", status: "UPDATE_COMPLETE"},
+				{region: "eu-west-1", status: "CREATE_COMPLETE"},
+			},
+			expectSuccess: true,
+			expectLines:   []string{"us-east-1  UPDATE_COMPLETE  OK", "eu-west-1  CREATE_COMPLETE  OK"},
+		},
+		{
+			results: []regionResult{
+				{region: "us-east-1", status: "UPDATE_COMPLETE"},
+				{region: "eu-west-1", status: "ROLLBACK_COMPLETE", err: fmt.Errorf("Stack deploy failed!")},
+				{region: "ap-south-1", err: fmt.Errorf("Access Denied")},
+			},
+			expectSuccess: false,
+			expectLines: []string{
+				"eu-west-1   ROLLBACK_COMPLETE  Stack deploy failed!",
+				"ap-south-1  -                  Access Denied",
+			},
+		},
+	}
+
+	for i, c := range cases {
+		var out bytes.Buffer
+		if e, g := c.expectSuccess, printRegionResults(&out, c.results); e != g {
+			t.Errorf("%d, expected %t, got %t", i, e, g)
+		}
+		for _, l := range c.expectLines {
+			if !strings.Contains(out.String(), l) {
+				t.Errorf("%d, expected output to contain %q, got %q", i, l, out.String())
+			}
+		}
+	}
+}
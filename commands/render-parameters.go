@@ -0,0 +1,73 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	forge "github.com/nathandines/forge/v2/forgelib"
+
+	"github.com/spf13/cobra"
+)
+
+var renderParametersCmd = &cobra.Command{
+	Use:   "render-parameters",
+	Short: "Show the parameter values which a deployment would use, and where they came from",
+	Long: `
+Resolve the values of the template parameters from the parameter files and
+overrides exactly as deploy would, without creating or updating the stack. For
+each parameter, the final value is shown along with the file or override which
+supplied it, and the earlier values which it overrode. The values of NoEcho
+parameters are masked. When --stack-name is given and the stack exists, values
+kept from the stack with {{ previous }} or --use-previous-parameters are shown.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		readStackFiles(cmd)
+
+		if len(assumeRoleArns) > 0 {
+			if err := assumeRole(); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		rendered, err := stack.RenderParametersWithContext(commandContext)
+		if err != nil {
+			log.Fatal(err)
+		}
+		printRenderedParameters(os.Stdout, rendered)
+	},
+}
+
+func printRenderedParameters(out io.Writer, rendered []forge.RenderedParameter) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Parameter\tValue\tSource\tOverrode")
+	for _, p := range rendered {
+		source := p.Source
+		if source == "" {
+			source = "(no value)"
+		}
+		var overridden []string
+		for _, o := range p.Overridden {
+			overridden = append(overridden, fmt.Sprintf("%s (%s)", renderedValue(o), o.Source))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", p.Key, renderedValue(p.ParameterValue), source, strings.Join(overridden, ", "))
+	}
+	w.Flush()
+}
+
+// renderedValue shows a value, marking those which are kept from the stack
+func renderedValue(v forge.ParameterValue) string {
+	if v.UsePrevious {
+		return strings.TrimSpace(v.Value + " {{ previous }}")
+	}
+	return v.Value
+}
+
+func init() {
+	addStackFileFlags(renderParametersCmd)
+	addUsePreviousParametersFlag(renderParametersCmd)
+	rootCmd.AddCommand(renderParametersCmd)
+}
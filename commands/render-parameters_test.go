@@ -0,0 +1,45 @@
+package commands
+
+import (
+	"bytes"
+	"testing"
+
+	forge "github.com/nathandines/forge/v2/forgelib"
+)
+
+func TestPrintRenderedParameters(t *testing.T) {
+	rendered := []forge.RenderedParameter{
+		{
+			Key: "Environment",
+			Overridden: []forge.ParameterValue{
+				{Source: "template default", Value: "dev"},
+				{Source: "common.yml", Value: "test"},
+			},
+			ParameterValue: forge.ParameterValue{Source: "parameter override", Value: "prod"},
+		},
+		{
+			Key:            "Password",
+			NoEcho:         true,
+			ParameterValue: forge.ParameterValue{Source: "secrets.yml", Value: "****"},
+		},
+		{
+			Key:            "VpcId",
+			Overridden:     []forge.ParameterValue{{Source: "common.yml", Value: "vpc-456"}},
+			ParameterValue: forge.ParameterValue{Source: "prod.yml", UsePrevious: true, Value: "vpc-123"},
+		},
+		{
+			Key: "Unset",
+		},
+	}
+	expected := "Parameter    Value                   Source              Overrode\n" +
+		"Environment  prod                    parameter override  dev (template default), test (common.yml)\n" +
+		"Password     ****                    secrets.yml         \n" +
+		"VpcId        vpc-123 {{ previous }}  prod.yml            vpc-456 (common.yml)\n" +
+		"Unset                                (no value)          \n"
+
+	out := bytes.Buffer{}
+	printRenderedParameters(&out, rendered)
+	if g := out.String(); g != expected {
+		t.Errorf("expected output %q, got %q", expected, g)
+	}
+}
@@ -3,25 +3,40 @@ package commands
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"os"
-	"regexp"
+	"os/exec"
+	"runtime"
+	"strings"
 	"time"
 
 	forge "github.com/nathandines/forge/v2/forgelib"
 
-	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
 	"github.com/spf13/cobra"
 )
 
 var stack = forge.Stack{}
-var stackInProgressRegexp = regexp.MustCompile("^.*_IN_PROGRESS$")
 
-var assumeRoleArn string
+var assumeRoleArns []string
 var assumeRoleMFASerial string
+var assumeRoleOptions forge.AssumeRoleOptions
+var assumeRoleSessionTags []string
+var webIdentityTokenEnvVar string
+var webIdentityTokenFile string
 var assumeRoleWithMFA bool
+var mfaTokenCommand string
+
+// Environment variable which the MFA token can be given in, for
+// non-interactive use
+const mfaTokenEnvVar = "FORGE_MFA_TOKEN"
+
+var assumeYes bool
 var eventPollingPeriod int
+var profile string
+var region string
 
 var rootCmd = &cobra.Command{
 	Use:   "forge",
@@ -33,6 +48,17 @@ friendly for continuous delivery environments.
 GitHub: https://github.com/nathandines/forge
 `,
 	Version: "v2.3.0",
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		// The session is set up only once flags are parsed, so that the
+		// profile and region flags apply to it
+		if err := forge.Configure(profile, region); err != nil {
+			log.Fatal(err)
+		}
+		if (webIdentityTokenFile != "" || webIdentityTokenEnvVar != "") && len(assumeRoleArns) == 0 {
+			log.Fatal(fmt.Errorf("A web identity token can only be used with --assume-role-arn"))
+		}
+		handleInterrupts()
+	},
 }
 
 func init() {
@@ -43,23 +69,36 @@ func init() {
 		"",
 		"Name of the stack to manage",
 	)
+	rootCmd.PersistentFlags().StringVar(
+		&profile,
+		"profile",
+		"",
+		"Named profile from the AWS shared config files to take credentials and settings from",
+	)
+	rootCmd.PersistentFlags().StringVar(
+		&region,
+		"region",
+		"",
+		"AWS region to manage the stack in, overriding the region from the environment or profile",
+	)
 	rootCmd.PersistentFlags().StringVar(
 		&stack.CfnRoleName,
 		"cfn-role-name",
 		"",
 		"Name of IAM role in the destination account for the CloudFormation service to assume",
 	)
-	rootCmd.PersistentFlags().StringVar(
-		&assumeRoleArn,
+	rootCmd.PersistentFlags().StringSliceVar(
+		&assumeRoleArns,
 		"assume-role-arn",
-		"",
-		"Name of IAM role to assume BEFORE making requests to CloudFormation",
+		[]string{},
+		"ARN of IAM role to assume BEFORE making requests to CloudFormation. Can be defined\n"+
+			"multiple times to chain roles, each assumed with the credentials of the one before it",
 	)
 	rootCmd.PersistentFlags().BoolVar(
 		&assumeRoleWithMFA,
 		"assume-role-with-mfa",
 		false,
-		"Flag to specify that MFA is required to assume the role",
+		"Flag to specify that MFA is required to assume the (first) role",
 	)
 	rootCmd.PersistentFlags().StringVar(
 		&assumeRoleMFASerial,
@@ -67,6 +106,74 @@ func init() {
 		"",
 		"Specify the MFA serial if it cannot be automatically detected",
 	)
+	rootCmd.PersistentFlags().StringVar(
+		&mfaTokenCommand,
+		"mfa-token-command",
+		"",
+		"Command which prints the MFA token, instead of asking for it (implies\n"+
+			"--assume-role-with-mfa). The token can also be given with the "+mfaTokenEnvVar+"\n"+
+			"environment variable",
+	)
+	rootCmd.PersistentFlags().StringVar(
+		&assumeRoleOptions.ExternalID,
+		"assume-role-external-id",
+		"",
+		"External ID to give when assuming the role(s), as required by many third-party roles",
+	)
+	rootCmd.PersistentFlags().DurationVar(
+		&assumeRoleOptions.Duration,
+		"assume-role-duration",
+		0,
+		"Duration of the assumed role session (e.g. \"1h\"). Defaults to 15 minutes, or an hour\n"+
+			"when using MFA",
+	)
+	rootCmd.PersistentFlags().StringVar(
+		&assumeRoleOptions.RoleSessionName,
+		"assume-role-session-name",
+		"",
+		"Name of the assumed role session. Defaults to the name of the current user or role session",
+	)
+	rootCmd.PersistentFlags().StringSliceVar(
+		&assumeRoleSessionTags,
+		"assume-role-session-tag",
+		[]string{},
+		"Session tag to add when assuming the (first) role (format \"<key>=<value>\"). Can be\n"+
+			"defined multiple times for multiple tags",
+	)
+	rootCmd.PersistentFlags().StringSliceVar(
+		&assumeRoleOptions.TransitiveTagKeys,
+		"assume-role-transitive-tag-keys",
+		[]string{},
+		"Keys of the session tags which are passed on to roles chained after the first one",
+	)
+	rootCmd.PersistentFlags().StringVar(
+		&assumeRoleOptions.SourceIdentity,
+		"assume-role-source-identity",
+		"",
+		"Source identity to set when assuming the (first) role, to attribute the actions taken\n"+
+			"with the role",
+	)
+	rootCmd.PersistentFlags().StringVar(
+		&webIdentityTokenFile,
+		"web-identity-token-file",
+		"",
+		"Path to an OIDC token (such as one issued to a CI runner) to assume the (first) role with,\n"+
+			"instead of the current credentials",
+	)
+	rootCmd.PersistentFlags().StringVar(
+		&webIdentityTokenEnvVar,
+		"web-identity-token-env-var",
+		"",
+		"Name of an environment variable holding an OIDC token to assume the (first) role with,\n"+
+			"instead of the current credentials",
+	)
+	rootCmd.PersistentFlags().BoolVarP(
+		&assumeYes,
+		"yes",
+		"y",
+		false,
+		"Skip interactive confirmations, such as typing the stack name before destroying a stack",
+	)
 	rootCmd.PersistentFlags().IntVar(
 		&eventPollingPeriod,
 		"event-polling-period",
@@ -83,73 +190,141 @@ func Execute() {
 	}
 }
 
-func printStackEvents(s *forge.Stack, after *time.Time) {
-list_events:
-	bunch, err := s.ListEvents(after)
+// printStackEvent prints a stack event as JSON
+func printStackEvent(out io.Writer, e *cloudformation.StackEvent) error {
+	// IDs renamed for JSON output to match the API response data
+	stackEvent := struct {
+		LogicalResourceID    *string   `json:"LogicalResourceId"`
+		PhysicalResourceID   *string   `json:"PhysicalResourceId,omitempty"`
+		ResourceStatus       *string   `json:""`
+		ResourceStatusReason *string   `json:",omitempty"`
+		ResourceType         *string   `json:""`
+		Timestamp            time.Time `json:""`
+	}{
+		(*e).LogicalResourceId,
+		(*e).PhysicalResourceId,
+		(*e).ResourceStatus,
+		(*e).ResourceStatusReason,
+		(*e).ResourceType,
+		(*(*e).Timestamp).Local(),
+	}
+	jsonData, err := json.MarshalIndent(stackEvent, "", "  ")
 	if err != nil {
-		if err2 := rotateRoleCredentials(err); err2 != nil {
-			log.Fatal(err)
-		}
-		goto list_events
-	}
-	for _, e := range bunch {
-		// IDs renamed for JSON output to match the API response data
-		stackEvent := struct {
-			LogicalResourceID    *string   `json:"LogicalResourceId"`
-			PhysicalResourceID   *string   `json:"PhysicalResourceId,omitempty"`
-			ResourceStatus       *string   `json:""`
-			ResourceStatusReason *string   `json:",omitempty"`
-			ResourceType         *string   `json:""`
-			Timestamp            time.Time `json:""`
-		}{
-			(*e).LogicalResourceId,
-			(*e).PhysicalResourceId,
-			(*e).ResourceStatus,
-			(*e).ResourceStatusReason,
-			(*e).ResourceType,
-			(*(*e).Timestamp).Local(),
-		}
-		jsonData, err := json.MarshalIndent(stackEvent, "", "  ")
-		if err != nil {
-			log.Fatal(err)
-		}
-		fmt.Println(string(jsonData))
+		return err
+	}
+	fmt.Fprintln(out, string(jsonData))
+	return nil
+}
+
+// waitForStack follows the status and events of the stack until it is no
+// longer in progress, returning an error unless the operation succeeded. An
+// error describing the state of the stack is returned if the operator detaches
+// from it
+func waitForStack(s *forge.Stack, out io.Writer, after *time.Time, operation forge.StackOperation) (forge.WaitResult, error) {
+	defer followStack(s)()
+	result, err := s.Wait(commandContext, forge.WaitOptions{
+		After: *after,
+		EventHandler: func(e *cloudformation.StackEvent) error {
+			return printStackEvent(out, e)
+		},
+		Interval:  time.Duration(eventPollingPeriod) * time.Second,
+		Operation: operation,
+	})
+	*after = result.LastEventTime
+	if err != nil {
+		return result, detachedError(s, err)
 	}
-	if len(bunch) > 0 {
-		*after = *bunch[len(bunch)-1].Timestamp
+	if !result.Succeeded() {
+		return result, fmt.Errorf("Stack %s failed! Stack Status: %s", operation, result.Status)
 	}
+	return result, nil
 }
 
-func rotateRoleCredentials(err error) error {
-	if awsErr, ok := err.(awserr.Error); ok {
-		switch awsErr.Code() {
-		case "ExpiredToken":
-			forge.UnassumeAllRoles()
-			if err2 := assumeRole(); err2 != nil {
-				return err2
-			}
-		default:
-			return err
-		}
-	} else {
+// detachedError describes the state which the stack was left in when the
+// operator detached from it, or returns err unchanged otherwise
+func detachedError(s *forge.Stack, err error) error {
+	if commandContext.Err() == nil {
 		return err
 	}
-	return nil
+	status := "unknown"
+	if s.StackInfo != nil {
+		status = *s.StackInfo.StackStatus
+	}
+	return fmt.Errorf("Detached from stack %s, leaving its operation running. Last seen stack status: %s", s.StackName, status)
+}
+
+// configureFromFile sets up the session again with the profile and region
+// declared in a stack settings or StackSet config file, for those which weren't
+// given as flags
+func configureFromFile(cmd *cobra.Command, fileProfile, fileRegion string) error {
+	changed := false
+	if fileProfile != "" && !cmd.Flags().Changed("profile") {
+		profile = fileProfile
+		changed = true
+	}
+	if fileRegion != "" && !cmd.Flags().Changed("region") {
+		region = fileRegion
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	return forge.Configure(profile, region)
 }
 
 func assumeRole() error {
-	if assumeRoleWithMFA {
-		mfaToken, err := stscreds.StdinTokenProvider()
-		if err != nil {
-			return err
-		}
-		if err := forge.AssumeRoleWithMFA(assumeRoleArn, mfaToken, assumeRoleMFASerial); err != nil {
-			return err
-		}
+	options := assumeRoleOptions
+	options.MFASerial = assumeRoleMFASerial
+	tags, err := parseSessionTagArgs(assumeRoleSessionTags)
+	if err != nil {
+		return err
+	}
+	options.Tags = tags
+	switch {
+	case webIdentityTokenFile != "" && webIdentityTokenEnvVar != "":
+		return fmt.Errorf("Only one of --web-identity-token-file and --web-identity-token-env-var can be used")
+	case webIdentityTokenFile != "":
+		options.WebIdentityToken = stscreds.FetchTokenPath(webIdentityTokenFile)
+	case webIdentityTokenEnvVar != "":
+		options.WebIdentityToken = forge.WebIdentityTokenFromEnv(webIdentityTokenEnvVar)
+	}
+	if assumeRoleWithMFA || mfaTokenCommand != "" {
+		options.MFATokenProvider = mfaTokenProvider
+		options.CacheMFASession = true
+	}
+	return forge.AssumeRoleChain(assumeRoleArns, options)
+}
+
+// mfaTokenProvider gets the MFA token from the environment, the MFA token
+// command, or by asking for it, in that order of precedence
+func mfaTokenProvider() (string, error) {
+	if token := os.Getenv(mfaTokenEnvVar); token != "" {
+		return token, nil
+	}
+	if mfaTokenCommand != "" {
+		return runMFATokenCommand(mfaTokenCommand)
+	}
+	return stscreds.StdinTokenProvider()
+}
+
+// runMFATokenCommand runs the command with the shell, and returns the token it
+// printed. The command can still prompt the user through stderr
+func runMFATokenCommand(command string) (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
 	} else {
-		if err := forge.AssumeRole(assumeRoleArn); err != nil {
-			return err
-		}
+		cmd = exec.Command("sh", "-c", command)
 	}
-	return nil
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("MFA token command failed: %s", err)
+	}
+	token := strings.TrimSpace(string(out))
+	if token == "" {
+		return "", fmt.Errorf("MFA token command didn't print a token")
+	}
+	return token, nil
 }
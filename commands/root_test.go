@@ -0,0 +1,115 @@
+package commands
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestMFATokenProvider(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test commands need a POSIX shell")
+	}
+	oldMFATokenCommand := mfaTokenCommand
+	defer func() { mfaTokenCommand = oldMFATokenCommand }()
+
+	cases := []struct {
+		envToken    string
+		command     string
+		expected    string
+		expectError bool
+	}{
+		{command: "echo 123456", expected: "123456"},
+		{command: "printf '  654321\n\n'", expected: "654321"},
+		{envToken: "111111", command: "echo 123456", expected: "111111"},
+		{command: "true", expectError: true},
+		{command: "exit 1", expectError: true},
+	}
+
+	for i, c := range cases {
+		t.Setenv(mfaTokenEnvVar, c.envToken)
+		mfaTokenCommand = c.command
+		token, err := mfaTokenProvider()
+		if c.expectError {
+			if err == nil {
+				t.Errorf("%d, expected error, got none", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%d, unexpected error, %v", i, err)
+		}
+		if e, g := c.expected, token; e != g {
+			t.Errorf("%d, expected %s, got %s", i, e, g)
+		}
+	}
+}
+
+func TestConfigureFromFile(t *testing.T) {
+	oldProfile, oldRegion := profile, region
+	defer func() { profile, region = oldProfile, oldRegion }()
+
+	configFile := filepath.Join(t.TempDir(), "config")
+	if err := ioutil.WriteFile(configFile, []byte("[profile deploy]\nregion = us-east-1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("AWS_CONFIG_FILE", configFile)
+
+	cases := []struct {
+		flags         map[string]string
+		fileProfile   string
+		fileRegion    string
+		expectProfile string
+		expectRegion  string
+	}{
+		// Nothing declared in the file
+		{},
+		// Declared in the file only
+		{
+			fileProfile:   "deploy",
+			fileRegion:    "eu-west-1",
+			expectProfile: "deploy",
+			expectRegion:  "eu-west-1",
+		},
+		// Flags take precedence over the file
+		{
+			flags:         map[string]string{"profile": "default", "region": "ap-southeast-2"},
+			fileProfile:   "deploy",
+			fileRegion:    "eu-west-1",
+			expectProfile: "default",
+			expectRegion:  "ap-southeast-2",
+		},
+		// Flags explicitly set to blank values also take precedence
+		{
+			flags:         map[string]string{"region": ""},
+			fileProfile:   "deploy",
+			fileRegion:    "eu-west-1",
+			expectProfile: "deploy",
+		},
+	}
+
+	for i, c := range cases {
+		profile, region = "", ""
+		cmd := &cobra.Command{}
+		cmd.Flags().StringVar(&profile, "profile", "", "")
+		cmd.Flags().StringVar(&region, "region", "", "")
+		for k, v := range c.flags {
+			if err := cmd.Flags().Set(k, v); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err := configureFromFile(cmd, c.fileProfile, c.fileRegion); err != nil {
+			t.Fatalf("%d, unexpected error, %v", i, err)
+		}
+		if e, g := c.expectProfile, profile; e != g {
+			t.Errorf("%d, expected profile %q, got %q", i, e, g)
+		}
+		if e, g := c.expectRegion, region; e != g {
+			t.Errorf("%d, expected region %q, got %q", i, e, g)
+		}
+	}
+}
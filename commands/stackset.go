@@ -0,0 +1,191 @@
+package commands
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	forge "github.com/nathandines/forge/v2/forgelib"
+
+	"github.com/spf13/cobra"
+)
+
+var stackSet = forge.StackSet{}
+var stackSetConfigFile string
+
+var stackSetCmd = &cobra.Command{
+	Use:   "stackset",
+	Short: "Manage CloudFormation StackSets",
+}
+
+var stackSetDeployCmd = &cobra.Command{
+	Use:   "deploy",
+	Short: "Deploy a CloudFormation StackSet and its stack instances",
+	Run: func(cmd *cobra.Command, args []string) {
+		if stackSet.StackSetName == "" {
+			if err := cmd.Usage(); err != nil {
+				log.Fatal(err)
+			}
+			fmt.Printf("\nArgument 'stackset-name' is required\n")
+			os.Exit(1)
+		}
+
+		readStackFiles(cmd)
+
+		// Read stackset-config-file, with explicitly set flags taking precedence
+		if stackSetConfigFile != "" {
+			stackSetConfigBody, err := ioutil.ReadFile(stackSetConfigFile)
+			if err != nil {
+				log.Fatal(err)
+			}
+			config, err := forge.ParseStackSetConfig(string(stackSetConfigBody))
+			if err != nil {
+				log.Fatal(err)
+			}
+			if err := configureFromFile(cmd, config.Profile, config.Region); err != nil {
+				log.Fatal(err)
+			}
+			flags := cmd.Flags()
+			if !flags.Changed("accounts") {
+				stackSet.Accounts = config.Accounts
+			}
+			if !flags.Changed("organizational-unit-ids") {
+				stackSet.OrganizationalUnitIDs = config.OrganizationalUnitIDs
+			}
+			if !flags.Changed("regions") {
+				stackSet.Regions = config.Regions
+			}
+			if !flags.Changed("failure-tolerance-count") {
+				stackSet.FailureToleranceCount = config.FailureToleranceCount
+			}
+			if !flags.Changed("max-concurrent-count") {
+				stackSet.MaxConcurrentCount = config.MaxConcurrentCount
+			}
+			if !flags.Changed("administration-role-arn") {
+				stackSet.AdministrationRoleARN = config.AdministrationRoleARN
+			}
+			if !flags.Changed("execution-role-name") {
+				stackSet.ExecutionRoleName = config.ExecutionRoleName
+			}
+		}
+
+		stackSet.TemplateBody = stack.TemplateBody
+		stackSet.TagsBody = stack.TagsBody
+		stackSet.ParameterBodies = stack.ParameterBodies
+		stackSet.ParameterSources = stack.ParameterSources
+		stackSet.ParameterOverrides = stack.ParameterOverrides
+		stackSet.StrictParameters = stack.StrictParameters
+		stackSet.PollingPeriod = time.Duration(eventPollingPeriod) * time.Second
+		stackSet.OperationCallback = printStackSetOperation
+
+		if len(assumeRoleArns) > 0 {
+			if err := assumeRole(); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		operations, err := stackSet.DeployWithContext(commandContext)
+		if err != nil {
+			fmt.Print("\n")
+			log.Fatal(err)
+		}
+		if len(operations) == 0 {
+			fmt.Println("All stack instances are already present.")
+		}
+	},
+}
+
+// printStackSetOperation prints the status of each stack instance affected by
+// a finished StackSet operation
+func printStackSetOperation(o forge.StackSetOperation) {
+	fmt.Printf("\nStackSet %s operation %s: %s\n\n", o.Action, o.OperationID, o.Status)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ACCOUNT\tREGION\tSTATUS\tREASON")
+	for _, r := range o.Results {
+		account := r.Account
+		if r.OrganizationalUnitID != "" {
+			account = fmt.Sprintf("%s (%s)", r.Account, r.OrganizationalUnitID)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", account, r.Region, r.Status, r.StatusReason)
+	}
+	w.Flush()
+}
+
+func init() {
+	addStackFileFlags(stackSetDeployCmd)
+
+	stackSetDeployCmd.PersistentFlags().StringVar(
+		&stackSet.StackSetName,
+		"stackset-name",
+		"",
+		"Name of the StackSet to manage",
+	)
+
+	stackSetDeployCmd.PersistentFlags().StringVar(
+		&stackSetConfigFile,
+		"stackset-config-file",
+		"",
+		"Path to the file which declares the deployment targets and operation preferences\n"+
+			"(Accounts, OrganizationalUnitIds, Regions, FailureToleranceCount, MaxConcurrentCount,\n"+
+			"AdministrationRoleARN and ExecutionRoleName) for this StackSet, and the Profile and\n"+
+			"Region to manage it from",
+	)
+	stackSetDeployCmd.MarkFlagFilename("stackset-config-file")
+
+	stackSetDeployCmd.PersistentFlags().StringSliceVar(
+		&stackSet.Accounts,
+		"accounts",
+		[]string{},
+		"Accounts to deploy stack instances to. Can be defined multiple times",
+	)
+
+	stackSetDeployCmd.PersistentFlags().StringSliceVar(
+		&stackSet.OrganizationalUnitIDs,
+		"organizational-unit-ids",
+		[]string{},
+		"Organizational units to deploy stack instances to, using service-managed permissions.\n"+
+			"Can be defined multiple times",
+	)
+
+	stackSetDeployCmd.PersistentFlags().StringSliceVar(
+		&stackSet.Regions,
+		"regions",
+		[]string{},
+		"Regions to deploy stack instances to, in the order they are deployed. Can be defined\n"+
+			"multiple times",
+	)
+
+	stackSetDeployCmd.PersistentFlags().Int64Var(
+		&stackSet.FailureToleranceCount,
+		"failure-tolerance-count",
+		0,
+		"Number of stack instances which can fail per region before the operation is stopped",
+	)
+
+	stackSetDeployCmd.PersistentFlags().Int64Var(
+		&stackSet.MaxConcurrentCount,
+		"max-concurrent-count",
+		0,
+		"Maximum number of accounts to deploy to at once per region",
+	)
+
+	stackSetDeployCmd.PersistentFlags().StringVar(
+		&stackSet.AdministrationRoleARN,
+		"administration-role-arn",
+		"",
+		"ARN of the IAM role used to administer a self-managed StackSet",
+	)
+
+	stackSetDeployCmd.PersistentFlags().StringVar(
+		&stackSet.ExecutionRoleName,
+		"execution-role-name",
+		"",
+		"Name of the IAM role in the target accounts used by a self-managed StackSet",
+	)
+
+	stackSetCmd.AddCommand(stackSetDeployCmd)
+	rootCmd.AddCommand(stackSetCmd)
+}
@@ -3,6 +3,7 @@ package forgelib
 import (
 	"fmt"
 	"os"
+	"sort"
 	"strings"
 	"time"
 
@@ -10,139 +11,297 @@ import (
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/cloudformation"
-	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
 	"github.com/aws/aws-sdk-go/service/iam"
-	"github.com/aws/aws-sdk-go/service/iam/iamiface"
 	"github.com/aws/aws-sdk-go/service/sts"
-	"github.com/aws/aws-sdk-go/service/sts/stsiface"
 )
 
-var originalSession *session.Session
-var cfnClient cloudformationiface.CloudFormationAPI // CloudFormation Service
-var iamClient iamiface.IAMAPI                       // IAM Service
-var stsClient stsiface.STSAPI                       // STS Service
-
-func init() {
-	stscreds.DefaultDuration = time.Duration(60) * time.Minute
-	originalSession = session.Must(session.NewSessionWithOptions(session.Options{
-		SharedConfigState:       session.SharedConfigEnable,
-		AssumeRoleTokenProvider: stscreds.StdinTokenProvider,
-	}))
-	setupClients(originalSession)
+// AssumeRoleOptions are the optional settings for assuming a role. Zero values
+// leave the setting to its default
+type AssumeRoleOptions struct {
+	// Defaults to 15 minutes, or an hour when using MFA. Credentials are
+	// refreshed before they expire
+	Duration   time.Duration
+	ExternalID string
+	MFASerial  string
+	MFAToken   string
+	// Called for an MFA token when MFAToken is blank or has already been
+	// used, only if a token is needed (i.e. the credentials aren't cached)
+	MFATokenProvider func() (string, error)
+	// Cache the credentials of a role assumed with MFA on disk, keyed by the
+	// role, session name and MFA serial, so that other Forge commands can use
+	// the role session without another MFA token until it expires
+	CacheMFASession bool
+	// Defaults to the name of the current user or role session
+	RoleSessionName   string
+	SourceIdentity    string
+	Tags              map[string]string
+	TransitiveTagKeys []string
+	// Assume the role with this OIDC token instead of the current
+	// credentials. The token is fetched again each time the credentials are
+	// refreshed
+	WebIdentityToken stscreds.TokenFetcher
 }
 
-func setupClients(sess *session.Session, cfg ...*aws.Config) {
-	generalConfig := aws.Config{
-		MaxRetries: aws.Int(10),
-	}
+// Assumed role credentials are refreshed this long before they expire, so
+// that they don't expire part way through a request
+const credentialsExpiryWindow = 5 * time.Minute
 
-	// Need to mess around with copying values and making pointers to them due
-	// to the way in which the AWS Go SDK passes around data
-	cfnConfig := aws.Config{}
-	if endpoint, ok := os.LookupEnv("AWS_ENDPOINT_CLOUDFORMATION"); ok {
-		cfnConfig.Endpoint = aws.String(endpoint)
-	}
-	cfnConfigs := append([]*aws.Config{&generalConfig, &cfnConfig}, cfg...)
-	cfnClient = cloudformation.New(sess, cfnConfigs...)
+// Roles requiring MFA are assumed for this long unless given a duration, so
+// that MFA is asked for less often
+const mfaRoleDuration = time.Hour
 
-	iamConfig := aws.Config{}
-	if endpoint, ok := os.LookupEnv("AWS_ENDPOINT_IAM"); ok {
-		iamConfig.Endpoint = aws.String(endpoint)
-	}
-	iamConfigs := append([]*aws.Config{&generalConfig, &cfnConfig}, cfg...)
-	iamClient = iam.New(sess, iamConfigs...)
+// WebIdentityTokenFromEnv fetches an OIDC token from the environment variable
+// it names, such as one set by a CI runner
+type WebIdentityTokenFromEnv string
 
-	stsConfig := aws.Config{}
-	if endpoint, ok := os.LookupEnv("AWS_ENDPOINT_STS"); ok {
-		stsConfig.Endpoint = aws.String(endpoint)
+// FetchToken reads the token from the environment variable
+func (e WebIdentityTokenFromEnv) FetchToken(credentials.Context) ([]byte, error) {
+	token, ok := os.LookupEnv(string(e))
+	if !ok || token == "" {
+		return nil, fmt.Errorf("Environment variable %s does not contain a web identity token", string(e))
 	}
-	stsConfigs := append([]*aws.Config{&generalConfig, &stsConfig}, cfg...)
-	stsClient = sts.New(sess, stsConfigs...)
+	return []byte(token), nil
 }
 
 // AssumeRole will change your credentials for Forge to those of an assumed role
 // as specific by the ARN specified in the arguments to AssumeRole
 func AssumeRole(roleArn string) error {
-	roleSessionName, err := getRoleSessionName()
-	if err != nil {
-		return err
-	}
-	assumeOut, err := stsClient.AssumeRole(&sts.AssumeRoleInput{
-		DurationSeconds: aws.Int64(900),
-		RoleSessionName: aws.String(roleSessionName),
-		RoleArn:         aws.String(roleArn),
-	})
-	if err != nil {
-		return err
-	}
-	session, err := setupRoleSession(assumeOut)
-	if err != nil {
-		return err
-	}
-	setupClients(session)
-	return nil
+	return defaultClient.AssumeRole(roleArn)
+}
+
+// AssumeRole changes the credentials of the client to those of an assumed
+// role, as with the package-level AssumeRole
+func (c *Client) AssumeRole(roleArn string) error {
+	return c.AssumeRoleWithOptions(roleArn, AssumeRoleOptions{})
 }
 
 // AssumeRoleWithMFA performs the same function as AssumeRole, but accepts an
 // MFA token as well. A blank value for mfaSerial will attempt to auto-detect
 // the serial of the users MFA
 func AssumeRoleWithMFA(roleArn, mfaToken, mfaSerial string) error {
-	if mfaSerial == "" {
-		var err error
-		mfaSerial, err = getMFASerial()
+	return defaultClient.AssumeRoleWithMFA(roleArn, mfaToken, mfaSerial)
+}
+
+// AssumeRoleWithMFA changes the credentials of the client, as with the
+// package-level AssumeRoleWithMFA
+func (c *Client) AssumeRoleWithMFA(roleArn, mfaToken, mfaSerial string) error {
+	return c.AssumeRoleWithOptions(roleArn, AssumeRoleOptions{
+		MFASerial: mfaSerial,
+		MFAToken:  mfaToken,
+	})
+}
+
+// AssumeRoleWithWebIdentity will change your credentials for Forge to those of
+// a role assumed with an OIDC token, such as those issued to CI runners. Use
+// stscreds.FetchTokenPath to read the token from a file, or
+// WebIdentityTokenFromEnv to read it from an environment variable. The
+// credentials are refreshed automatically before they expire
+func AssumeRoleWithWebIdentity(roleArn string, token stscreds.TokenFetcher) error {
+	return defaultClient.AssumeRoleWithWebIdentity(roleArn, token)
+}
+
+// AssumeRoleWithWebIdentity changes the credentials of the client, as with the
+// package-level AssumeRoleWithWebIdentity
+func (c *Client) AssumeRoleWithWebIdentity(roleArn string, token stscreds.TokenFetcher) error {
+	return c.AssumeRoleWithOptions(roleArn, AssumeRoleOptions{WebIdentityToken: token})
+}
+
+// AssumeRoleWithOptions performs the same function as AssumeRole, with the
+// optional settings for the role session given in options. The credentials
+// are refreshed automatically before they expire.
+//
+// When options has an MFA token or token provider, the role is assumed with
+// the MFA serial and token. MFA tokens can only be used once, so refreshing
+// the credentials asks the token provider for another. A blank MFA serial
+// will be auto-detected
+func AssumeRoleWithOptions(roleArn string, options AssumeRoleOptions) error {
+	return defaultClient.AssumeRoleWithOptions(roleArn, options)
+}
+
+// AssumeRoleWithOptions changes the credentials of the client, as with the
+// package-level AssumeRoleWithOptions
+func (c *Client) AssumeRoleWithOptions(roleArn string, options AssumeRoleOptions) error {
+	if options.WebIdentityToken != nil {
+		return c.assumeRoleWithWebIdentity(roleArn, options)
+	}
+	provider, err := c.assumeRoleProvider(roleArn, options)
+	if err != nil {
+		return err
+	}
+	if options.MFAToken == "" && options.MFATokenProvider == nil {
+		return c.setupCredentials(credentials.NewCredentials(provider))
+	}
+
+	provider.SerialNumber = aws.String(options.MFASerial)
+	if options.MFASerial == "" {
+		mfaSerial, err := c.getMFASerial()
 		if err != nil {
 			return err
 		}
+		provider.SerialNumber = aws.String(mfaSerial)
 	}
-	roleSessionName, err := getRoleSessionName()
-	if err != nil {
-		return err
+	if options.Duration == 0 {
+		provider.Duration = mfaRoleDuration
 	}
-	assumeOut, err := stsClient.AssumeRole(&sts.AssumeRoleInput{
-		DurationSeconds: aws.Int64(3600),
-		RoleSessionName: aws.String(roleSessionName),
-		RoleArn:         aws.String(roleArn),
-		SerialNumber:    aws.String(mfaSerial),
-		TokenCode:       aws.String(mfaToken),
-	})
-	if err != nil {
-		return err
+	provider.TokenProvider = mfaTokenProvider(roleArn, options)
+	if options.CacheMFASession {
+		return c.setupCredentials(credentials.NewCredentials(newCachedRoleProvider(provider)))
 	}
-	session, err := setupRoleSession(assumeOut)
-	if err != nil {
+	return c.setupCredentials(credentials.NewCredentials(provider))
+}
+
+// mfaTokenProvider gives the MFA token from options the first time that one is
+// needed, and asks the token provider after that
+func mfaTokenProvider(roleArn string, options AssumeRoleOptions) func() (string, error) {
+	token := options.MFAToken
+	return func() (string, error) {
+		if token != "" {
+			t := token
+			token = ""
+			return t, nil
+		}
+		if options.MFATokenProvider == nil {
+			return "", fmt.Errorf("An MFA token is needed to refresh the credentials of role %s", roleArn)
+		}
+		return options.MFATokenProvider()
+	}
+}
+
+func (c *Client) assumeRoleProvider(roleArn string, options AssumeRoleOptions) (*stscreds.AssumeRoleProvider, error) {
+	provider := &stscreds.AssumeRoleProvider{
+		Client:       c.sts(),
+		Duration:     15 * time.Minute,
+		ExpiryWindow: credentialsExpiryWindow,
+		RoleARN:      roleArn,
+	}
+
+	if options.Duration != 0 {
+		provider.Duration = options.Duration
+	}
+
+	provider.RoleSessionName = options.RoleSessionName
+	if provider.RoleSessionName == "" {
+		roleSessionName, err := c.getRoleSessionName()
+		if err != nil {
+			return nil, err
+		}
+		provider.RoleSessionName = roleSessionName
+	}
+
+	if options.ExternalID != "" {
+		provider.ExternalID = aws.String(options.ExternalID)
+	}
+	if options.SourceIdentity != "" {
+		provider.SourceIdentity = aws.String(options.SourceIdentity)
+	}
+
+	// Sort the tags, so that requests are consistent between runs
+	tagKeys := make([]string, 0, len(options.Tags))
+	for k := range options.Tags {
+		tagKeys = append(tagKeys, k)
+	}
+	sort.Strings(tagKeys)
+	for _, k := range tagKeys {
+		provider.Tags = append(provider.Tags, &sts.Tag{Key: aws.String(k), Value: aws.String(options.Tags[k])})
+	}
+	for _, k := range options.TransitiveTagKeys {
+		if _, ok := options.Tags[k]; !ok {
+			return nil, fmt.Errorf("Transitive tag key \"%s\" is not one of the session tags", k)
+		}
+		provider.TransitiveTagKeys = append(provider.TransitiveTagKeys, aws.String(k))
+	}
+
+	return provider, nil
+}
+
+// setupCredentials switches the clients to the given credentials. The first
+// credentials are fetched straight away, so that a role which can't be assumed
+// fails here rather than on the first request made with them
+func (c *Client) setupCredentials(creds *credentials.Credentials) error {
+	if _, err := creds.Get(); err != nil {
 		return err
 	}
-	setupClients(session)
+	c.setupClients(c.original().Copy(&aws.Config{Credentials: creds}))
 	return nil
 }
 
-func setupRoleSession(assumeRoleOutput *sts.AssumeRoleOutput) (*session.Session, error) {
-	session, err := session.NewSessionWithOptions(session.Options{
-		Config: aws.Config{
-			Credentials: credentials.NewStaticCredentials(
-				*assumeRoleOutput.Credentials.AccessKeyId,
-				*assumeRoleOutput.Credentials.SecretAccessKey,
-				*assumeRoleOutput.Credentials.SessionToken,
-			),
+func (c *Client) assumeRoleWithWebIdentity(roleArn string, options AssumeRoleOptions) error {
+	if options.ExternalID != "" || options.MFAToken != "" || options.SourceIdentity != "" ||
+		len(options.Tags) > 0 || len(options.TransitiveTagKeys) > 0 {
+		return fmt.Errorf("External ID, MFA, source identity and session tags can't be used with a web identity token")
+	}
+	roleSessionName := options.RoleSessionName
+	if roleSessionName == "" {
+		roleSessionName = fmt.Sprintf("forge-%d", time.Now().Unix())
+	}
+	provider := stscreds.NewWebIdentityRoleProviderWithOptions(
+		c.sts(),
+		roleArn,
+		roleSessionName,
+		options.WebIdentityToken,
+		func(p *stscreds.WebIdentityRoleProvider) {
+			p.Duration = options.Duration
+			p.ExpiryWindow = credentialsExpiryWindow
 		},
-		SharedConfigState: session.SharedConfigEnable,
-	})
-	if err != nil {
-		return nil, err
+	)
+	return c.setupCredentials(credentials.NewCredentials(provider))
+}
+
+// AssumeRoleChain will change your credentials for Forge to those of the last
+// role in roleArns, assuming each role with the credentials of the role before
+// it. The chain always starts from the original credentials. The credentials
+// of every role are refreshed automatically before they expire.
+//
+// MFA, session tags, the source identity and the web identity token are only
+// given for the first role, as the role sessions which follow it inherit the
+// transitive tags and source identity. The other options are given for every
+// role, except for the external ID when using a web identity token
+func AssumeRoleChain(roleArns []string, options AssumeRoleOptions) error {
+	return defaultClient.AssumeRoleChain(roleArns, options)
+}
+
+// AssumeRoleChain changes the credentials of the client, as with the
+// package-level AssumeRoleChain
+func (c *Client) AssumeRoleChain(roleArns []string, options AssumeRoleOptions) error {
+	c.UnassumeAllRoles()
+	for i, r := range roleArns {
+		hopOptions := options
+		if i == 0 && options.WebIdentityToken != nil {
+			hopOptions.ExternalID = ""
+		}
+		if i > 0 {
+			hopOptions.WebIdentityToken = nil
+			hopOptions.MFASerial = ""
+			hopOptions.MFAToken = ""
+			hopOptions.MFATokenProvider = nil
+			hopOptions.SourceIdentity = ""
+			hopOptions.Tags = nil
+			hopOptions.TransitiveTagKeys = nil
+		}
+		if err := c.AssumeRoleWithOptions(r, hopOptions); err != nil {
+			if len(roleArns) > 1 {
+				return fmt.Errorf("Unable to assume role %s (step %d of %d): %s", r, i+1, len(roleArns), err)
+			}
+			return err
+		}
 	}
-	return session, nil
+	return nil
 }
 
 // UnassumeAllRoles will change your credentials back to their original state
 // after using AssumeRole
 func UnassumeAllRoles() {
-	setupClients(originalSession)
+	defaultClient.UnassumeAllRoles()
+}
+
+// UnassumeAllRoles changes the credentials of the client back to their
+// original state
+func (c *Client) UnassumeAllRoles() {
+	c.setupClients(c.original())
 }
 
-func getMFASerial() (string, error) {
-	mfaInfo, err := iamClient.ListMFADevices(&iam.ListMFADevicesInput{})
+func (c *Client) getMFASerial() (string, error) {
+	mfaInfo, err := c.iam().ListMFADevices(&iam.ListMFADevicesInput{})
 	if err != nil {
 		if awsErr, ok := err.(awserr.Error); ok {
 			if awsErr.Code() == "AccessDenied" {
@@ -158,8 +317,8 @@ func getMFASerial() (string, error) {
 	return "", fmt.Errorf("MFA device not found for the current user")
 }
 
-func getRoleSessionName() (string, error) {
-	callerIdentity, err := stsClient.GetCallerIdentity(&sts.GetCallerIdentityInput{})
+func (c *Client) getRoleSessionName() (string, error) {
+	callerIdentity, err := c.sts().GetCallerIdentity(&sts.GetCallerIdentityInput{})
 	if err != nil {
 		return "", err
 	}
@@ -1,17 +1,33 @@
 package forgelib
 
-import "testing"
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+)
 
 func TestGetMFASerial(t *testing.T) {
 	expectedSerial := "arn:aws:iam::111111111111:mfa/nathan"
 
-	oldIAMClient := iamClient
-	defer func() { iamClient = oldIAMClient }()
-	iamClient = mockIAM{
+	oldIAMClient := defaultClient.iamClient
+	defer func() { defaultClient.iamClient = oldIAMClient }()
+	defaultClient.iamClient = mockIAM{
 		mfaSerial: expectedSerial,
 	}
 
-	mfaSerial, err := getMFASerial()
+	mfaSerial, err := defaultClient.getMFASerial()
 	if err != nil {
 		t.Fatalf("unexpected error, %v", err)
 	}
@@ -22,15 +38,15 @@ func TestGetMFASerial(t *testing.T) {
 }
 
 func TestGetRoleSessionName(t *testing.T) {
-	oldSTSClient := stsClient
-	defer func() { stsClient = oldSTSClient }()
-	stsClient = mockSTS{
+	oldSTSClient := defaultClient.stsClient
+	defer func() { defaultClient.stsClient = oldSTSClient }()
+	defaultClient.stsClient = mockSTS{
 		callerArn: "arn:aws:iam::111111111111:user/nathan",
 		accountID: "111111111111",
 	}
 	expectedName := "nathan"
 
-	roleSessionName, err := getRoleSessionName()
+	roleSessionName, err := defaultClient.getRoleSessionName()
 	if err != nil {
 		t.Fatalf("unexpected error, %v", err)
 	}
@@ -41,66 +57,573 @@ func TestGetRoleSessionName(t *testing.T) {
 }
 
 func TestAssumeRole(t *testing.T) {
-	oldSTSClient := stsClient
-	defer func() { stsClient = oldSTSClient }()
-	stsClient = mockSTS{
+	oldSTSClient := defaultClient.stsClient
+	defer func() { defaultClient.stsClient = oldSTSClient }()
+	defaultClient.stsClient = mockSTS{
 		callerArn: "arn:aws:iam::111111111111:user/nathan",
 		accountID: "111111111111",
 	}
 
-	preassumeCfnClient := cfnClient
-	preassumeSTSClient := stsClient
+	preassumeCfnClient := defaultClient.cfnClient
+	preassumeSTSClient := defaultClient.stsClient
 
 	if err := AssumeRole("arn:aws:iam::111111111111:role/test-role"); err != nil {
 		t.Fatalf("unexpected error, %v", err)
 	}
 
-	if cfnClient == preassumeCfnClient {
-		t.Error("expected cfnClient to have changed, no change detected")
+	if defaultClient.cfnClient == preassumeCfnClient {
+		t.Error("expected defaultClient.cfnClient to have changed, no change detected")
 	}
-	if stsClient == preassumeSTSClient {
-		t.Error("expected stsClient to have changed, no change detected")
+	if defaultClient.stsClient == preassumeSTSClient {
+		t.Error("expected defaultClient.stsClient to have changed, no change detected")
 	}
 
 	// Cleanup
-	cfnClient = preassumeCfnClient
-	stsClient = preassumeSTSClient
+	defaultClient.cfnClient = preassumeCfnClient
+	defaultClient.stsClient = preassumeSTSClient
+}
+
+// mockSTSClients replaces the creation of STS clients with mocks based on
+// base, which know the access key of the credentials they were created with
+func mockSTSClients(t *testing.T, base mockSTS) func(*session.Session, ...*aws.Config) stsiface.STSAPI {
+	return func(sess *session.Session, cfg ...*aws.Config) stsiface.STSAPI {
+		creds, err := sess.Config.Credentials.Get()
+		if err != nil {
+			t.Fatalf("unexpected error, %v", err)
+		}
+		m := base
+		m.callerAccessKey = creds.AccessKeyID
+		return m
+	}
 }
 
 func TestAssumeRoleWithMFA(t *testing.T) {
-	oldSTSClient := stsClient
-	defer func() { stsClient = oldSTSClient }()
-	stsClient = mockSTS{
+	oldSTSClient := defaultClient.stsClient
+	defer func() { defaultClient.stsClient = oldSTSClient }()
+	defaultClient.stsClient = mockSTS{
 		callerArn: "arn:aws:iam::111111111111:user/nathan",
 		accountID: "111111111111",
 	}
+	oldSTSClientFactory := defaultClient.stsClientFactory
+	defer func() { defaultClient.stsClientFactory = oldSTSClientFactory }()
+	defaultClient.stsClientFactory = mockSTSClients(t, defaultClient.stsClient.(mockSTS))
 
-	oldIAMClient := iamClient
-	defer func() { iamClient = oldIAMClient }()
-	iamClient = mockIAM{
+	oldIAMClient := defaultClient.iamClient
+	defer func() { defaultClient.iamClient = oldIAMClient }()
+	defaultClient.iamClient = mockIAM{
 		mfaSerial: "arn:aws:iam::111111111111:mfa/nathan",
 	}
 
-	preassumeCfnClient := cfnClient
-	preassumeIAMClient := iamClient
-	preassumeSTSClient := stsClient
+	preassumeCfnClient := defaultClient.cfnClient
+	preassumeIAMClient := defaultClient.iamClient
+	preassumeSTSClient := defaultClient.stsClient
 
 	if err := AssumeRoleWithMFA("arn:aws:iam::111111111111:role/test-role", "123456", ""); err != nil {
 		t.Fatalf("unexpected error, %v", err)
 	}
 
-	if cfnClient == preassumeCfnClient {
-		t.Error("expected cfnClient to have changed, no change detected")
+	if defaultClient.cfnClient == preassumeCfnClient {
+		t.Error("expected defaultClient.cfnClient to have changed, no change detected")
 	}
-	if iamClient == preassumeIAMClient {
-		t.Error("expected iamClient to have changed, no change detected")
+	if defaultClient.iamClient == preassumeIAMClient {
+		t.Error("expected defaultClient.iamClient to have changed, no change detected")
 	}
-	if stsClient == preassumeSTSClient {
-		t.Error("expected stsClient to have changed, no change detected")
+	if defaultClient.stsClient == preassumeSTSClient {
+		t.Error("expected defaultClient.stsClient to have changed, no change detected")
 	}
 
 	// Cleanup
-	cfnClient = preassumeCfnClient
-	iamClient = preassumeIAMClient
-	stsClient = preassumeSTSClient
+	defaultClient.cfnClient = preassumeCfnClient
+	defaultClient.iamClient = preassumeIAMClient
+	defaultClient.stsClient = preassumeSTSClient
+}
+
+func TestClientsForRegion(t *testing.T) {
+	euClients := defaultClient.clientsForRegion("eu-west-1")
+	if euClients != defaultClient.clientsForRegion("eu-west-1") {
+		t.Error("expected clients for the same region to be reused")
+	}
+	if euClients == defaultClient.clientsForRegion("us-east-1") {
+		t.Error("expected clients for different regions to differ")
+	}
+	if e, g := "eu-west-1", *euClients.cfn.(*cloudformation.CloudFormation).Config.Region; e != g {
+		t.Errorf("expected region \"%s\", got \"%s\"", e, g)
+	}
+
+	// Changing the session (such as when assuming a role) replaces the
+	// regional clients
+	oldCFNClient, oldIAMClient, oldS3Client, oldSTSClient := defaultClient.cfnClient, defaultClient.iamClient, defaultClient.s3Client, defaultClient.stsClient
+	defer func() {
+		defaultClient.cfnClient, defaultClient.iamClient, defaultClient.s3Client, defaultClient.stsClient = oldCFNClient, oldIAMClient, oldS3Client, oldSTSClient
+	}()
+	defaultClient.setupClients(defaultClient.session, defaultClient.configs...)
+	if euClients == defaultClient.clientsForRegion("eu-west-1") {
+		t.Error("expected clients to be replaced after the session changed")
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	configDir, err := ioutil.TempDir("", "forge")
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	defer os.RemoveAll(configDir)
+	configFile := filepath.Join(configDir, "config")
+	configBody := "[default]\nregion = us-east-1\n[profile test]\nregion = ap-south-1\n"
+	if err := ioutil.WriteFile(configFile, []byte(configBody), 0600); err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	t.Setenv("AWS_CONFIG_FILE", configFile)
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(configDir, "credentials"))
+	for _, e := range []string{"AWS_DEFAULT_REGION", "AWS_PROFILE", "AWS_REGION"} {
+		t.Setenv(e, "")
+	}
+
+	oldOriginalSession := defaultClient.originalSession
+	oldCFNClient, oldIAMClient, oldS3Client, oldSTSClient := defaultClient.cfnClient, defaultClient.iamClient, defaultClient.s3Client, defaultClient.stsClient
+	defer func() {
+		defaultClient.originalSession = oldOriginalSession
+		defaultClient.cfnClient, defaultClient.iamClient, defaultClient.s3Client, defaultClient.stsClient = oldCFNClient, oldIAMClient, oldS3Client, oldSTSClient
+	}()
+
+	cases := []struct {
+		profile      string
+		region       string
+		expectRegion string
+	}{
+		{expectRegion: "us-east-1"},
+		{region: "eu-west-1", expectRegion: "eu-west-1"},
+		{profile: "test", expectRegion: "ap-south-1"},
+		{profile: "test", region: "eu-west-1", expectRegion: "eu-west-1"},
+	}
+
+	for i, c := range cases {
+		if err := Configure(c.profile, c.region); err != nil {
+			t.Fatalf("%d, unexpected error, %v", i, err)
+		}
+		if e, g := c.expectRegion, *defaultClient.cfnClient.(*cloudformation.CloudFormation).Config.Region; e != g {
+			t.Errorf("%d, expected region \"%s\", got \"%s\"", i, e, g)
+		}
+	}
+}
+
+func TestAssumeRoleChain(t *testing.T) {
+	cases := []struct {
+		roleArns          []string
+		mfaToken          string
+		expectAssumeRoles []assumedRole
+	}{
+		{
+			roleArns: []string{
+				"arn:aws:iam::111111111111:role/identity",
+				"arn:aws:iam::222222222222:role/deployment",
+				"arn:aws:iam::333333333333:role/target",
+			},
+			mfaToken: "123456",
+			expectAssumeRoles: []assumedRole{
+				// The first role is assumed with MFA
+				{
+					callerAccessKey: "ORIGINAL",
+					roleArn:         "arn:aws:iam::111111111111:role/identity",
+					serialNumber:    "arn:aws:iam::111111111111:mfa/nathan",
+				},
+				{
+					callerAccessKey: "arn:aws:iam::111111111111:role/identity",
+					roleArn:         "arn:aws:iam::222222222222:role/deployment",
+				},
+				{
+					callerAccessKey: "arn:aws:iam::222222222222:role/deployment",
+					roleArn:         "arn:aws:iam::333333333333:role/target",
+				},
+			},
+		},
+		{
+			roleArns: []string{
+				"arn:aws:iam::222222222222:role/deployment",
+				"arn:aws:iam::333333333333:role/target",
+			},
+			expectAssumeRoles: []assumedRole{
+				{
+					callerAccessKey: "ORIGINAL",
+					roleArn:         "arn:aws:iam::222222222222:role/deployment",
+				},
+				{
+					callerAccessKey: "arn:aws:iam::222222222222:role/deployment",
+					roleArn:         "arn:aws:iam::333333333333:role/target",
+				},
+			},
+		},
+	}
+
+	oldOriginalSession := defaultClient.originalSession
+	oldCFNClient, oldIAMClient, oldS3Client, oldSTSClient := defaultClient.cfnClient, defaultClient.iamClient, defaultClient.s3Client, defaultClient.stsClient
+	oldSTSClientFactory := defaultClient.stsClientFactory
+	defer func() {
+		defaultClient.originalSession = oldOriginalSession
+		defaultClient.cfnClient, defaultClient.iamClient, defaultClient.s3Client, defaultClient.stsClient = oldCFNClient, oldIAMClient, oldS3Client, oldSTSClient
+		defaultClient.stsClientFactory = oldSTSClientFactory
+	}()
+
+	defaultClient.originalSession = session.Must(session.NewSession(&aws.Config{
+		Credentials: credentials.NewStaticCredentials("ORIGINAL", "SECRET", ""),
+		Region:      aws.String("us-east-1"),
+	}))
+
+	for i, c := range cases {
+		var theseAssumedRoles []assumedRole
+		defaultClient.stsClientFactory = mockSTSClients(t, mockSTS{
+			accountID:    "111111111111",
+			assumedRoles: &theseAssumedRoles,
+			callerArn:    "arn:aws:iam::111111111111:user/nathan",
+		})
+
+		// Run the chain twice, as rotating credentials does, to make sure that
+		// the chain starts again from the original credentials
+		for j := 0; j < 2; j++ {
+			err := AssumeRoleChain(c.roleArns, AssumeRoleOptions{
+				MFASerial: "arn:aws:iam::111111111111:mfa/nathan",
+				MFAToken:  c.mfaToken,
+			})
+			if err != nil {
+				t.Fatalf("%d, unexpected error, %v", i, err)
+			}
+		}
+
+		expectAssumedRoles := append(c.expectAssumeRoles, c.expectAssumeRoles...)
+		if e, g := expectAssumedRoles, theseAssumedRoles; !reflect.DeepEqual(e, g) {
+			t.Errorf("%d, expected %+v, got %+v", i, e, g)
+		}
+	}
+}
+
+func TestAssumeRoleWithOptions(t *testing.T) {
+	roleArn := "arn:aws:iam::222222222222:role/test-role"
+	cases := []struct {
+		options       AssumeRoleOptions
+		expectInput   sts.AssumeRoleInput
+		expectFailure bool
+	}{
+		// Defaults
+		{
+			expectInput: sts.AssumeRoleInput{
+				DurationSeconds: aws.Int64(900),
+				RoleArn:         aws.String(roleArn),
+				RoleSessionName: aws.String("nathan"),
+			},
+		},
+		// MFA with an auto-detected serial, which lasts an hour by default
+		{
+			options: AssumeRoleOptions{MFAToken: "123456"},
+			expectInput: sts.AssumeRoleInput{
+				DurationSeconds: aws.Int64(3600),
+				RoleArn:         aws.String(roleArn),
+				RoleSessionName: aws.String("nathan"),
+				SerialNumber:    aws.String("arn:aws:iam::111111111111:mfa/nathan"),
+				TokenCode:       aws.String("123456"),
+			},
+		},
+		// Every option
+		{
+			options: AssumeRoleOptions{
+				Duration:        2 * time.Hour,
+				ExternalID:      "vendor-external-id",
+				MFASerial:       "arn:aws:iam::111111111111:mfa/other",
+				MFAToken:        "654321",
+				RoleSessionName: "pipeline-1234",
+				SourceIdentity:  "nathan@example.com",
+				Tags: map[string]string{
+					"Project":  "forge",
+					"Pipeline": "1234",
+				},
+				TransitiveTagKeys: []string{"Project"},
+			},
+			expectInput: sts.AssumeRoleInput{
+				DurationSeconds: aws.Int64(7200),
+				ExternalId:      aws.String("vendor-external-id"),
+				RoleArn:         aws.String(roleArn),
+				RoleSessionName: aws.String("pipeline-1234"),
+				SerialNumber:    aws.String("arn:aws:iam::111111111111:mfa/other"),
+				SourceIdentity:  aws.String("nathan@example.com"),
+				Tags: []*sts.Tag{
+					{Key: aws.String("Pipeline"), Value: aws.String("1234")},
+					{Key: aws.String("Project"), Value: aws.String("forge")},
+				},
+				TokenCode:         aws.String("654321"),
+				TransitiveTagKeys: aws.StringSlice([]string{"Project"}),
+			},
+		},
+		// Transitive tag keys must be session tags
+		{
+			options: AssumeRoleOptions{
+				Tags:              map[string]string{"Project": "forge"},
+				TransitiveTagKeys: []string{"Team"},
+			},
+			expectFailure: true,
+		},
+	}
+
+	oldCFNClient, oldIAMClient, oldS3Client, oldSTSClient := defaultClient.cfnClient, defaultClient.iamClient, defaultClient.s3Client, defaultClient.stsClient
+	oldSTSClientFactory := defaultClient.stsClientFactory
+	defer func() {
+		defaultClient.cfnClient, defaultClient.iamClient, defaultClient.s3Client, defaultClient.stsClient = oldCFNClient, oldIAMClient, oldS3Client, oldSTSClient
+		defaultClient.stsClientFactory = oldSTSClientFactory
+	}()
+
+	for i, c := range cases {
+		var theseInputs []sts.AssumeRoleInput
+		thisSTSClient := mockSTS{
+			accountID:        "111111111111",
+			assumeRoleInputs: &theseInputs,
+			callerArn:        "arn:aws:iam::111111111111:user/nathan",
+		}
+		defaultClient.stsClient = thisSTSClient
+		defaultClient.stsClientFactory = mockSTSClients(t, thisSTSClient)
+		defaultClient.iamClient = mockIAM{mfaSerial: "arn:aws:iam::111111111111:mfa/nathan"}
+
+		err := AssumeRoleWithOptions(roleArn, c.options)
+		if err != nil {
+			if !c.expectFailure {
+				t.Fatalf("%d, unexpected error, %v", i, err)
+			}
+			continue
+		}
+		if c.expectFailure {
+			t.Errorf("%d, expected error, got success", i)
+		}
+
+		if e, g := []sts.AssumeRoleInput{c.expectInput}, theseInputs; !reflect.DeepEqual(e, g) {
+			t.Errorf("%d, expected %v, got %v", i, e, g)
+		}
+	}
+}
+
+func TestAssumeRoleRefresh(t *testing.T) {
+	oldCFNClient, oldIAMClient, oldS3Client, oldSTSClient := defaultClient.cfnClient, defaultClient.iamClient, defaultClient.s3Client, defaultClient.stsClient
+	oldSTSClientFactory := defaultClient.stsClientFactory
+	defer func() {
+		defaultClient.cfnClient, defaultClient.iamClient, defaultClient.s3Client, defaultClient.stsClient = oldCFNClient, oldIAMClient, oldS3Client, oldSTSClient
+		defaultClient.stsClientFactory = oldSTSClientFactory
+	}()
+
+	var inputs []sts.AssumeRoleInput
+	thisSTSClient := mockSTS{
+		accountID:        "111111111111",
+		assumeRoleInputs: &inputs,
+		callerArn:        "arn:aws:iam::111111111111:user/nathan",
+		// Credentials which expire inside of the expiry window are
+		// refreshed each time they are used
+		credentialsExpiry: time.Minute,
+	}
+	defaultClient.stsClient = thisSTSClient
+	defaultClient.stsClientFactory = mockSTSClients(t, thisSTSClient)
+
+	var providedTokens []string
+	err := AssumeRoleWithOptions("arn:aws:iam::222222222222:role/test-role", AssumeRoleOptions{
+		MFASerial: "arn:aws:iam::111111111111:mfa/nathan",
+		MFAToken:  "123456",
+		MFATokenProvider: func() (string, error) {
+			token := fmt.Sprintf("%06d", len(providedTokens))
+			providedTokens = append(providedTokens, token)
+			return token, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	assumedBefore := len(inputs)
+	for i := 0; i < 2; i++ {
+		if _, err := defaultClient.cfnClient.(*cloudformation.CloudFormation).Config.Credentials.Get(); err != nil {
+			t.Fatalf("unexpected error, %v", err)
+		}
+	}
+
+	// The role is assumed again each time, with a new MFA token from the
+	// provider, as tokens can only be used once
+	if e, g := assumedBefore+2, len(inputs); e != g {
+		t.Errorf("expected role to be assumed %d times, got %d", e, g)
+	}
+	var gotTokens []string
+	for _, input := range inputs {
+		gotTokens = append(gotTokens, aws.StringValue(input.TokenCode))
+	}
+	if e, g := append([]string{"123456"}, providedTokens...), gotTokens; !reflect.DeepEqual(e, g) {
+		t.Errorf("expected role to be assumed with tokens %v, got %v", e, g)
+	}
+
+	// Without a token provider, the credentials can't be refreshed
+	defaultClient.stsClientFactory = func(*session.Session, ...*aws.Config) stsiface.STSAPI { return thisSTSClient }
+	err = AssumeRoleWithOptions("arn:aws:iam::222222222222:role/test-role", AssumeRoleOptions{
+		MFASerial: "arn:aws:iam::111111111111:mfa/nathan",
+		MFAToken:  "123456",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	if _, err := defaultClient.cfnClient.(*cloudformation.CloudFormation).Config.Credentials.Get(); err == nil {
+		t.Errorf("expected error refreshing without a token provider, got success")
+	}
+}
+
+func TestAssumeRoleChainOptions(t *testing.T) {
+	oldOriginalSession := defaultClient.originalSession
+	oldCFNClient, oldIAMClient, oldS3Client, oldSTSClient := defaultClient.cfnClient, defaultClient.iamClient, defaultClient.s3Client, defaultClient.stsClient
+	oldSTSClientFactory := defaultClient.stsClientFactory
+	defer func() {
+		defaultClient.originalSession = oldOriginalSession
+		defaultClient.cfnClient, defaultClient.iamClient, defaultClient.s3Client, defaultClient.stsClient = oldCFNClient, oldIAMClient, oldS3Client, oldSTSClient
+		defaultClient.stsClientFactory = oldSTSClientFactory
+	}()
+
+	defaultClient.originalSession = session.Must(session.NewSession(&aws.Config{
+		Credentials: credentials.NewStaticCredentials("ORIGINAL", "SECRET", ""),
+		Region:      aws.String("us-east-1"),
+	}))
+	var inputs []sts.AssumeRoleInput
+	defaultClient.stsClientFactory = mockSTSClients(t, mockSTS{
+		accountID:        "111111111111",
+		assumeRoleInputs: &inputs,
+		callerArn:        "arn:aws:iam::111111111111:user/nathan",
+	})
+
+	err := AssumeRoleChain(
+		[]string{"arn:aws:iam::222222222222:role/deployment", "arn:aws:iam::333333333333:role/target"},
+		AssumeRoleOptions{
+			ExternalID:        "vendor-external-id",
+			MFASerial:         "arn:aws:iam::111111111111:mfa/nathan",
+			MFAToken:          "123456",
+			RoleSessionName:   "pipeline-1234",
+			SourceIdentity:    "nathan@example.com",
+			Tags:              map[string]string{"Project": "forge"},
+			TransitiveTagKeys: []string{"Project"},
+		},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+
+	expectInputs := []sts.AssumeRoleInput{
+		{
+			DurationSeconds:   aws.Int64(3600),
+			ExternalId:        aws.String("vendor-external-id"),
+			RoleArn:           aws.String("arn:aws:iam::222222222222:role/deployment"),
+			RoleSessionName:   aws.String("pipeline-1234"),
+			SerialNumber:      aws.String("arn:aws:iam::111111111111:mfa/nathan"),
+			SourceIdentity:    aws.String("nathan@example.com"),
+			Tags:              []*sts.Tag{{Key: aws.String("Project"), Value: aws.String("forge")}},
+			TokenCode:         aws.String("123456"),
+			TransitiveTagKeys: aws.StringSlice([]string{"Project"}),
+		},
+		// Only the first role is given MFA, the tags and source identity
+		{
+			DurationSeconds: aws.Int64(900),
+			ExternalId:      aws.String("vendor-external-id"),
+			RoleArn:         aws.String("arn:aws:iam::333333333333:role/target"),
+			RoleSessionName: aws.String("pipeline-1234"),
+		},
+	}
+	if e, g := expectInputs, inputs; !reflect.DeepEqual(e, g) {
+		t.Errorf("expected %v, got %v", e, g)
+	}
+}
+
+func TestAssumeRoleWithWebIdentity(t *testing.T) {
+	tokenDir, err := ioutil.TempDir("", "forge")
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	defer os.RemoveAll(tokenDir)
+	tokenFile := filepath.Join(tokenDir, "token")
+	if err := ioutil.WriteFile(tokenFile, []byte("file-token-1"), 0600); err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	t.Setenv("FORGE_TEST_OIDC_TOKEN", "env-token-1")
+
+	oldCFNClient, oldIAMClient, oldS3Client, oldSTSClient := defaultClient.cfnClient, defaultClient.iamClient, defaultClient.s3Client, defaultClient.stsClient
+	defer func() {
+		defaultClient.cfnClient, defaultClient.iamClient, defaultClient.s3Client, defaultClient.stsClient = oldCFNClient, oldIAMClient, oldS3Client, oldSTSClient
+	}()
+
+	roleArn := "arn:aws:iam::111111111111:role/ci"
+	cases := []struct {
+		token         stscreds.TokenFetcher
+		options       AssumeRoleOptions
+		refresh       func()
+		expectTokens  []string
+		expectFailure bool
+	}{
+		// Token from a file, which is read again when the credentials expire
+		{
+			token: stscreds.FetchTokenPath(tokenFile),
+			refresh: func() {
+				if err := ioutil.WriteFile(tokenFile, []byte("file-token-2"), 0600); err != nil {
+					t.Fatalf("unexpected error, %v", err)
+				}
+			},
+			expectTokens: []string{"file-token-1", "file-token-2"},
+		},
+		// Token from an environment variable
+		{
+			token:        WebIdentityTokenFromEnv("FORGE_TEST_OIDC_TOKEN"),
+			refresh:      func() { os.Setenv("FORGE_TEST_OIDC_TOKEN", "env-token-2") },
+			expectTokens: []string{"env-token-1", "env-token-2"},
+		},
+		// Missing token
+		{
+			token:         WebIdentityTokenFromEnv("FORGE_TEST_MISSING_OIDC_TOKEN"),
+			expectFailure: true,
+		},
+		// Options which web identities don't support
+		{
+			token:         WebIdentityTokenFromEnv("FORGE_TEST_OIDC_TOKEN"),
+			options:       AssumeRoleOptions{ExternalID: "external-id"},
+			expectFailure: true,
+		},
+	}
+
+	for i, c := range cases {
+		var theseInputs []sts.AssumeRoleWithWebIdentityInput
+		defaultClient.stsClient = mockSTS{
+			// Credentials which expire inside of the expiry window are
+			// refreshed each time they are used
+			credentialsExpiry: time.Minute,
+			webIdentityInputs: &theseInputs,
+		}
+
+		options := c.options
+		options.WebIdentityToken = c.token
+		options.RoleSessionName = "pipeline-1234"
+		err := AssumeRoleWithOptions(roleArn, options)
+		if err != nil {
+			if !c.expectFailure {
+				t.Fatalf("%d, unexpected error, %v", i, err)
+			}
+			continue
+		}
+		if c.expectFailure {
+			t.Errorf("%d, expected error, got success", i)
+		}
+
+		c.refresh()
+		creds, err := defaultClient.cfnClient.(*cloudformation.CloudFormation).Config.Credentials.Get()
+		if err != nil {
+			t.Fatalf("%d, unexpected error, %v", i, err)
+		}
+		if e, g := "AKIAWEBIDENTITY2", creds.AccessKeyID; e != g {
+			t.Errorf("%d, expected access key \"%s\", got \"%s\"", i, e, g)
+		}
+
+		var tokens []string
+		for _, input := range theseInputs {
+			tokens = append(tokens, *input.WebIdentityToken)
+			if e, g := roleArn, *input.RoleArn; e != g {
+				t.Errorf("%d, expected role \"%s\", got \"%s\"", i, e, g)
+			}
+			if e, g := "pipeline-1234", *input.RoleSessionName; e != g {
+				t.Errorf("%d, expected session name \"%s\", got \"%s\"", i, e, g)
+			}
+		}
+		if e, g := c.expectTokens, tokens; !reflect.DeepEqual(e, g) {
+			t.Errorf("%d, expected tokens %v, got %v", i, e, g)
+		}
+	}
 }
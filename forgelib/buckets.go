@@ -0,0 +1,106 @@
+package forgelib
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// Maximum number of keys which S3 will accept in a single DeleteObjects call
+const s3DeleteBatchSize = 1000
+
+// EmptyBuckets will delete every object version and delete marker from the
+// S3 buckets belonging to the stack, so that CloudFormation is able to delete
+// them. Buckets with a deletion policy other than "Delete" are left untouched.
+// The names of the buckets which were emptied are returned
+func (s *Stack) EmptyBuckets() (emptied []string, err error) {
+	resources, err := s.ListResources()
+	if err != nil {
+		return emptied, err
+	}
+	for _, r := range resources {
+		if r.ResourceType != "AWS::S3::Bucket" || r.Retained() ||
+			r.PhysicalResourceID == "" ||
+			r.ResourceStatus == cloudformation.ResourceStatusDeleteComplete {
+			continue
+		}
+		if err := emptyBucket(s.s3(), r.PhysicalResourceID); err != nil {
+			if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == s3.ErrCodeNoSuchBucket {
+				continue
+			}
+			return emptied, fmt.Errorf("Unable to empty bucket %s: %s", r.PhysicalResourceID, err)
+		}
+		emptied = append(emptied, r.PhysicalResourceID)
+	}
+	return emptied, nil
+}
+
+func emptyBucket(client s3iface.S3API, bucket string) error {
+	var batch []*s3.ObjectIdentifier
+	var deleteErr error
+	flush := func() bool {
+		if len(batch) == 0 {
+			return true
+		}
+		deleteErr = deleteObjectBatch(client, bucket, batch)
+		batch = nil
+		return deleteErr == nil
+	}
+
+	err := client.ListObjectVersionsPages(
+		&s3.ListObjectVersionsInput{
+			Bucket: aws.String(bucket),
+		}, func(page *s3.ListObjectVersionsOutput, lastPage bool) bool {
+			for _, v := range page.Versions {
+				batch = append(batch, &s3.ObjectIdentifier{Key: v.Key, VersionId: v.VersionId})
+				if len(batch) == s3DeleteBatchSize && !flush() {
+					return false
+				}
+			}
+			for _, m := range page.DeleteMarkers {
+				batch = append(batch, &s3.ObjectIdentifier{Key: m.Key, VersionId: m.VersionId})
+				if len(batch) == s3DeleteBatchSize && !flush() {
+					return false
+				}
+			}
+			// Continue reading all pages
+			return true
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if deleteErr != nil {
+		return deleteErr
+	}
+	flush()
+	return deleteErr
+}
+
+func deleteObjectBatch(client s3iface.S3API, bucket string, objects []*s3.ObjectIdentifier) error {
+	deleteOut, err := client.DeleteObjects(&s3.DeleteObjectsInput{
+		Bucket: aws.String(bucket),
+		Delete: &s3.Delete{
+			Objects: objects,
+			Quiet:   aws.Bool(true),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if len(deleteOut.Errors) > 0 {
+		e := deleteOut.Errors[0]
+		return fmt.Errorf(
+			"Failed to delete %d object(s), including %s (%s): %s",
+			len(deleteOut.Errors),
+			aws.StringValue(e.Key),
+			aws.StringValue(e.Code),
+			aws.StringValue(e.Message),
+		)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package forgelib
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func genObjectVersions(count int, markers int) (output []s3.ObjectIdentifier) {
+	for i := 0; i < count; i++ {
+		output = append(output, s3.ObjectIdentifier{
+			Key:       aws.String(fmt.Sprintf("key-%d", i)),
+			VersionId: aws.String(fmt.Sprintf("version-%d", i)),
+		})
+	}
+	for i := 0; i < markers; i++ {
+		output = append(output, s3.ObjectIdentifier{
+			Key:       aws.String(fmt.Sprintf("key-%d", i)),
+			VersionId: aws.String("delete-marker"),
+		})
+	}
+	return output
+}
+
+func TestEmptyBuckets(t *testing.T) {
+	templateBody := `{"Resources":{
+		"Logs":{"Type":"AWS::S3::Bucket"},
+		"Archive":{"Type":"AWS::S3::Bucket","DeletionPolicy":"Retain"},
+		"Gone":{"Type":"AWS::S3::Bucket"},
+		"Topic":{"Type":"AWS::SNS::Topic"}
+	}}`
+	stackResources := []*cloudformation.StackResourceSummary{
+		{LogicalResourceId: aws.String("Logs"), PhysicalResourceId: aws.String("logs-bucket"), ResourceType: aws.String("AWS::S3::Bucket")},
+		{LogicalResourceId: aws.String("Archive"), PhysicalResourceId: aws.String("archive-bucket"), ResourceType: aws.String("AWS::S3::Bucket")},
+		{LogicalResourceId: aws.String("Gone"), PhysicalResourceId: aws.String("gone-bucket"), ResourceType: aws.String("AWS::S3::Bucket")},
+		{LogicalResourceId: aws.String("Topic"), PhysicalResourceId: aws.String("topic-arn"), ResourceType: aws.String("AWS::SNS::Topic")},
+	}
+	buckets := map[string][]s3.ObjectIdentifier{
+		"logs-bucket":    genObjectVersions(2300, 150),
+		"archive-bucket": genObjectVersions(10, 0),
+	}
+	var deleteCalls, largestBatch int
+
+	oldCFNClient := defaultClient.cfnClient
+	defer func() { defaultClient.cfnClient = oldCFNClient }()
+	oldS3Client := defaultClient.s3Client
+	defer func() { defaultClient.s3Client = oldS3Client }()
+	defaultClient.cfnClient = mockCfn{
+		templateBody:   templateBody,
+		stackResources: stackResources,
+	}
+	defaultClient.s3Client = mockS3{
+		buckets:      &buckets,
+		deleteCalls:  &deleteCalls,
+		largestBatch: &largestBatch,
+	}
+
+	s := Stack{StackID: "whatever"}
+	emptied, err := s.EmptyBuckets()
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+
+	if e, g := []string{"logs-bucket"}, emptied; !reflect.DeepEqual(e, g) {
+		t.Errorf("expected emptied buckets %v, got %v", e, g)
+	}
+	if g := len(buckets["logs-bucket"]); g != 0 {
+		t.Errorf("expected logs-bucket to be empty, found %d objects", g)
+	}
+	if e, g := 10, len(buckets["archive-bucket"]); e != g {
+		t.Errorf("expected retained archive-bucket to hold %d objects, found %d", e, g)
+	}
+	if e, g := 3, deleteCalls; e != g {
+		t.Errorf("expected %d delete calls, got %d", e, g)
+	}
+	if largestBatch > s3DeleteBatchSize {
+		t.Errorf("expected batches of at most %d objects, got %d", s3DeleteBatchSize, largestBatch)
+	}
+}
@@ -0,0 +1,298 @@
+package forgelib
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+)
+
+// Client holds the AWS clients which Forge makes requests with, along with the
+// credentials of any role which has been assumed. Stacks and StackSets use the
+// default client unless they're given one, so that a program can work with
+// several accounts or regions at once.
+//
+// The zero value is ready to use, and sets up a session from the environment on
+// first use. A Client must not be copied after first use
+type Client struct {
+	mutex sync.Mutex
+
+	originalSession *session.Session
+	// The session which the current clients were created from, with its
+	// configs, so that clients for other regions can be created to match
+	session *session.Session
+	configs []*aws.Config
+
+	cfnClient cloudformationiface.CloudFormationAPI // CloudFormation Service
+	iamClient iamiface.IAMAPI                       // IAM Service
+	s3Client  s3iface.S3API                         // S3 Service
+	stsClient stsiface.STSAPI                       // STS Service
+
+	// Stacks in a region other than the default one use clients built from
+	// the same session, which are kept until the session changes
+	regionalClients map[string]*regionalClientSet
+
+	// Shared by every stack which is followed with the client
+	polls *pollBudget
+
+	// Clients given in ClientOptions, which are used instead of those created
+	// from the session
+	options ClientOptions
+	// Creates the STS client for a session, which tests replace to follow the
+	// credentials that each STS client is created with
+	stsClientFactory func(*session.Session, ...*aws.Config) stsiface.STSAPI
+}
+
+// ClientOptions are the settings of a client created with
+// NewClientWithOptions. Any of the AWS clients which are given are used as they
+// are for the default region, in place of the ones Forge would create, and are
+// kept when a role is assumed
+type ClientOptions struct {
+	// The named profile in the shared config files, and the region requests
+	// are sent to. Blank values are taken from the environment as usual
+	Profile string
+	Region  string
+
+	CloudFormation cloudformationiface.CloudFormationAPI
+	IAM            iamiface.IAMAPI
+	S3             s3iface.S3API
+	STS            stsiface.STSAPI
+}
+
+type regionalClientSet struct {
+	cfn cloudformationiface.CloudFormationAPI
+	s3  s3iface.S3API
+}
+
+// The client used by the package-level functions, and by Stacks and StackSets
+// which aren't given a client
+var defaultClient = &Client{}
+
+// NewClient creates a client with credentials from the named profile in the
+// shared config files, which sends requests to the given region. Blank values
+// are taken from the environment as usual
+func NewClient(profile, region string) (*Client, error) {
+	return NewClientWithOptions(ClientOptions{Profile: profile, Region: region})
+}
+
+// NewClientWithOptions creates a client as with NewClient, which uses the AWS
+// clients given in options, such as ones wrapped to add logging or retries
+func NewClientWithOptions(options ClientOptions) (*Client, error) {
+	c := &Client{options: options}
+	if err := c.Configure(options.Profile, options.Region); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Configure sets up the AWS session used by Forge, taking credentials from the
+// named profile in the shared config files and sending requests to the given
+// region. Blank values are taken from the environment as usual. If Configure
+// isn't called, a session is set up from the environment on first use
+func Configure(profile, region string) error {
+	return defaultClient.Configure(profile, region)
+}
+
+// Configure sets up the session of the client, as with the package-level
+// Configure. Any role which has been assumed is dropped
+func (c *Client) Configure(profile, region string) error {
+	sess, err := newSession(profile, region)
+	if err != nil {
+		return err
+	}
+	c.mutex.Lock()
+	c.originalSession = sess
+	c.mutex.Unlock()
+	c.setupClients(sess)
+	return nil
+}
+
+func newSession(profile, region string) (*session.Session, error) {
+	options := session.Options{
+		Profile:                 profile,
+		SharedConfigState:       session.SharedConfigEnable,
+		AssumeRoleDuration:      time.Hour,
+		AssumeRoleTokenProvider: stscreds.StdinTokenProvider,
+	}
+	if region != "" {
+		options.Config.Region = aws.String(region)
+	}
+	return session.NewSessionWithOptions(options)
+}
+
+// ensure sets up the session from the environment if Configure hasn't been
+// called. Clients which have already been replaced are kept
+func (c *Client) ensure() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.originalSession != nil {
+		return
+	}
+	c.originalSession = session.Must(newSession("", ""))
+	if c.cfnClient == nil && c.iamClient == nil && c.s3Client == nil && c.stsClient == nil {
+		c.setClientsLocked(c.originalSession)
+		return
+	}
+	c.session = c.originalSession
+}
+
+// setupClients replaces all of the clients with ones created from the given
+// session
+func (c *Client) setupClients(sess *session.Session, cfg ...*aws.Config) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.setClientsLocked(sess, cfg...)
+}
+
+func (c *Client) setClientsLocked(sess *session.Session, cfg ...*aws.Config) {
+	c.session = sess
+	c.configs = cfg
+	c.regionalClients = map[string]*regionalClientSet{}
+
+	c.cfnClient = newCfnClient(sess, cfg...)
+
+	iamConfig := aws.Config{}
+	if endpoint, ok := os.LookupEnv("AWS_ENDPOINT_IAM"); ok {
+		iamConfig.Endpoint = aws.String(endpoint)
+	}
+	iamConfigs := append([]*aws.Config{generalConfig(), &iamConfig}, cfg...)
+	c.iamClient = iam.New(sess, iamConfigs...)
+
+	c.s3Client = newS3Client(sess, cfg...)
+
+	if c.stsClientFactory != nil {
+		c.stsClient = c.stsClientFactory(sess, cfg...)
+	} else {
+		c.stsClient = newSTSClient(sess, cfg...)
+	}
+
+	if c.options.CloudFormation != nil {
+		c.cfnClient = c.options.CloudFormation
+	}
+	if c.options.IAM != nil {
+		c.iamClient = c.options.IAM
+	}
+	if c.options.S3 != nil {
+		c.s3Client = c.options.S3
+	}
+	if c.options.STS != nil {
+		c.stsClient = c.options.STS
+	}
+}
+
+func generalConfig() *aws.Config {
+	return &aws.Config{
+		MaxRetries: aws.Int(10),
+	}
+}
+
+// Need to mess around with copying values and making pointers to them due
+// to the way in which the AWS Go SDK passes around data
+func newCfnClient(sess *session.Session, cfg ...*aws.Config) cloudformationiface.CloudFormationAPI {
+	cfnConfig := aws.Config{}
+	if endpoint, ok := os.LookupEnv("AWS_ENDPOINT_CLOUDFORMATION"); ok {
+		cfnConfig.Endpoint = aws.String(endpoint)
+	}
+	cfnConfigs := append([]*aws.Config{generalConfig(), &cfnConfig}, cfg...)
+	return cloudformation.New(sess, cfnConfigs...)
+}
+
+func newS3Client(sess *session.Session, cfg ...*aws.Config) s3iface.S3API {
+	s3Config := aws.Config{}
+	if endpoint, ok := os.LookupEnv("AWS_ENDPOINT_S3"); ok {
+		// Local S3 stand-ins generally don't support virtual-hosted buckets
+		s3Config.Endpoint = aws.String(endpoint)
+		s3Config.S3ForcePathStyle = aws.Bool(true)
+	}
+	s3Configs := append([]*aws.Config{generalConfig(), &s3Config}, cfg...)
+	return s3.New(sess, s3Configs...)
+}
+
+func newSTSClient(sess *session.Session, cfg ...*aws.Config) stsiface.STSAPI {
+	stsConfig := aws.Config{}
+	if endpoint, ok := os.LookupEnv("AWS_ENDPOINT_STS"); ok {
+		stsConfig.Endpoint = aws.String(endpoint)
+	}
+	stsConfigs := append([]*aws.Config{generalConfig(), &stsConfig}, cfg...)
+	return sts.New(sess, stsConfigs...)
+}
+
+func (c *Client) cfn() cloudformationiface.CloudFormationAPI {
+	c.ensure()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.cfnClient
+}
+
+func (c *Client) iam() iamiface.IAMAPI {
+	c.ensure()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.iamClient
+}
+
+func (c *Client) s3() s3iface.S3API {
+	c.ensure()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.s3Client
+}
+
+func (c *Client) sts() stsiface.STSAPI {
+	c.ensure()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.stsClient
+}
+
+// pollBudget returns the budget which polling requests through the client are
+// spaced out by
+func (c *Client) pollBudget() *pollBudget {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.polls == nil {
+		c.polls = newPollBudget(defaultPollRequestInterval)
+	}
+	return c.polls
+}
+
+// original returns the session which the client started with, before any role
+// was assumed
+func (c *Client) original() *session.Session {
+	c.ensure()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.originalSession
+}
+
+// clientsForRegion returns the regional clients for a region, creating them
+// from the current session on first use
+func (c *Client) clientsForRegion(region string) *regionalClientSet {
+	c.ensure()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if rc, ok := c.regionalClients[region]; ok {
+		return rc
+	}
+	cfg := append(append([]*aws.Config{}, c.configs...), &aws.Config{Region: aws.String(region)})
+	rc := &regionalClientSet{
+		cfn: newCfnClient(c.session, cfg...),
+		s3:  newS3Client(c.session, cfg...),
+	}
+	if c.regionalClients == nil {
+		c.regionalClients = map[string]*regionalClientSet{}
+	}
+	c.regionalClients[region] = rc
+	return rc
+}
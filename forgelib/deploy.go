@@ -1,24 +1,102 @@
 package forgelib
 
 import (
-	"fmt"
-
-	"github.com/ghodss/yaml"
+	"context"
+	"errors"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/ghodss/yaml"
+)
+
+// DeployOperation is the operation which Deploy performed on the stack
+type DeployOperation string
+
+// The operations which Deploy can perform
+const (
+	DeployCreate DeployOperation = "create"
+	DeployUpdate DeployOperation = "update"
+	// The stack already matched the template, parameters and tags
+	DeployNoOp DeployOperation = "no-op"
 )
 
+// The value which NoEcho parameters are replaced with in output
+const noEchoMask = "****"
+
 // DeployOut provides a controlled format for information to be passed out of
 // the Deploy function
 type DeployOut struct {
-	Message string
+	Capabilities []string
+	// Set by AddWaitResult, or straight away when there was nothing to update
+	Duration time.Duration `json:"-"`
+	// "No updates are to be performed." when there was nothing to update
+	Message   string `json:",omitempty"`
+	Operation DeployOperation
+	// Set by AddWaitResult, or straight away when there was nothing to update
+	Outputs map[string]string
+	// The values given for the template parameters, with NoEcho values masked
+	Parameters map[string]string
+	RoleARN    string `json:",omitempty"`
+	StackID    string
+	StackName  string
+	StartTime  time.Time
+	// Set by AddWaitResult, or straight away when there was nothing to update
+	Status string `json:",omitempty"`
+	Tags   map[string]string
+}
+
+// AddWaitResult completes the output with the final state of the stack, once
+// the deployment has been waited on with Wait
+func (o *DeployOut) AddWaitResult(s *Stack, result WaitResult) {
+	o.Duration = time.Since(o.StartTime)
+	o.Status = result.Status
+	if s.StackInfo != nil {
+		o.Outputs = stackOutputs(s.StackInfo.Outputs)
+	}
+}
+
+func stackOutputs(outputs []*cloudformation.Output) map[string]string {
+	outputMap := map[string]string{}
+	for _, o := range outputs {
+		outputMap[aws.StringValue(o.OutputKey)] = aws.StringValue(o.OutputValue)
+	}
+	return outputMap
+}
+
+// maskedParameters lists the values of the input parameters, replacing the
+// values of NoEcho parameters so that they can be shown. Parameters which keep
+// their previous value are listed with the value from the stack
+func maskedParameters(templateParameters []*cloudformation.TemplateParameter, inputParams []*cloudformation.Parameter, previous map[string]string) map[string]string {
+	noEcho := map[string]bool{}
+	for _, p := range templateParameters {
+		noEcho[aws.StringValue(p.ParameterKey)] = aws.BoolValue(p.NoEcho)
+	}
+	parameterMap := map[string]string{}
+	for _, p := range inputParams {
+		key := aws.StringValue(p.ParameterKey)
+		if noEcho[key] {
+			parameterMap[key] = noEchoMask
+		} else if aws.BoolValue(p.UsePreviousValue) {
+			parameterMap[key] = previous[key]
+		} else {
+			parameterMap[key] = aws.StringValue(p.ParameterValue)
+		}
+	}
+	return parameterMap
 }
 
 // Deploy will create or update the stack (depending on its current state)
-func (s *Stack) Deploy() (output DeployOut, err error) {
-	validationResult, err := cfnClient.ValidateTemplate(
+func (s *Stack) Deploy() (DeployOut, error) {
+	return s.DeployWithContext(context.Background())
+}
+
+// DeployWithContext performs the same function as Deploy, with a context to
+// cancel the requests. Cancelling the context doesn't cancel a stack operation
+// which has already started; use CancelUpdate for that
+func (s *Stack) DeployWithContext(ctx context.Context) (output DeployOut, err error) {
+	validationResult, err := s.cfn().ValidateTemplateWithContext(
+		ctx,
 		&cloudformation.ValidateTemplateInput{
 			TemplateBody: aws.String(s.TemplateBody),
 		},
@@ -27,78 +105,83 @@ func (s *Stack) Deploy() (output DeployOut, err error) {
 		return output, err
 	}
 
-	if err := s.GetStackInfo(); err != nil {
-		if awsErr, ok := err.(awserr.Error); ok {
-			switch awsErr.Message() {
-			case fmt.Sprintf("Stack with id %s does not exist", s.StackID),
-				fmt.Sprintf("Stack with id %s does not exist", s.StackName):
-			default:
-				return output, err
-			}
-		} else {
-			return output, err
-		}
+	if err := s.getStackInfoIfExists(ctx); err != nil {
+		return output, err
 	}
 
-	var tags []*cloudformation.Tag
-	if s.TagsBody != "" {
-		tags, err = parseTags(s.TagsBody)
-		if err != nil {
-			return output, err
-		}
-	} else if s.StackInfo != nil {
-		tags = s.StackInfo.Tags
+	tags, err := s.inputTags()
+	if err != nil {
+		return output, err
 	}
 
-	var inputParams []*cloudformation.Parameter
-	parsedParameters := []*cloudformation.Parameter{}
-	if len(s.ParameterBodies) != 0 {
-		parsedParameters, err = parseParameters(s.ParameterBodies)
+	inputParams, err := s.inputParameters(validationResult.Parameters)
+	if err != nil {
+		return output, err
+	}
+
+	settings, err := s.declaredSettings()
+	if err != nil {
+		return output, err
+	}
+
+	if !s.AllowProtectionReduction {
+		reductions, err := s.protectionReductions(ctx, settings)
 		if err != nil {
 			return output, err
 		}
+		if len(reductions) > 0 {
+			return output, errorProtectionReduction(reductions)
+		}
 	}
 
-TEMPLATE_PARAMETERS:
-	for i := 0; i < len((*validationResult).Parameters); i++ {
-		parameterKey := *(*validationResult).Parameters[i].ParameterKey
-		if v, ok := s.ParameterOverrides[parameterKey]; ok {
-			param := cloudformation.Parameter{
-				ParameterKey:   aws.String(parameterKey),
-				ParameterValue: aws.String(v),
-			}
-			inputParams = append(inputParams, &param)
-			continue TEMPLATE_PARAMETERS
-		}
-		for j := 0; j < len(parsedParameters); j++ {
-			if *parsedParameters[j].ParameterKey == parameterKey {
-				inputParams = append(inputParams, parsedParameters[j])
-				continue TEMPLATE_PARAMETERS
+	var roleARN *string
+	if r := settings.CfnRoleName; r != nil {
+		if *r != "" {
+			roleARNString, err := s.client().roleARNFromName(ctx, *r)
+			if err != nil {
+				return output, err
 			}
+			roleARN = &roleARNString
+		} else if s.StackInfo != nil && s.StackInfo.RoleARN != nil {
+			return output, ErrCfnRoleRemoval
 		}
 	}
 
-	var roleARN *string
-	if s.CfnRoleName != "" {
-		roleARNString, err := roleARNFromName(s.CfnRoleName)
-		if err != nil {
-			return output, err
-		}
-		roleARN = &roleARNString
+	var notificationARNs []*string
+	if n := settings.NotificationARNs; n != nil {
+		// An empty, non-nil list removes all notification ARNs from the stack
+		notificationARNs = append([]*string{}, aws.StringSlice(*n)...)
 	}
 
-	var inputStackPolicy *string
-	if s.StackPolicyBody != "" {
-		jsonStackPolicy, err := yaml.YAMLToJSON([]byte(s.StackPolicyBody))
+	var inputStackPolicyDuringUpdate *string
+	if s.StackPolicyDuringUpdateBody != "" {
+		jsonStackPolicy, err := yaml.YAMLToJSON([]byte(s.StackPolicyDuringUpdateBody))
 		if err != nil {
 			return output, err
 		}
-		jsonStackPolicyString := string(jsonStackPolicy)
-		inputStackPolicy = &jsonStackPolicyString
+		inputStackPolicyDuringUpdate = aws.String(string(jsonStackPolicy))
+	}
+
+	output = DeployOut{
+		Capabilities: aws.StringValueSlice(validationResult.Capabilities),
+		Parameters:   maskedParameters(validationResult.Parameters, inputParams, s.previousParameters()),
+		RoleARN:      aws.StringValue(roleARN),
+		StackName:    s.StackName,
+		StartTime:    time.Now(),
+		Tags:         map[string]string{},
+	}
+	for _, t := range tags {
+		output.Tags[aws.StringValue(t.Key)] = aws.StringValue(t.Value)
+	}
+	// Updates keep the role of the stack unless another is given
+	if roleARN == nil && s.StackInfo != nil {
+		output.RoleARN = aws.StringValue(s.StackInfo.RoleARN)
 	}
 
 	if s.StackInfo == nil {
-		createOut, err := cfnClient.CreateStack(
+		output.Operation = DeployCreate
+		createOut, err := s.cfn().CreateStackWithContext(
+			ctx,
 			&cloudformation.CreateStackInput{
 				StackName:                   aws.String(s.StackName),
 				TemplateBody:                aws.String(s.TemplateBody),
@@ -106,50 +189,140 @@ TEMPLATE_PARAMETERS:
 				Capabilities:                validationResult.Capabilities,
 				Tags:                        tags,
 				Parameters:                  inputParams,
+				NotificationARNs:            notificationARNs,
 				RoleARN:                     roleARN,
-				StackPolicyBody:             inputStackPolicy,
-				EnableTerminationProtection: aws.Bool(s.TerminationProtection),
+				StackPolicyBody:             settings.StackPolicyBody,
+				EnableTerminationProtection: aws.Bool(aws.BoolValue(settings.TerminationProtection)),
 			},
 		)
 		if err != nil {
-			return output, err
+			return output, ClassifyAWSError(err)
 		}
 		s.StackID = *createOut.StackId
 	} else {
-		// Only SET termination protection, do not remove
-		if s.StackInfo.EnableTerminationProtection != nil &&
-			!*s.StackInfo.EnableTerminationProtection &&
-			s.TerminationProtection {
-			_, err := cfnClient.UpdateTerminationProtection(
+		output.Operation = DeployUpdate
+		if t := settings.TerminationProtection; t != nil &&
+			*t != aws.BoolValue(s.StackInfo.EnableTerminationProtection) {
+			_, err := s.cfn().UpdateTerminationProtectionWithContext(
+				ctx,
 				&cloudformation.UpdateTerminationProtectionInput{
-					EnableTerminationProtection: aws.Bool(s.TerminationProtection),
+					EnableTerminationProtection: t,
 					StackName:                   aws.String(s.StackID),
 				},
 			)
 			if err != nil {
-				return output, err
+				return output, ClassifyAWSError(err)
 			}
 		}
-		_, err := cfnClient.UpdateStack(
+		_, err := s.cfn().UpdateStackWithContext(
+			ctx,
 			&cloudformation.UpdateStackInput{
-				StackName:       aws.String(s.StackID),
-				TemplateBody:    aws.String(s.TemplateBody),
-				Capabilities:    validationResult.Capabilities,
-				Tags:            tags,
-				Parameters:      inputParams,
-				RoleARN:         roleARN,
-				StackPolicyBody: inputStackPolicy,
+				StackName:                   aws.String(s.StackID),
+				TemplateBody:                aws.String(s.TemplateBody),
+				Capabilities:                validationResult.Capabilities,
+				Tags:                        tags,
+				Parameters:                  inputParams,
+				NotificationARNs:            notificationARNs,
+				RoleARN:                     roleARN,
+				StackPolicyBody:             settings.StackPolicyBody,
+				StackPolicyDuringUpdateBody: inputStackPolicyDuringUpdate,
 			},
 		)
 		if err != nil {
-			if awsErr, ok := err.(awserr.Error); ok {
-				noUpdatesErr := "No updates are to be performed."
-				if awsErr.Message() == noUpdatesErr {
-					return DeployOut{Message: noUpdatesErr}, nil
+			err = ClassifyAWSError(err)
+			if !errors.Is(err, ErrNoUpdates) {
+				return output, err
+			}
+			// The stack policy is otherwise only applied as part of an
+			// update, so reconcile it separately
+			if settings.StackPolicyBody != nil {
+				_, err := s.cfn().SetStackPolicyWithContext(
+					ctx,
+					&cloudformation.SetStackPolicyInput{
+						StackName:       aws.String(s.StackID),
+						StackPolicyBody: settings.StackPolicyBody,
+					},
+				)
+				if err != nil {
+					return output, ClassifyAWSError(err)
 				}
 			}
-			return output, err
+			output.Duration = time.Since(output.StartTime)
+			output.Message = ErrNoUpdates.Error()
+			output.Operation = DeployNoOp
+			output.Outputs = stackOutputs(s.StackInfo.Outputs)
+			output.StackID = s.StackID
+			output.Status = aws.StringValue(s.StackInfo.StackStatus)
+			return output, nil
 		}
 	}
-	return
+	output.StackID = s.StackID
+	return output, nil
+}
+
+// CancelUpdate cancels the update of the stack which is in progress, rolling
+// the stack back to its previous state. Only updates can be cancelled
+func (s *Stack) CancelUpdate() error {
+	return s.CancelUpdateWithContext(context.Background())
+}
+
+// CancelUpdateWithContext performs the same function as CancelUpdate, with a
+// context to cancel the request
+func (s *Stack) CancelUpdateWithContext(ctx context.Context) error {
+	if s.StackID == "" {
+		return ErrNoStackID
+	}
+	_, err := s.cfn().CancelUpdateStackWithContext(
+		ctx,
+		&cloudformation.CancelUpdateStackInput{
+			StackName: aws.String(s.StackID),
+		},
+	)
+	return ClassifyAWSError(err)
+}
+
+// getStackInfoIfExists populates the StackInfo for the stack, without failing
+// if the stack does not exist yet
+func (s *Stack) getStackInfoIfExists(ctx context.Context) error {
+	if err := s.GetStackInfoWithContext(ctx); err != nil && !errors.Is(err, ErrStackNotFound) {
+		return err
+	}
+	return nil
+}
+
+func (s *Stack) inputTags() (tags []*cloudformation.Tag, err error) {
+	if s.TagsBody != "" {
+		return parseTags(s.TagsBody)
+	} else if s.StackInfo != nil {
+		tags = s.StackInfo.Tags
+	}
+	return tags, nil
+}
+
+func (s *Stack) inputParameters(templateParameters []*cloudformation.TemplateParameter) ([]*cloudformation.Parameter, error) {
+	return resolveParameters(s.TemplateBody, templateParameters, s.parameterInputs())
+}
+
+func (s *Stack) parameterInputs() parameterInputs {
+	return parameterInputs{
+		bodies:      s.ParameterBodies,
+		overrides:   s.ParameterOverrides,
+		previous:    s.previousParameters(),
+		sources:     s.ParameterSources,
+		strict:      s.StrictParameters,
+		usePrevious: s.UsePreviousParameters,
+	}
+}
+
+// previousParameters are the values of the parameters on the stack, or nil if
+// the stack doesn't exist yet
+func (s *Stack) previousParameters() map[string]string {
+	if s.StackInfo == nil {
+		return nil
+	}
+	previous := map[string]string{}
+	for _, p := range s.StackInfo.Parameters {
+		previous[aws.StringValue(p.ParameterKey)] = aws.StringValue(p.ParameterValue)
+	}
+	return previous
 }
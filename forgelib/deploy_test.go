@@ -1,9 +1,12 @@
 package forgelib
 
 import (
+	"errors"
 	"reflect"
 	"sort"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/cloudformation"
@@ -13,6 +16,7 @@ type fakeStack struct {
 	RoleARN, StackName, StackID, StackStatus string
 	Tags                                     []fakeTag
 	Parameters                               []fakeParameter
+	NotificationARNs                         []string
 	EnableTerminationProtection              bool
 }
 
@@ -57,6 +61,8 @@ func genFakeStackData(realStack cloudformation.Stack) fakeStack {
 	}
 	sort.Sort(byParameterKey(output.Parameters))
 
+	output.NotificationARNs = aws.StringValueSlice(realStack.NotificationARNs)
+
 	if r := realStack.RoleARN; r != nil {
 		output.RoleARN = *r
 	}
@@ -70,26 +76,30 @@ func genFakeStackData(realStack cloudformation.Stack) fakeStack {
 
 func TestDeploy(t *testing.T) {
 	cases := []struct {
-		accountID             string
-		capabilityIam         bool
-		cfnRoleName           string
-		expectFailure         bool
-		expectOutput          DeployOut
-		expectStacks          []cloudformation.Stack
-		expectStackPolicy     string
-		failCreate            bool
-		failDescribe          bool
-		failValidate          bool
-		newStackID            string
-		noUpdates             bool
-		parameterInput        []string
-		parameterOverrides    map[string]string
-		requiredParameters    []string
-		stacks                []cloudformation.Stack
-		stackPolicies         map[string]string
-		stackPolicyInput      string
-		tagInput              string
-		terminationProtection bool
+		accountID                string
+		allowProtectionReduction bool
+		capabilityIam            bool
+		cfnRoleName              string
+		expectFailure            bool
+		expectOutput             DeployOut
+		expectStacks             []cloudformation.Stack
+		expectStackPolicy        string
+		expectStackPolicyDuring  string
+		failCreate               bool
+		failDescribe             bool
+		failValidate             bool
+		newStackID               string
+		noUpdates                bool
+		parameterInput           []string
+		parameterOverrides       map[string]string
+		requiredParameters       []string
+		settings                 StackSettings
+		stacks                   []cloudformation.Stack
+		stackPolicies            map[string]string
+		stackPolicyInput         string
+		stackPolicyDuringInput   string
+		tagInput                 string
+		terminationProtection    bool
 	}{
 		// Create new stack with previously used name
 		{
@@ -932,40 +942,261 @@ func TestDeploy(t *testing.T) {
 				},
 			},
 		},
+		// Update; Temporary stack policy during update, leaving the permanent
+		// policy alone
+		{
+			stackPolicyDuringInput: `---
+                Statement:
+                - Effect: Allow
+                  Action: Update:*
+                  Principal: '*'
+                  Resource: '*'`,
+			stacks: []cloudformation.Stack{
+				{
+					StackName:   aws.String("test-stack"),
+					StackId:     aws.String("test-stack/id0"),
+					StackStatus: aws.String(cloudformation.StackStatusCreateComplete),
+				},
+			},
+			expectStacks: []cloudformation.Stack{
+				{
+					StackName:   aws.String("test-stack"),
+					StackId:     aws.String("test-stack/id0"),
+					StackStatus: aws.String(cloudformation.StackStatusUpdateComplete),
+				},
+			},
+			stackPolicies: map[string]string{
+				"test-stack/id0": `{"Statement":[{"Action":"Update:Replace","Effect":"Deny","Principal":"*","Resource":"*"}]}`,
+			},
+			expectStackPolicy:       `{"Statement":[{"Action":"Update:Replace","Effect":"Deny","Principal":"*","Resource":"*"}]}`,
+			expectStackPolicyDuring: `{"Statement":[{"Action":"Update:*","Effect":"Allow","Principal":"*","Resource":"*"}]}`,
+		},
+		// Update stack, refuse to disable termination protection without
+		// confirmation
+		{
+			settings: StackSettings{TerminationProtection: aws.Bool(false)},
+			stacks: []cloudformation.Stack{
+				{
+					StackName:                   aws.String("test-stack"),
+					StackId:                     aws.String("test-stack/id0"),
+					StackStatus:                 aws.String(cloudformation.StackStatusCreateComplete),
+					EnableTerminationProtection: aws.Bool(true),
+				},
+			},
+			expectStacks: []cloudformation.Stack{
+				{
+					StackName:                   aws.String("test-stack"),
+					StackId:                     aws.String("test-stack/id0"),
+					StackStatus:                 aws.String(cloudformation.StackStatusCreateComplete),
+					EnableTerminationProtection: aws.Bool(true),
+				},
+			},
+			expectFailure: true,
+		},
+		// Update stack, disable termination protection with confirmation
+		{
+			allowProtectionReduction: true,
+			settings:                 StackSettings{TerminationProtection: aws.Bool(false)},
+			stacks: []cloudformation.Stack{
+				{
+					StackName:                   aws.String("test-stack"),
+					StackId:                     aws.String("test-stack/id0"),
+					StackStatus:                 aws.String(cloudformation.StackStatusCreateComplete),
+					EnableTerminationProtection: aws.Bool(true),
+				},
+			},
+			expectStacks: []cloudformation.Stack{
+				{
+					StackName:                   aws.String("test-stack"),
+					StackId:                     aws.String("test-stack/id0"),
+					StackStatus:                 aws.String(cloudformation.StackStatusUpdateComplete),
+					EnableTerminationProtection: aws.Bool(false),
+				},
+			},
+		},
+		// Update stack, refuse to remove stack policy without confirmation
+		{
+			settings: StackSettings{StackPolicyBody: aws.String("")},
+			stacks: []cloudformation.Stack{
+				{
+					StackName:   aws.String("test-stack"),
+					StackId:     aws.String("test-stack/id0"),
+					StackStatus: aws.String(cloudformation.StackStatusCreateComplete),
+				},
+			},
+			expectStacks: []cloudformation.Stack{
+				{
+					StackName:   aws.String("test-stack"),
+					StackId:     aws.String("test-stack/id0"),
+					StackStatus: aws.String(cloudformation.StackStatusCreateComplete),
+				},
+			},
+			stackPolicies: map[string]string{
+				"test-stack/id0": `{"Statement":[{"Action":"Update:Replace","Effect":"Deny","Principal":"*","Resource":"*"}]}`,
+			},
+			expectStackPolicy: `{"Statement":[{"Action":"Update:Replace","Effect":"Deny","Principal":"*","Resource":"*"}]}`,
+			expectFailure:     true,
+		},
+		// Update stack, remove stack policy with confirmation when no updates
+		// are to be performed
+		{
+			allowProtectionReduction: true,
+			noUpdates:                true,
+			expectOutput:             DeployOut{Message: "No updates are to be performed."},
+			settings:                 StackSettings{StackPolicyBody: aws.String("")},
+			stacks: []cloudformation.Stack{
+				{
+					StackName:   aws.String("test-stack"),
+					StackId:     aws.String("test-stack/id0"),
+					StackStatus: aws.String(cloudformation.StackStatusCreateComplete),
+				},
+			},
+			expectStacks: []cloudformation.Stack{
+				{
+					StackName:   aws.String("test-stack"),
+					StackId:     aws.String("test-stack/id0"),
+					StackStatus: aws.String(cloudformation.StackStatusCreateComplete),
+				},
+			},
+			stackPolicies: map[string]string{
+				"test-stack/id0": `{"Statement":[{"Action":"Update:Replace","Effect":"Deny","Principal":"*","Resource":"*"}]}`,
+			},
+			expectStackPolicy: allowAllStackPolicy,
+		},
+		// Create stack with notification ARNs
+		{
+			newStackID: "test-stack/id0",
+			settings: StackSettings{
+				NotificationARNs: &[]string{"arn:aws:sns:us-east-1:111111111111:events"},
+			},
+			stacks: []cloudformation.Stack{},
+			expectStacks: []cloudformation.Stack{
+				{
+					StackName:        aws.String("test-stack"),
+					StackId:          aws.String("test-stack/id0"),
+					StackStatus:      aws.String(cloudformation.StackStatusCreateComplete),
+					NotificationARNs: aws.StringSlice([]string{"arn:aws:sns:us-east-1:111111111111:events"}),
+				},
+			},
+		},
+		// Update stack, leave notification ARNs alone
+		{
+			stacks: []cloudformation.Stack{
+				{
+					StackName:        aws.String("test-stack"),
+					StackId:          aws.String("test-stack/id0"),
+					StackStatus:      aws.String(cloudformation.StackStatusCreateComplete),
+					NotificationARNs: aws.StringSlice([]string{"arn:aws:sns:us-east-1:111111111111:events"}),
+				},
+			},
+			expectStacks: []cloudformation.Stack{
+				{
+					StackName:        aws.String("test-stack"),
+					StackId:          aws.String("test-stack/id0"),
+					StackStatus:      aws.String(cloudformation.StackStatusUpdateComplete),
+					NotificationARNs: aws.StringSlice([]string{"arn:aws:sns:us-east-1:111111111111:events"}),
+				},
+			},
+		},
+		// Update stack, remove notification ARNs
+		{
+			settings: StackSettings{NotificationARNs: &[]string{}},
+			stacks: []cloudformation.Stack{
+				{
+					StackName:        aws.String("test-stack"),
+					StackId:          aws.String("test-stack/id0"),
+					StackStatus:      aws.String(cloudformation.StackStatusCreateComplete),
+					NotificationARNs: aws.StringSlice([]string{"arn:aws:sns:us-east-1:111111111111:events"}),
+				},
+			},
+			expectStacks: []cloudformation.Stack{
+				{
+					StackName:   aws.String("test-stack"),
+					StackId:     aws.String("test-stack/id0"),
+					StackStatus: aws.String(cloudformation.StackStatusUpdateComplete),
+				},
+			},
+		},
+		// Update stack, role declared in settings
+		{
+			accountID: "111111111111",
+			settings:  StackSettings{CfnRoleName: aws.String("role-name")},
+			stacks: []cloudformation.Stack{
+				{
+					StackName:   aws.String("test-stack"),
+					StackId:     aws.String("test-stack/id0"),
+					StackStatus: aws.String(cloudformation.StackStatusCreateComplete),
+				},
+			},
+			expectStacks: []cloudformation.Stack{
+				{
+					StackName:   aws.String("test-stack"),
+					StackId:     aws.String("test-stack/id0"),
+					StackStatus: aws.String(cloudformation.StackStatusUpdateComplete),
+					RoleARN:     aws.String("arn:aws:iam::111111111111:role/role-name"),
+				},
+			},
+		},
+		// Update stack, role cannot be removed
+		{
+			settings: StackSettings{CfnRoleName: aws.String("")},
+			stacks: []cloudformation.Stack{
+				{
+					StackName:   aws.String("test-stack"),
+					StackId:     aws.String("test-stack/id0"),
+					StackStatus: aws.String(cloudformation.StackStatusCreateComplete),
+					RoleARN:     aws.String("arn:aws:iam::111111111111:role/role-name"),
+				},
+			},
+			expectStacks: []cloudformation.Stack{
+				{
+					StackName:   aws.String("test-stack"),
+					StackId:     aws.String("test-stack/id0"),
+					StackStatus: aws.String(cloudformation.StackStatusCreateComplete),
+					RoleARN:     aws.String("arn:aws:iam::111111111111:role/role-name"),
+				},
+			},
+			expectFailure: true,
+		},
 	}
 
-	oldCFNClient := cfnClient
-	defer func() { cfnClient = oldCFNClient }()
-	oldSTSClient := stsClient
-	defer func() { stsClient = oldSTSClient }()
+	oldCFNClient := defaultClient.cfnClient
+	defer func() { defaultClient.cfnClient = oldCFNClient }()
+	oldSTSClient := defaultClient.stsClient
+	defer func() { defaultClient.stsClient = oldSTSClient }()
 	for i, c := range cases {
 		theseStacks := cases[i].stacks
 		theseStackPolicies := c.stackPolicies
 		if theseStackPolicies == nil {
 			theseStackPolicies = map[string]string{}
 		}
-		cfnClient = mockCfn{
-			capabilityIam:      c.capabilityIam,
-			failCreate:         c.failCreate,
-			failDescribe:       c.failDescribe,
-			failValidate:       c.failValidate,
-			newStackID:         c.newStackID,
-			noUpdates:          c.noUpdates,
-			requiredParameters: c.requiredParameters,
-			stacks:             &theseStacks,
-			stackPolicies:      &theseStackPolicies,
+		theseStackPoliciesDuringUpdate := map[string]string{}
+		defaultClient.cfnClient = mockCfn{
+			capabilityIam:             c.capabilityIam,
+			failCreate:                c.failCreate,
+			failDescribe:              c.failDescribe,
+			failValidate:              c.failValidate,
+			newStackID:                c.newStackID,
+			noUpdates:                 c.noUpdates,
+			requiredParameters:        c.requiredParameters,
+			stacks:                    &theseStacks,
+			stackPolicies:             &theseStackPolicies,
+			stackPoliciesDuringUpdate: &theseStackPoliciesDuringUpdate,
 		}
-		stsClient = mockSTS{accountID: c.accountID}
+		defaultClient.stsClient = mockSTS{accountID: c.accountID}
 
 		thisStack := Stack{
-			ParameterBodies:       c.parameterInput,
-			ParameterOverrides:    c.parameterOverrides,
-			StackName:             "test-stack",
-			TagsBody:              c.tagInput,
-			TemplateBody:          `{"Resources":{"SNS":{"Type":"AWS::SNS::Topic"}}}`,
-			CfnRoleName:           c.cfnRoleName,
-			StackPolicyBody:       c.stackPolicyInput,
-			TerminationProtection: c.terminationProtection,
+			AllowProtectionReduction:    c.allowProtectionReduction,
+			ParameterBodies:             c.parameterInput,
+			ParameterOverrides:          c.parameterOverrides,
+			Settings:                    c.settings,
+			StackName:                   "test-stack",
+			TagsBody:                    c.tagInput,
+			TemplateBody:                `{"Resources":{"SNS":{"Type":"AWS::SNS::Topic"}}}`,
+			CfnRoleName:                 c.cfnRoleName,
+			StackPolicyBody:             c.stackPolicyInput,
+			StackPolicyDuringUpdateBody: c.stackPolicyDuringInput,
+			TerminationProtection:       c.terminationProtection,
 		}
 
 		output, err := thisStack.Deploy()
@@ -976,8 +1207,8 @@ func TestDeploy(t *testing.T) {
 			t.Fatalf("%d, unexpected error, %v", i, err)
 		}
 
-		if e, g := c.expectOutput, output; e != g {
-			t.Errorf("%d, expected %+v info, got %+v", i, e, g)
+		if e, g := c.expectOutput.Message, output.Message; e != g {
+			t.Errorf("%d, expected \"%s\" message, got \"%s\"", i, e, g)
 		}
 
 		if thisStack.StackID == "" && !c.expectFailure {
@@ -1001,5 +1232,314 @@ func TestDeploy(t *testing.T) {
 				t.Errorf("%d, expected stack policy \"%s\", got none", i, e)
 			}
 		}
+
+		if e, g := c.expectStackPolicyDuring, theseStackPoliciesDuringUpdate[thisStack.StackID]; e != g {
+			t.Errorf("%d, expected stack policy during update \"%s\", got \"%s\"", i, e, g)
+		}
+	}
+}
+
+func TestDeployInvalidParameters(t *testing.T) {
+	oldCFNClient := defaultClient.cfnClient
+	defer func() { defaultClient.cfnClient = oldCFNClient }()
+	stacks := []cloudformation.Stack{}
+	defaultClient.cfnClient = mockCfn{
+		newStackID:         "test-stack/id0",
+		requiredParameters: []string{"Environment"},
+		stacks:             &stacks,
+	}
+
+	s := Stack{
+		ParameterSources: []string{"params.yml"},
+		ParameterBodies:  []string{"Environment: test"},
+		StackName:        "test-stack",
+		TemplateBody:     `{"Parameters":{"Environment":{"Type":"String","AllowedValues":["dev","prod"]}},"Resources":{"SNS":{"Type":"AWS::SNS::Topic"}}}`,
+	}
+	_, err := s.Deploy()
+	if !errors.Is(err, ErrInvalidParameters) {
+		t.Fatalf("expected %v, got %v", ErrInvalidParameters, err)
+	}
+	if e, g := "Invalid parameter values:\n  Environment (from params.yml): \"test\" is not one of the allowed values [dev, prod]", err.Error(); e != g {
+		t.Errorf("expected error %q, got %q", e, g)
+	}
+	if len(stacks) != 0 {
+		t.Errorf("expected no stack to be created, got %d", len(stacks))
+	}
+}
+
+func TestCancelUpdate(t *testing.T) {
+	oldCFNClient := defaultClient.cfnClient
+	defer func() { defaultClient.cfnClient = oldCFNClient }()
+
+	cases := []struct {
+		stackID       string
+		status        string
+		expectStatus  string
+		expectFailure bool
+	}{
+		{
+			stackID:      "test-stack/id0",
+			status:       cloudformation.StackStatusUpdateInProgress,
+			expectStatus: cloudformation.StackStatusUpdateRollbackInProgress,
+		},
+		{
+			stackID:       "test-stack/id0",
+			status:        cloudformation.StackStatusCreateInProgress,
+			expectStatus:  cloudformation.StackStatusCreateInProgress,
+			expectFailure: true,
+		},
+		{
+			stackID:       "",
+			status:        cloudformation.StackStatusUpdateInProgress,
+			expectStatus:  cloudformation.StackStatusUpdateInProgress,
+			expectFailure: true,
+		},
+	}
+
+	for i, c := range cases {
+		theseStacks := []cloudformation.Stack{
+			{
+				StackName:   aws.String("test-stack"),
+				StackId:     aws.String("test-stack/id0"),
+				StackStatus: aws.String(c.status),
+			},
+		}
+		defaultClient.cfnClient = mockCfn{stacks: &theseStacks}
+
+		s := Stack{StackID: c.stackID}
+		err := s.CancelUpdate()
+		if c.expectFailure {
+			if err == nil {
+				t.Errorf("%d, expected error, got success", i)
+			}
+		} else if err != nil {
+			t.Fatalf("%d, unexpected error, %v", i, err)
+		}
+		if e, g := c.expectStatus, *theseStacks[0].StackStatus; e != g {
+			t.Errorf("%d, expected stack status %s, got %s", i, e, g)
+		}
+	}
+}
+
+func TestDeployOutput(t *testing.T) {
+	cases := []struct {
+		cfnRoleName string
+		noUpdates   bool
+		stacks      []cloudformation.Stack
+		expected    DeployOut
+	}{
+		{
+			cfnRoleName: "deploy-role",
+			stacks:      []cloudformation.Stack{},
+			expected: DeployOut{
+				Capabilities: []string{cloudformation.CapabilityCapabilityIam},
+				Operation:    DeployCreate,
+				Parameters:   map[string]string{"Password": "****", "VpcId": "vpc-123"},
+				RoleARN:      "arn:aws:iam::111111111111:role/deploy-role",
+				StackID:      "test-stack/id0",
+				StackName:    "test-stack",
+				Tags:         map[string]string{"Team": "platform"},
+			},
+		},
+		{
+			stacks: []cloudformation.Stack{
+				{
+					StackName:   aws.String("test-stack"),
+					StackId:     aws.String("test-stack/id1"),
+					StackStatus: aws.String(cloudformation.StackStatusCreateComplete),
+					RoleARN:     aws.String("arn:aws:iam::111111111111:role/existing-role"),
+				},
+			},
+			expected: DeployOut{
+				Capabilities: []string{cloudformation.CapabilityCapabilityIam},
+				Operation:    DeployUpdate,
+				Parameters:   map[string]string{"Password": "****", "VpcId": "vpc-123"},
+				RoleARN:      "arn:aws:iam::111111111111:role/existing-role",
+				StackID:      "test-stack/id1",
+				StackName:    "test-stack",
+				Tags:         map[string]string{"Team": "platform"},
+			},
+		},
+		{
+			noUpdates: true,
+			stacks: []cloudformation.Stack{
+				{
+					StackName:   aws.String("test-stack"),
+					StackId:     aws.String("test-stack/id1"),
+					StackStatus: aws.String(cloudformation.StackStatusUpdateComplete),
+					Outputs: []*cloudformation.Output{
+						{OutputKey: aws.String("TopicArn"), OutputValue: aws.String("arn:aws:sns:topic")},
+					},
+				},
+			},
+			expected: DeployOut{
+				Capabilities: []string{cloudformation.CapabilityCapabilityIam},
+				Message:      "No updates are to be performed.",
+				Operation:    DeployNoOp,
+				Outputs:      map[string]string{"TopicArn": "arn:aws:sns:topic"},
+				Parameters:   map[string]string{"Password": "****", "VpcId": "vpc-123"},
+				StackID:      "test-stack/id1",
+				StackName:    "test-stack",
+				Status:       cloudformation.StackStatusUpdateComplete,
+				Tags:         map[string]string{"Team": "platform"},
+			},
+		},
+	}
+
+	oldCFNClient := defaultClient.cfnClient
+	defer func() { defaultClient.cfnClient = oldCFNClient }()
+	oldSTSClient := defaultClient.stsClient
+	defer func() { defaultClient.stsClient = oldSTSClient }()
+	for i, c := range cases {
+		theseStacks := c.stacks
+		defaultClient.cfnClient = mockCfn{
+			capabilityIam:             true,
+			newStackID:                "test-stack/id0",
+			noEchoParameters:          []string{"Password"},
+			noUpdates:                 c.noUpdates,
+			requiredParameters:        []string{"Password", "VpcId"},
+			stacks:                    &theseStacks,
+			stackPolicies:             &map[string]string{},
+			stackPoliciesDuringUpdate: &map[string]string{},
+		}
+		defaultClient.stsClient = mockSTS{accountID: "111111111111"}
+
+		thisStack := Stack{
+			CfnRoleName:     c.cfnRoleName,
+			ParameterBodies: []string{`{"Password": "hunter2", "VpcId": "vpc-123"}`},
+			StackName:       "test-stack",
+			TagsBody:        `{"Team": "platform"}`,
+			TemplateBody:    `{"Resources":{"SNS":{"Type":"AWS::SNS::Topic"}}}`,
+		}
+		output, err := thisStack.Deploy()
+		if err != nil {
+			t.Fatalf("%d, unexpected error, %v", i, err)
+		}
+		if output.StartTime.IsZero() {
+			t.Errorf("%d, expected start time to be set", i)
+		}
+		output.Duration = 0
+		output.StartTime = time.Time{}
+		if c.expected.Outputs == nil {
+			c.expected.Outputs = output.Outputs
+		}
+		if e, g := c.expected, output; !reflect.DeepEqual(e, g) {
+			t.Errorf("%d, expected %+v, got %+v", i, e, g)
+		}
+	}
+}
+
+func TestDeployOutAddWaitResult(t *testing.T) {
+	output := DeployOut{StartTime: time.Now().Add(-time.Minute)}
+	s := Stack{StackInfo: &cloudformation.Stack{
+		Outputs: []*cloudformation.Output{
+			{OutputKey: aws.String("TopicArn"), OutputValue: aws.String("arn:aws:sns:topic")},
+		},
+	}}
+	output.AddWaitResult(&s, WaitResult{Status: cloudformation.StackStatusCreateComplete})
+
+	if e, g := cloudformation.StackStatusCreateComplete, output.Status; e != g {
+		t.Errorf("expected status %s, got %s", e, g)
+	}
+	if output.Duration < time.Minute {
+		t.Errorf("expected duration of at least a minute, got %s", output.Duration)
+	}
+	if e, g := map[string]string{"TopicArn": "arn:aws:sns:topic"}, output.Outputs; !reflect.DeepEqual(e, g) {
+		t.Errorf("expected outputs %v, got %v", e, g)
+	}
+}
+
+func TestDeployUsePreviousParameters(t *testing.T) {
+	cases := []struct {
+		bodies           []string
+		expectError      bool
+		expectOutput     map[string]string
+		expectParameters string
+		stacks           []cloudformation.Stack
+		usePrevious      bool
+	}{
+		// Parameters which aren't given keep their values from the stack
+		{
+			bodies:           []string{"Version: '2'"},
+			usePrevious:      true,
+			expectOutput:     map[string]string{"Password": "****", "Version": "2", "VpcId": "vpc-123"},
+			expectParameters: "Password=previous Version=2 VpcId=previous",
+		},
+		// Only when asked, otherwise they fall back to their defaults
+		{
+			bodies:           []string{"Version: '2'"},
+			expectOutput:     map[string]string{"Version": "2"},
+			expectParameters: "Version=2",
+		},
+		// {{ previous }} asks for the previous value explicitly
+		{
+			bodies:           []string{"Password: '{{ previous }}'\nVersion: '2'\nVpcId: vpc-456"},
+			expectOutput:     map[string]string{"Password": "****", "Version": "2", "VpcId": "vpc-456"},
+			expectParameters: "Password=previous Version=2 VpcId=vpc-456",
+		},
+		// A new stack has no previous values to keep
+		{
+			bodies:      []string{"Password: '{{ previous }}'"},
+			stacks:      []cloudformation.Stack{},
+			expectError: true,
+		},
+	}
+
+	oldCFNClient := defaultClient.cfnClient
+	defer func() { defaultClient.cfnClient = oldCFNClient }()
+	for i, c := range cases {
+		theseStacks := c.stacks
+		if theseStacks == nil {
+			theseStacks = []cloudformation.Stack{
+				{
+					StackName:   aws.String("test-stack"),
+					StackId:     aws.String("test-stack/id1"),
+					StackStatus: aws.String(cloudformation.StackStatusCreateComplete),
+					Parameters: []*cloudformation.Parameter{
+						{ParameterKey: aws.String("Password"), ParameterValue: aws.String("****")},
+						{ParameterKey: aws.String("Version"), ParameterValue: aws.String("1")},
+						{ParameterKey: aws.String("VpcId"), ParameterValue: aws.String("vpc-123")},
+					},
+				},
+			}
+		}
+		defaultClient.cfnClient = mockCfn{
+			newStackID:         "test-stack/id0",
+			noEchoParameters:   []string{"Password"},
+			parameterDefaults:  map[string]string{"Password": "", "VpcId": "vpc-000"},
+			requiredParameters: []string{"Password", "Version", "VpcId"},
+			stacks:             &theseStacks,
+		}
+
+		thisStack := Stack{
+			ParameterBodies:       c.bodies,
+			StackName:             "test-stack",
+			TemplateBody:          `{"Resources":{"SNS":{"Type":"AWS::SNS::Topic"}}}`,
+			UsePreviousParameters: c.usePrevious,
+		}
+		output, err := thisStack.Deploy()
+		if c.expectError {
+			if !errors.Is(err, ErrInvalidParameters) {
+				t.Errorf("%d, expected %v, got %v", i, ErrInvalidParameters, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%d, unexpected error, %v", i, err)
+		}
+		if e, g := c.expectOutput, output.Parameters; !reflect.DeepEqual(e, g) {
+			t.Errorf("%d, expected output parameters %v, got %v", i, e, g)
+		}
+		var got []string
+		for _, p := range theseStacks[0].Parameters {
+			value := aws.StringValue(p.ParameterValue)
+			if aws.BoolValue(p.UsePreviousValue) {
+				value = "previous"
+			}
+			got = append(got, aws.StringValue(p.ParameterKey)+"="+value)
+		}
+		if e, g := c.expectParameters, strings.Join(got, " "); e != g {
+			t.Errorf("%d, expected parameters %q, got %q", i, e, g)
+		}
 	}
 }
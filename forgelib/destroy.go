@@ -1,18 +1,26 @@
 package forgelib
 
 import (
+	"context"
+
 	"github.com/aws/aws-sdk-go/service/cloudformation"
 )
 
 // Destroy will delete the stack
-func (s *Stack) Destroy() (err error) {
+func (s *Stack) Destroy() error {
+	return s.DestroyWithContext(context.Background())
+}
+
+// DestroyWithContext performs the same function as Destroy, with a context to
+// cancel the requests
+func (s *Stack) DestroyWithContext(ctx context.Context) (err error) {
 	if s.StackID == "" {
-		return errorNoStackID
+		return ErrNoStackID
 	}
 
 	var roleARN *string
 	if s.CfnRoleName != "" {
-		roleARNString, err := roleARNFromName(s.CfnRoleName)
+		roleARNString, err := s.client().roleARNFromName(ctx, s.CfnRoleName)
 		if err != nil {
 			return err
 		}
@@ -23,11 +31,12 @@ func (s *Stack) Destroy() (err error) {
 	// the same name which was created since this was previously executed. The
 	// `Stack` object should always refer to the exact same stack, be it created
 	// or deleted
-	_, err = cfnClient.DeleteStack(
+	_, err = s.cfn().DeleteStackWithContext(
+		ctx,
 		&cloudformation.DeleteStackInput{
 			StackName: &s.StackID,
 			RoleARN:   roleARN,
 		},
 	)
-	return
+	return ClassifyAWSError(err)
 }
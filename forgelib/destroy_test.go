@@ -1,6 +1,7 @@
 package forgelib
 
 import (
+	"context"
 	"testing"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -75,14 +76,14 @@ func TestDestroy(t *testing.T) {
 		},
 	}
 
-	oldCFNClient := cfnClient
-	defer func() { cfnClient = oldCFNClient }()
-	oldSTSClient := stsClient
-	defer func() { stsClient = oldSTSClient }()
+	oldCFNClient := defaultClient.cfnClient
+	defer func() { defaultClient.cfnClient = oldCFNClient }()
+	oldSTSClient := defaultClient.stsClient
+	defer func() { defaultClient.stsClient = oldSTSClient }()
 	for i, c := range cases {
 		theseStacks := cases[i].stacks
-		cfnClient = mockCfn{stacks: &theseStacks}
-		stsClient = mockSTS{accountID: c.accountID}
+		defaultClient.cfnClient = mockCfn{stacks: &theseStacks}
+		defaultClient.stsClient = mockSTS{accountID: c.accountID}
 
 		err := c.thisStack.Destroy()
 		if err != nil {
@@ -122,3 +123,26 @@ func TestDestroyNoStackID(t *testing.T) {
 		t.Errorf("expected error, got success")
 	}
 }
+
+func TestDestroyWithCancelledContext(t *testing.T) {
+	oldCFNClient := defaultClient.cfnClient
+	defer func() { defaultClient.cfnClient = oldCFNClient }()
+	theseStacks := []cloudformation.Stack{
+		{
+			StackName:   aws.String("test-stack"),
+			StackId:     aws.String("test-stack/id0"),
+			StackStatus: aws.String(cloudformation.StackStatusCreateComplete),
+		},
+	}
+	defaultClient.cfnClient = mockCfn{stacks: &theseStacks}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	s := Stack{StackID: "test-stack/id0"}
+	if err := s.DestroyWithContext(ctx); err != context.Canceled {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+	if e, g := cloudformation.StackStatusCreateComplete, *theseStacks[0].StackStatus; e != g {
+		t.Errorf("expected stack status %s, got %s", e, g)
+	}
+}
@@ -1,6 +1,163 @@
 package forgelib
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"strings"
 
-var errorNoStackID = fmt.Errorf("StackID must be defined. Hint: Use GetStackInfo() helper function")
-var errorNoStackNameOrID = fmt.Errorf("StackName or StackID must be defined")
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+)
+
+// Errors for stacks which are missing the details needed for an operation
+var (
+	ErrNoStackID         = errors.New("StackID must be defined. Hint: Use GetStackInfo() helper function")
+	ErrNoStackNameOrID   = errors.New("StackName or StackID must be defined")
+	ErrNoStackSetName    = errors.New("StackSetName must be defined")
+	ErrCfnRoleRemoval    = errors.New("The CloudFormation role of an existing stack cannot be removed")
+	ErrProtectionReduced = errors.New("Refusing to reduce the protection of the stack without confirmation")
+	ErrInvalidParameters = errors.New("Invalid parameter values")
+)
+
+// Errors which AWS errors are classified as by ClassifyAWSError. Use errors.Is
+// to check for them
+var (
+	ErrStackNotFound            = errors.New("Stack does not exist")
+	ErrNoUpdates                = errors.New("No updates are to be performed.")
+	ErrStackInProgress          = errors.New("Stack has an operation in progress")
+	ErrTerminationProtected     = errors.New("Stack has termination protection enabled")
+	ErrInsufficientCapabilities = errors.New("Template requires capabilities which were not given")
+	ErrExportNotImported        = errors.New("Export is not imported by any stack")
+)
+
+func errorProtectionReduction(reductions []string) error {
+	return fmt.Errorf("%w: %s", ErrProtectionReduced, strings.Join(reductions, "; "))
+}
+
+// ParameterError is a problem with the value given for a template parameter
+type ParameterError struct {
+	Key     string
+	Message string
+	// Where the value was given, such as the parameters file which it came
+	// from
+	Source string
+}
+
+func (e ParameterError) Error() string {
+	if e.Source == "" {
+		return fmt.Sprintf("%s: %s", e.Key, e.Message)
+	}
+	return fmt.Sprintf("%s (from %s): %s", e.Key, e.Source, e.Message)
+}
+
+// ParameterErrors lists every problem found with the parameter values at once,
+// rather than only the first. errors.Is reports it as ErrInvalidParameters
+type ParameterErrors []ParameterError
+
+func (e ParameterErrors) Error() string {
+	lines := []string{ErrInvalidParameters.Error() + ":"}
+	for _, pe := range e {
+		lines = append(lines, "  "+pe.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Is reports whether target is ErrInvalidParameters
+func (e ParameterErrors) Is(target error) bool {
+	return target == ErrInvalidParameters
+}
+
+// ValidationError is an error from CloudFormation about a request which it
+// wouldn't accept, carrying the details of the AWS error. It satisfies
+// awserr.Error, and errors.Is reports whether it is one of the errors which
+// it was classified as (such as ErrStackNotFound)
+type ValidationError struct {
+	// The error as returned by AWS
+	Err awserr.Error
+	// The error this was classified as, or nil if it wasn't recognised
+	Kind error
+}
+
+func (e *ValidationError) Error() string { return e.Err.Error() }
+
+// Code returns the AWS error code, such as "ValidationError"
+func (e *ValidationError) Code() string { return e.Err.Code() }
+
+// Message returns the message from AWS
+func (e *ValidationError) Message() string { return e.Err.Message() }
+
+// OrigErr returns the error which caused the AWS error, if any
+func (e *ValidationError) OrigErr() error { return e.Err.OrigErr() }
+
+// RequestID returns the ID of the request which failed, when known
+func (e *ValidationError) RequestID() string {
+	if r, ok := e.Err.(awserr.RequestFailure); ok {
+		return r.RequestID()
+	}
+	return ""
+}
+
+// Is reports whether the error was classified as target
+func (e *ValidationError) Is(target error) bool {
+	return e.Kind != nil && e.Kind == target
+}
+
+// Unwrap returns the error as returned by AWS
+func (e *ValidationError) Unwrap() error { return e.Err }
+
+// CloudFormation doesn't give distinct codes for these validation errors, so
+// they are recognised by their messages here, and only here
+var validationErrorKinds = []struct {
+	kind    error
+	matches func(message string) bool
+}{
+	{kind: ErrNoUpdates, matches: func(m string) bool {
+		return strings.Contains(m, "No updates are to be performed")
+	}},
+	// "Stack with id <name> does not exist" or "Stack [<name>] does not exist"
+	{kind: ErrStackNotFound, matches: func(m string) bool {
+		return strings.HasPrefix(m, "Stack") && strings.HasSuffix(strings.TrimSuffix(m, "."), "does not exist")
+	}},
+	// "Stack:<id> is in UPDATE_IN_PROGRESS state and can not be updated."
+	{kind: ErrStackInProgress, matches: func(m string) bool {
+		return strings.Contains(m, "_IN_PROGRESS state")
+	}},
+	{kind: ErrTerminationProtected, matches: func(m string) bool {
+		return strings.Contains(m, "TerminationProtection is enabled")
+	}},
+	// "Requires capabilities : [CAPABILITY_IAM]"
+	{kind: ErrInsufficientCapabilities, matches: func(m string) bool {
+		return strings.Contains(m, "Requires capabilities")
+	}},
+	// "Export '<name>' is not imported by any stack."
+	{kind: ErrExportNotImported, matches: func(m string) bool {
+		return strings.Contains(m, "is not imported by any stack")
+	}},
+}
+
+// ClassifyAWSError converts a validation error from CloudFormation into a
+// ValidationError, recognising the errors which it is one of. Any other error
+// is returned unchanged, as are errors which have already been classified
+func ClassifyAWSError(err error) error {
+	var validationErr *ValidationError
+	if err == nil || errors.As(err, &validationErr) {
+		return err
+	}
+	awsErr, ok := err.(awserr.Error)
+	if !ok {
+		return err
+	}
+
+	switch awsErr.Code() {
+	case cloudformation.ErrCodeInsufficientCapabilitiesException:
+		return &ValidationError{Err: awsErr, Kind: ErrInsufficientCapabilities}
+	case "ValidationError":
+		for _, k := range validationErrorKinds {
+			if k.matches(awsErr.Message()) {
+				return &ValidationError{Err: awsErr, Kind: k.kind}
+			}
+		}
+		return &ValidationError{Err: awsErr}
+	}
+	return err
+}
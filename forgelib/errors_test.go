@@ -0,0 +1,124 @@
+package forgelib
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+)
+
+func TestClassifyAWSError(t *testing.T) {
+	cases := []struct {
+		err              error
+		expectKind       error
+		expectValidation bool
+	}{
+		{
+			err:              awserr.New("ValidationError", "Stack with id test-stack does not exist", nil),
+			expectKind:       ErrStackNotFound,
+			expectValidation: true,
+		},
+		{
+			err:              awserr.New("ValidationError", "Stack [test-stack] does not exist.", nil),
+			expectKind:       ErrStackNotFound,
+			expectValidation: true,
+		},
+		{
+			err:              awserr.New("ValidationError", "No updates are to be performed.", nil),
+			expectKind:       ErrNoUpdates,
+			expectValidation: true,
+		},
+		{
+			err:              awserr.New("ValidationError", "Stack:arn:aws:cloudformation:us-east-1:111111111111:stack/test-stack/id0 is in UPDATE_IN_PROGRESS state and can not be updated.", nil),
+			expectKind:       ErrStackInProgress,
+			expectValidation: true,
+		},
+		{
+			err:              awserr.New("ValidationError", "Stack [test-stack] cannot be deleted while TerminationProtection is enabled", nil),
+			expectKind:       ErrTerminationProtected,
+			expectValidation: true,
+		},
+		{
+			err:              awserr.New(cloudformation.ErrCodeInsufficientCapabilitiesException, "Requires capabilities : [CAPABILITY_IAM]", nil),
+			expectKind:       ErrInsufficientCapabilities,
+			expectValidation: true,
+		},
+		{
+			err:              awserr.New("ValidationError", "Export 'test-export' is not imported by any stack.", nil),
+			expectKind:       ErrExportNotImported,
+			expectValidation: true,
+		},
+		{
+			err:              awserr.NewRequestFailure(awserr.New("ValidationError", "Template format error", nil), 400, "request-id"),
+			expectValidation: true,
+		},
+		// Other errors from AWS, and errors which aren't from AWS, are left as
+		// they are
+		{
+			err: awserr.New(cloudformation.ErrCodeAlreadyExistsException, "Stack [test-stack] already exists", nil),
+		},
+		{
+			err: awserr.New(cloudformation.ErrCodeChangeSetNotFoundException, "ChangeSet [test] does not exist", nil),
+		},
+		{
+			err: fmt.Errorf("Stack with id test-stack does not exist"),
+		},
+	}
+
+	kinds := []error{ErrStackNotFound, ErrNoUpdates, ErrStackInProgress, ErrTerminationProtected, ErrInsufficientCapabilities, ErrExportNotImported}
+	for i, c := range cases {
+		classified := ClassifyAWSError(c.err)
+
+		for _, k := range kinds {
+			if e, g := k == c.expectKind, errors.Is(classified, k); e != g {
+				t.Errorf("%d, expected errors.Is(%v) to be %t, got %t", i, k, e, g)
+			}
+		}
+
+		var validationErr *ValidationError
+		if e, g := c.expectValidation, errors.As(classified, &validationErr); e != g {
+			t.Fatalf("%d, expected ValidationError %t, got %t", i, e, g)
+		}
+		if !c.expectValidation {
+			if classified != c.err {
+				t.Errorf("%d, expected error to be unchanged, got %v", i, classified)
+			}
+			continue
+		}
+
+		// The details of the AWS error are kept
+		if e, g := c.err.Error(), classified.Error(); e != g {
+			t.Errorf("%d, expected \"%s\" error, got \"%s\"", i, e, g)
+		}
+		awsErr, ok := classified.(awserr.Error)
+		if !ok {
+			t.Fatalf("%d, expected awserr.Error, got %T", i, classified)
+		}
+		if e, g := c.err.(awserr.Error).Code(), awsErr.Code(); e != g {
+			t.Errorf("%d, expected code %s, got %s", i, e, g)
+		}
+		if ClassifyAWSError(classified) != classified {
+			t.Errorf("%d, expected classified error to be unchanged when classified again", i)
+		}
+	}
+}
+
+func TestStackErrors(t *testing.T) {
+	oldCFNClient := defaultClient.cfnClient
+	defer func() { defaultClient.cfnClient = oldCFNClient }()
+	theseStacks := []cloudformation.Stack{}
+	defaultClient.cfnClient = mockCfn{stacks: &theseStacks}
+
+	s := Stack{StackName: "test-stack"}
+	if err := s.GetStackInfo(); !errors.Is(err, ErrStackNotFound) {
+		t.Errorf("expected %v, got %v", ErrStackNotFound, err)
+	}
+	if err := s.Destroy(); !errors.Is(err, ErrNoStackID) {
+		t.Errorf("expected %v, got %v", ErrNoStackID, err)
+	}
+	if err := errorProtectionReduction([]string{"a", "b"}); !errors.Is(err, ErrProtectionReduced) {
+		t.Errorf("expected %v, got %v", ErrProtectionReduced, err)
+	}
+}
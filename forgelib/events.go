@@ -1,9 +1,11 @@
 package forgelib
 
 import (
+	"context"
 	"sort"
 	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/cloudformation"
 )
 
@@ -15,11 +17,18 @@ func (t byTime) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
 
 // ListEvents will get all events for a stack and sort them in chronological order
 // within a time range
-func (s *Stack) ListEvents(after *time.Time) (events []*cloudformation.StackEvent, err error) {
+func (s *Stack) ListEvents(after *time.Time) ([]*cloudformation.StackEvent, error) {
+	return s.ListEventsWithContext(context.Background(), after)
+}
+
+// ListEventsWithContext performs the same function as ListEvents, with a
+// context to cancel the requests
+func (s *Stack) ListEventsWithContext(ctx context.Context, after *time.Time) (events []*cloudformation.StackEvent, err error) {
 	if s.StackID == "" {
-		return events, errorNoStackID
+		return events, ErrNoStackID
 	}
-	err = cfnClient.DescribeStackEventsPages(
+	err = s.cfn().DescribeStackEventsPagesWithContext(
+		ctx,
 		&cloudformation.DescribeStackEventsInput{
 			StackName: &s.StackID,
 		}, func(page *cloudformation.DescribeStackEventsOutput, lastPage bool) bool {
@@ -43,10 +52,97 @@ func (s *Stack) ListEvents(after *time.Time) (events []*cloudformation.StackEven
 
 // GetLastEventTime will get the time of the last event for the stack
 func (s *Stack) GetLastEventTime() (*time.Time, error) {
-	epoch := time.Unix(0, 0)
-	events, err := s.ListEvents(&epoch)
+	return s.GetLastEventTimeWithContext(context.Background())
+}
+
+// GetLastEventTimeWithContext performs the same function as GetLastEventTime,
+// with a context to cancel the requests. Events are listed newest first, so
+// only the first page is read
+func (s *Stack) GetLastEventTimeWithContext(ctx context.Context) (*time.Time, error) {
+	if s.StackID == "" {
+		return new(time.Time), ErrNoStackID
+	}
+	eventsOut, err := s.cfn().DescribeStackEventsWithContext(
+		ctx,
+		&cloudformation.DescribeStackEventsInput{
+			StackName: &s.StackID,
+		},
+	)
+	if err != nil {
+		return new(time.Time), ClassifyAWSError(err)
+	}
+	last := new(time.Time)
+	for _, e := range eventsOut.StackEvents {
+		if e.Timestamp.After(*last) {
+			last = e.Timestamp
+		}
+	}
+	return last, nil
+}
+
+// EventStream follows the events of a stack as they happen. Events are listed
+// newest first, so each call to Next stops reading once it reaches the last
+// event which it has already seen, keeping polling cheap for stacks with a long
+// history. Requests are spaced out by the budget of the stack's client, which
+// is shared with the other stacks being followed with it
+type EventStream struct {
+	// Events at or before this time are skipped until an event has been seen
+	after       time.Time
+	lastEventID string
+	stack       *Stack
+}
+
+// NewEventStream starts a stream of the events of the stack after the given
+// time, such as the time from GetLastEventTime. A zero time streams the whole
+// history of the stack
+func (s *Stack) NewEventStream(after time.Time) *EventStream {
+	return &EventStream{after: after, stack: s}
+}
+
+// Next returns the events since the previous call, in chronological order
+func (es *EventStream) Next(ctx context.Context) (events []*cloudformation.StackEvent, err error) {
+	s := es.stack
+	if s.StackID == "" {
+		return events, ErrNoStackID
+	}
+	err = s.cfn().DescribeStackEventsPagesWithContext(
+		ctx,
+		&cloudformation.DescribeStackEventsInput{
+			StackName: &s.StackID,
+		}, func(page *cloudformation.DescribeStackEventsOutput, lastPage bool) bool {
+			for _, e := range page.StackEvents {
+				if es.seen(e) {
+					return false
+				}
+				events = append(events, e)
+			}
+			return true
+		},
+		s.client().pollBudget().requestOption(),
+	)
 	if err != nil {
-		return new(time.Time), err
+		return nil, ClassifyAWSError(err)
+	}
+
+	// Reversing keeps the order of events with the same timestamp
+	for i, j := 0, len(events)-1; i < j; i, j = i+1, j-1 {
+		events[i], events[j] = events[j], events[i]
+	}
+	sort.Stable(byTime(events))
+	if len(events) > 0 {
+		newest := events[len(events)-1]
+		es.after = *newest.Timestamp
+		es.lastEventID = aws.StringValue(newest.EventId)
+	}
+	return events, nil
+}
+
+// seen reports whether the event was already returned, or was before the
+// stream began. Events are only compared by time before the first is seen, as
+// several events can share a timestamp
+func (es *EventStream) seen(e *cloudformation.StackEvent) bool {
+	if es.lastEventID != "" {
+		return aws.StringValue(e.EventId) == es.lastEventID || e.Timestamp.Before(es.after)
 	}
-	return events[len(events)-1].Timestamp, err
+	return !e.Timestamp.After(es.after)
 }
@@ -1,13 +1,40 @@
 package forgelib
 
 import (
+	"context"
+	"fmt"
 	"testing"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
 )
 
+// mockEventPages lists the events newest first, two to a page, counting the
+// pages which are read
+type mockEventPages struct {
+	events    *[]*cloudformation.StackEvent
+	pagesRead *int
+	cloudformationiface.CloudFormationAPI
+}
+
+func (m mockEventPages) DescribeStackEventsPagesWithContext(ctx aws.Context, input *cloudformation.DescribeStackEventsInput, function func(*cloudformation.DescribeStackEventsOutput, bool) bool, opts ...request.Option) error {
+	events := *m.events
+	for i := 0; i < len(events); i += 2 {
+		end := i + 2
+		if end > len(events) {
+			end = len(events)
+		}
+		*m.pagesRead++
+		if !function(&cloudformation.DescribeStackEventsOutput{StackEvents: events[i:end]}, end == len(events)) {
+			return nil
+		}
+	}
+	return nil
+}
+
 func TestListEvents(t *testing.T) {
 	cases := []struct {
 		after    time.Time
@@ -69,10 +96,10 @@ func TestListEvents(t *testing.T) {
 			expected: []*cloudformation.StackEvent{},
 		},
 	}
-	oldCFNClient := cfnClient
-	defer func() { cfnClient = oldCFNClient }()
+	oldCFNClient := defaultClient.cfnClient
+	defer func() { defaultClient.cfnClient = oldCFNClient }()
 	for i, c := range cases {
-		cfnClient = mockCfn{stackEventsOutput: c.resp}
+		defaultClient.cfnClient = mockCfn{stackEventsOutput: c.resp}
 
 		s := Stack{StackID: "whatever"}
 		events, err := s.ListEvents(&c.after)
@@ -111,10 +138,10 @@ func TestGetLastEventTime(t *testing.T) {
 			expected: time.Unix(300, 0),
 		},
 	}
-	oldCFNClient := cfnClient
-	defer func() { cfnClient = oldCFNClient }()
+	oldCFNClient := defaultClient.cfnClient
+	defer func() { defaultClient.cfnClient = oldCFNClient }()
 	for i, c := range cases {
-		cfnClient = mockCfn{stackEventsOutput: c.resp}
+		defaultClient.cfnClient = mockCfn{stackEventsOutput: c.resp}
 
 		s := Stack{StackID: "whatever"}
 		result, err := s.GetLastEventTime()
@@ -126,3 +153,76 @@ func TestGetLastEventTime(t *testing.T) {
 		}
 	}
 }
+
+func TestEventStream(t *testing.T) {
+	oldCFNClient := defaultClient.cfnClient
+	defer func() { defaultClient.cfnClient = oldCFNClient }()
+
+	event := func(id string, seconds int64) *cloudformation.StackEvent {
+		return &cloudformation.StackEvent{
+			EventId:   aws.String(id),
+			Timestamp: aws.Time(time.Unix(seconds, 0)),
+		}
+	}
+	// Newest first, as listed by CloudFormation
+	events := []*cloudformation.StackEvent{
+		event("e5", 500), event("e4", 400), event("e3", 300),
+		event("e2", 200), event("e1", 100), event("e0", 0),
+	}
+	pagesRead := 0
+	defaultClient.cfnClient = mockEventPages{events: &events, pagesRead: &pagesRead}
+
+	s := Stack{StackID: "whatever"}
+	stream := s.NewEventStream(time.Unix(250, 0))
+	cases := []struct {
+		newEvents       []*cloudformation.StackEvent
+		expectEvents    []string
+		expectPagesRead int
+	}{
+		{
+			expectEvents:    []string{"e3", "e4", "e5"},
+			expectPagesRead: 2,
+		},
+		{
+			expectEvents:    []string{},
+			expectPagesRead: 1,
+		},
+		{
+			// Events which share the time of the last event seen are kept
+			newEvents:       []*cloudformation.StackEvent{event("e7", 600), event("e6", 500)},
+			expectEvents:    []string{"e6", "e7"},
+			expectPagesRead: 2,
+		},
+		{
+			newEvents:       []*cloudformation.StackEvent{event("e8", 700)},
+			expectEvents:    []string{"e8"},
+			expectPagesRead: 1,
+		},
+	}
+	for i, c := range cases {
+		events = append(c.newEvents, events...)
+		pagesRead = 0
+
+		next, err := stream.Next(context.Background())
+		if err != nil {
+			t.Fatalf("%d, unexpected error, %v", i, err)
+		}
+		ids := []string{}
+		for _, e := range next {
+			ids = append(ids, *e.EventId)
+		}
+		if e, g := fmt.Sprint(c.expectEvents), fmt.Sprint(ids); e != g {
+			t.Errorf("%d, expected events %s, got %s", i, e, g)
+		}
+		if e, g := c.expectPagesRead, pagesRead; e != g {
+			t.Errorf("%d, expected %d pages read, got %d", i, e, g)
+		}
+	}
+}
+
+func TestEventStreamNoStackID(t *testing.T) {
+	s := Stack{}
+	if _, err := s.NewEventStream(time.Time{}).Next(context.Background()); err != ErrNoStackID {
+		t.Errorf("expected %v, got %v", ErrNoStackID, err)
+	}
+}
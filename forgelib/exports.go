@@ -0,0 +1,52 @@
+package forgelib
+
+import (
+	"errors"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+)
+
+// ExportImport describes an output exported by a stack, and the names of the
+// other stacks which import it
+type ExportImport struct {
+	ExportName      string
+	ImportingStacks []string
+}
+
+// ListExportImports will find each export of the stack which is currently
+// imported by another stack. Exports which are not imported are omitted
+func (s *Stack) ListExportImports() (imports []ExportImport, err error) {
+	if s.StackInfo == nil {
+		if err := s.GetStackInfo(); err != nil {
+			return imports, err
+		}
+	}
+
+	for _, o := range s.StackInfo.Outputs {
+		if o.ExportName == nil {
+			continue
+		}
+		thisImport := ExportImport{ExportName: *o.ExportName}
+		err := s.cfn().ListImportsPages(
+			&cloudformation.ListImportsInput{
+				ExportName: o.ExportName,
+			}, func(page *cloudformation.ListImportsOutput, lastPage bool) bool {
+				thisImport.ImportingStacks = append(thisImport.ImportingStacks, aws.StringValueSlice(page.Imports)...)
+				// Continue reading all pages
+				return true
+			},
+		)
+		if err != nil {
+			// CloudFormation reports an export without any imports as an error
+			if err = ClassifyAWSError(err); errors.Is(err, ErrExportNotImported) {
+				continue
+			}
+			return imports, err
+		}
+		if len(thisImport.ImportingStacks) > 0 {
+			imports = append(imports, thisImport)
+		}
+	}
+	return imports, nil
+}
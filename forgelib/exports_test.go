@@ -0,0 +1,69 @@
+package forgelib
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+)
+
+func TestListExportImports(t *testing.T) {
+	cases := []struct {
+		imports  map[string][]string
+		outputs  []*cloudformation.Output
+		expected []ExportImport
+	}{
+		// No exports
+		{
+			outputs: []*cloudformation.Output{
+				{OutputKey: aws.String("VpcId"), OutputValue: aws.String("vpc-1234")},
+			},
+		},
+		// Exports, but none imported
+		{
+			outputs: []*cloudformation.Output{
+				{OutputKey: aws.String("VpcId"), OutputValue: aws.String("vpc-1234"), ExportName: aws.String("network-VpcId")},
+			},
+		},
+		// Some exports imported
+		{
+			imports: map[string][]string{
+				"network-VpcId": {"app-one", "app-two"},
+			},
+			outputs: []*cloudformation.Output{
+				{OutputKey: aws.String("VpcId"), OutputValue: aws.String("vpc-1234"), ExportName: aws.String("network-VpcId")},
+				{OutputKey: aws.String("SubnetId"), OutputValue: aws.String("subnet-1234"), ExportName: aws.String("network-SubnetId")},
+			},
+			expected: []ExportImport{
+				{ExportName: "network-VpcId", ImportingStacks: []string{"app-one", "app-two"}},
+			},
+		},
+	}
+
+	oldCFNClient := defaultClient.cfnClient
+	defer func() { defaultClient.cfnClient = oldCFNClient }()
+	for i, c := range cases {
+		theseStacks := []cloudformation.Stack{
+			{
+				StackName:   aws.String("network"),
+				StackId:     aws.String("network/id0"),
+				StackStatus: aws.String(cloudformation.StackStatusCreateComplete),
+				Outputs:     c.outputs,
+			},
+		}
+		defaultClient.cfnClient = mockCfn{
+			imports: c.imports,
+			stacks:  &theseStacks,
+		}
+
+		s := Stack{StackName: "network"}
+		imports, err := s.ListExportImports()
+		if err != nil {
+			t.Fatalf("%d, unexpected error, %v", i, err)
+		}
+		if !reflect.DeepEqual(c.expected, imports) {
+			t.Errorf("%d, expected %+v, got %+v", i, c.expected, imports)
+		}
+	}
+}
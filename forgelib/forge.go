@@ -1,37 +1,71 @@
 package forgelib
 
-import "github.com/aws/aws-sdk-go/service/cloudformation"
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
 
 // Stack represents the attributes of a stack deployment, including the AWS
 // parameters, and local resources which represent what needs to be deployed
 type Stack struct {
-	ParameterBodies       []string
-	ParameterOverrides    map[string]string
-	ProjectManifest       string
-	CfnRoleName           string
-	StackID               string
-	StackInfo             *cloudformation.Stack
-	StackName             string
-	StackPolicyBody       string
+	AllowProtectionReduction bool
+	// Defaults to the package-level client
+	Client             *Client
+	ParameterBodies    []string
+	ParameterOverrides map[string]string
+	// Names for ParameterBodies, in the same order, such as the files which
+	// they were read from. Used to say where parameter values came from
+	ParameterSources            []string
+	ProjectManifest             string
+	Region                      string
+	ResourcesToImportBody       string
+	CfnRoleName                 string
+	Settings                    StackSettings
+	StackID                     string
+	StackInfo                   *cloudformation.Stack
+	StackName                   string
+	StackPolicyBody             string
+	StackPolicyDuringUpdateBody string
+	// Reject parameter keys which aren't in the template, and template
+	// parameters which have neither a value nor a default, before deploying
+	StrictParameters      bool
 	TagsBody              string
 	TemplateBody          string
 	TerminationProtection bool
+	// Keep the previous values of template parameters which exist on the stack
+	// but aren't given a value, rather than falling back to their defaults
+	UsePreviousParameters bool
 }
 
 // GetStackInfo populates the StackInfo for this object from the existing stack
 // found in the environment
-func (s *Stack) GetStackInfo() (err error) {
+func (s *Stack) GetStackInfo() error {
+	return s.GetStackInfoWithContext(context.Background())
+}
+
+// GetStackInfoWithContext performs the same function as GetStackInfo, with a
+// context to cancel the request
+func (s *Stack) GetStackInfoWithContext(ctx context.Context) error {
+	return s.getStackInfo(ctx)
+}
+
+// getStackInfo populates the StackInfo, with options for the request
+func (s *Stack) getStackInfo(ctx context.Context, opts ...request.Option) (err error) {
 	var stackName *string
 	if s.StackID != "" {
 		stackName = &s.StackID
 	} else if s.StackName != "" {
 		stackName = &s.StackName
 	} else {
-		return errorNoStackNameOrID
+		return ErrNoStackNameOrID
 	}
-	stackOut, err := cfnClient.DescribeStacks(&cloudformation.DescribeStacksInput{StackName: stackName})
+	stackOut, err := s.cfn().DescribeStacksWithContext(ctx, &cloudformation.DescribeStacksInput{StackName: stackName}, opts...)
 	if err != nil {
-		return err
+		return ClassifyAWSError(err)
 	}
 	s.StackInfo = stackOut.Stacks[0]
 	if s.StackName == "" {
@@ -42,3 +76,28 @@ func (s *Stack) GetStackInfo() (err error) {
 	}
 	return
 }
+
+// client returns the client which the stack is managed with
+func (s *Stack) client() *Client {
+	if s.Client != nil {
+		return s.Client
+	}
+	return defaultClient
+}
+
+// cfn returns the CloudFormation client for the region of the stack, which is
+// the client's own unless the stack has a region set
+func (s *Stack) cfn() cloudformationiface.CloudFormationAPI {
+	if s.Region == "" {
+		return s.client().cfn()
+	}
+	return s.client().clientsForRegion(s.Region).cfn
+}
+
+// s3 returns the S3 client for the region of the stack
+func (s *Stack) s3() s3iface.S3API {
+	if s.Region == "" {
+		return s.client().s3()
+	}
+	return s.client().clientsForRegion(s.Region).s3
+}
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/cloudformation"
 	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
 )
@@ -17,6 +18,10 @@ func (m mockStacks) DescribeStacks(*cloudformation.DescribeStacksInput) (*cloudf
 	return &m.stacksOutput, nil
 }
 
+func (m mockStacks) DescribeStacksWithContext(ctx aws.Context, input *cloudformation.DescribeStacksInput, opts ...request.Option) (*cloudformation.DescribeStacksOutput, error) {
+	return m.DescribeStacks(input)
+}
+
 func TestGetStackInfo(t *testing.T) {
 	cases := []struct {
 		stackName string
@@ -48,10 +53,10 @@ func TestGetStackInfo(t *testing.T) {
 		},
 	}
 
-	oldCFNClient := cfnClient
-	defer func() { cfnClient = oldCFNClient }()
+	oldCFNClient := defaultClient.cfnClient
+	defer func() { defaultClient.cfnClient = oldCFNClient }()
 	for i, c := range cases {
-		cfnClient = mockStacks{stacksOutput: c.resp}
+		defaultClient.cfnClient = mockStacks{stacksOutput: c.resp}
 
 		s := Stack{
 			StackName: c.stackName,
@@ -86,3 +91,88 @@ func TestGetStackInfoNoStackParameters(t *testing.T) {
 		t.Errorf("expected error, got success")
 	}
 }
+
+func TestStackRegionalClients(t *testing.T) {
+	oldCFNClient := defaultClient.cfnClient
+	defer func() { defaultClient.cfnClient = oldCFNClient }()
+	defaultClient.cfnClient = mockStacks{stacksOutput: cloudformation.DescribeStacksOutput{
+		Stacks: []*cloudformation.Stack{
+			{StackName: aws.String("test-stack"), StackId: aws.String("default-region-stack")},
+		},
+	}}
+
+	defaultClient.mutex.Lock()
+	oldRegionalClients := defaultClient.regionalClients
+	defaultClient.regionalClients = map[string]*regionalClientSet{
+		"eu-west-1": {cfn: mockStacks{stacksOutput: cloudformation.DescribeStacksOutput{
+			Stacks: []*cloudformation.Stack{
+				{StackName: aws.String("test-stack"), StackId: aws.String("eu-west-1-stack")},
+			},
+		}}},
+	}
+	defaultClient.mutex.Unlock()
+	defer func() {
+		defaultClient.mutex.Lock()
+		defaultClient.regionalClients = oldRegionalClients
+		defaultClient.mutex.Unlock()
+	}()
+
+	cases := []struct {
+		region        string
+		expectStackID string
+	}{
+		{region: "", expectStackID: "default-region-stack"},
+		{region: "eu-west-1", expectStackID: "eu-west-1-stack"},
+	}
+
+	for i, c := range cases {
+		s := Stack{StackName: "test-stack", Region: c.region}
+		if err := s.GetStackInfo(); err != nil {
+			t.Fatalf("%d, unexpected error, %v", i, err)
+		}
+		if e, g := c.expectStackID, s.StackID; e != g {
+			t.Errorf("%d, expected \"%s\" stack id, got \"%s\"", i, e, g)
+		}
+	}
+}
+
+func TestStackClient(t *testing.T) {
+	oldCFNClient := defaultClient.cfnClient
+	defer func() { defaultClient.cfnClient = oldCFNClient }()
+	defaultClient.cfnClient = mockStacks{stacksOutput: cloudformation.DescribeStacksOutput{
+		Stacks: []*cloudformation.Stack{
+			{StackName: aws.String("test-stack"), StackId: aws.String("default-client-stack")},
+		},
+	}}
+
+	otherClient, err := NewClientWithOptions(ClientOptions{
+		Region: "us-east-1",
+		CloudFormation: mockStacks{stacksOutput: cloudformation.DescribeStacksOutput{
+			Stacks: []*cloudformation.Stack{
+				{StackName: aws.String("test-stack"), StackId: aws.String("other-client-stack")},
+			},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+
+	cases := []struct {
+		client        *Client
+		expectStackID string
+	}{
+		{client: nil, expectStackID: "default-client-stack"},
+		{client: defaultClient, expectStackID: "default-client-stack"},
+		{client: otherClient, expectStackID: "other-client-stack"},
+	}
+
+	for i, c := range cases {
+		s := Stack{StackName: "test-stack", Client: c.client}
+		if err := s.GetStackInfo(); err != nil {
+			t.Fatalf("%d, unexpected error, %v", i, err)
+		}
+		if e, g := c.expectStackID, s.StackID; e != g {
+			t.Errorf("%d, expected \"%s\" stack id, got \"%s\"", i, e, g)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package forgelib
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"reflect"
 	"strconv"
@@ -46,8 +47,8 @@ func valueToString(v interface{}, dest *string, allowSlices bool, allowCommas bo
 	return nil
 }
 
-func roleARNFromName(roleName string) (output string, err error) {
-	callerIdentity, err := stsClient.GetCallerIdentity(&sts.GetCallerIdentityInput{})
+func (c *Client) roleARNFromName(ctx context.Context, roleName string) (output string, err error) {
+	callerIdentity, err := c.sts().GetCallerIdentityWithContext(ctx, &sts.GetCallerIdentityInput{})
 	if err != nil {
 		return output, err
 	}
@@ -1,6 +1,9 @@
 package forgelib
 
-import "testing"
+import (
+	"context"
+	"testing"
+)
 
 func TestValueToStringDefault(t *testing.T) {
 	cases := []struct {
@@ -94,13 +97,13 @@ func TestRoleARNFromName(t *testing.T) {
 		},
 	}
 
-	oldSTSClient := stsClient
-	defer func() { stsClient = oldSTSClient }()
+	oldSTSClient := defaultClient.stsClient
+	defer func() { defaultClient.stsClient = oldSTSClient }()
 
 	for i, c := range cases {
-		stsClient = mockSTS{accountID: c.accountID}
+		defaultClient.stsClient = mockSTS{accountID: c.accountID}
 
-		got, err := roleARNFromName(c.input)
+		got, err := defaultClient.roleARNFromName(context.Background(), c.input)
 		if err != nil {
 			t.Fatalf("%d, unexpected error, %v", i, err)
 		}
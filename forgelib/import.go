@@ -0,0 +1,176 @@
+package forgelib
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+)
+
+// ImportOut provides a controlled format for information to be passed out of
+// the CreateImportChangeSet function
+type ImportOut struct {
+	ChangeSetID string
+	Changes     []*cloudformation.Change
+	// Whether the stack was created along with the change set. It stays in
+	// REVIEW_IN_PROGRESS, without any resources, until the change set is
+	// executed
+	NewStack bool
+}
+
+// CreateImportChangeSet will create a change set which imports existing
+// resources into the stack, creating the stack if it does not exist yet. The
+// resources to import are read from ResourcesToImportBody, which maps the
+// logical ID of each resource in the template to its resource identifiers.
+// The change set is not executed
+func (s *Stack) CreateImportChangeSet() (ImportOut, error) {
+	return s.CreateImportChangeSetWithContext(context.Background())
+}
+
+// CreateImportChangeSetWithContext performs the same function as
+// CreateImportChangeSet, with a context to cancel the requests and the wait for
+// the change set to be created
+func (s *Stack) CreateImportChangeSetWithContext(ctx context.Context) (output ImportOut, err error) {
+	resourcesToImport, err := parseResourcesToImport(s.ResourcesToImportBody, s.TemplateBody)
+	if err != nil {
+		return output, err
+	}
+
+	validationResult, err := s.cfn().ValidateTemplateWithContext(
+		ctx,
+		&cloudformation.ValidateTemplateInput{
+			TemplateBody: aws.String(s.TemplateBody),
+		},
+	)
+	if err != nil {
+		return output, err
+	}
+
+	if err := s.getStackInfoIfExists(ctx); err != nil {
+		return output, err
+	}
+	output.NewStack = s.StackInfo == nil
+
+	tags, err := s.inputTags()
+	if err != nil {
+		return output, err
+	}
+
+	inputParams, err := s.inputParameters(validationResult.Parameters)
+	if err != nil {
+		return output, err
+	}
+
+	var roleARN *string
+	if s.CfnRoleName != "" {
+		roleARNString, err := s.client().roleARNFromName(ctx, s.CfnRoleName)
+		if err != nil {
+			return output, err
+		}
+		roleARN = &roleARNString
+	}
+
+	createOut, err := s.cfn().CreateChangeSetWithContext(
+		ctx,
+		&cloudformation.CreateChangeSetInput{
+			ChangeSetName:     aws.String(fmt.Sprintf("forge-import-%d", time.Now().Unix())),
+			ChangeSetType:     aws.String(cloudformation.ChangeSetTypeImport),
+			StackName:         aws.String(s.StackName),
+			TemplateBody:      aws.String(s.TemplateBody),
+			Capabilities:      validationResult.Capabilities,
+			Tags:              tags,
+			Parameters:        inputParams,
+			ResourcesToImport: resourcesToImport,
+			RoleARN:           roleARN,
+		},
+	)
+	if err != nil {
+		return output, err
+	}
+	s.StackID = *createOut.StackId
+	output.ChangeSetID = *createOut.Id
+
+	describeInput := &cloudformation.DescribeChangeSetInput{
+		ChangeSetName: createOut.Id,
+	}
+	waitErr := s.cfn().WaitUntilChangeSetCreateCompleteWithContext(ctx, describeInput)
+
+	// Read all pages of changes, also finding the reason for any failure
+	var status, statusReason string
+	for {
+		describeOut, err := s.cfn().DescribeChangeSetWithContext(ctx, describeInput)
+		if err != nil {
+			return output, err
+		}
+		status = aws.StringValue(describeOut.Status)
+		statusReason = aws.StringValue(describeOut.StatusReason)
+		output.Changes = append(output.Changes, describeOut.Changes...)
+		if describeOut.NextToken == nil {
+			break
+		}
+		describeInput.NextToken = describeOut.NextToken
+	}
+	if status == cloudformation.ChangeSetStatusFailed {
+		return output, fmt.Errorf("Import change set failed: %s", statusReason)
+	}
+	if waitErr != nil {
+		return output, waitErr
+	}
+	return output, nil
+}
+
+// ExecuteChangeSet will start executing a change set against the stack
+func (s *Stack) ExecuteChangeSet(changeSetID string) error {
+	return s.ExecuteChangeSetWithContext(context.Background(), changeSetID)
+}
+
+// ExecuteChangeSetWithContext performs the same function as ExecuteChangeSet,
+// with a context to cancel the request
+func (s *Stack) ExecuteChangeSetWithContext(ctx context.Context, changeSetID string) (err error) {
+	_, err = s.cfn().ExecuteChangeSetWithContext(
+		ctx,
+		&cloudformation.ExecuteChangeSetInput{
+			ChangeSetName: aws.String(changeSetID),
+		},
+	)
+	return
+}
+
+// DiscardImportChangeSet will delete an import change set which won't be
+// executed, such as one which failed or wasn't approved. If the stack was
+// created along with the change set, the stack is deleted as well, rather than
+// being left behind in REVIEW_IN_PROGRESS
+func (s *Stack) DiscardImportChangeSet(output ImportOut) error {
+	return s.DiscardImportChangeSetWithContext(context.Background(), output)
+}
+
+// DiscardImportChangeSetWithContext performs the same function as
+// DiscardImportChangeSet, with a context to cancel the requests
+func (s *Stack) DiscardImportChangeSetWithContext(ctx context.Context, output ImportOut) error {
+	if err := s.DeleteChangeSetWithContext(ctx, output.ChangeSetID); err != nil {
+		return err
+	}
+	if output.NewStack {
+		return s.DestroyWithContext(ctx)
+	}
+	return nil
+}
+
+// DeleteChangeSet will delete a change set which is no longer required
+func (s *Stack) DeleteChangeSet(changeSetID string) error {
+	return s.DeleteChangeSetWithContext(context.Background(), changeSetID)
+}
+
+// DeleteChangeSetWithContext performs the same function as DeleteChangeSet,
+// with a context to cancel the request
+func (s *Stack) DeleteChangeSetWithContext(ctx context.Context, changeSetID string) (err error) {
+	_, err = s.cfn().DeleteChangeSetWithContext(
+		ctx,
+		&cloudformation.DeleteChangeSetInput{
+			ChangeSetName: aws.String(changeSetID),
+		},
+	)
+	return
+}
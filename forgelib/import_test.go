@@ -0,0 +1,278 @@
+package forgelib
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+)
+
+const importTemplateBody = `---
+Resources:
+  Bucket:
+    Type: AWS::S3::Bucket
+    DeletionPolicy: Retain
+  Table:
+    Type: AWS::DynamoDB::Table
+    DeletionPolicy: Retain
+  Topic:
+    Type: AWS::SNS::Topic
+`
+
+func TestImport(t *testing.T) {
+	cases := []struct {
+		expectChanges []string
+		expectFailure bool
+		expectStacks  []cloudformation.Stack
+		failChangeSet bool
+		importInput   string
+		newStackID    string
+		stacks        []cloudformation.Stack
+	}{
+		// Import into a new stack
+		{
+			importInput:   "---\nTable:\n  TableName: my-table\nBucket:\n  BucketName: my-bucket\n",
+			expectChanges: []string{"Bucket", "Table"},
+			newStackID:    "test-stack/id0",
+			stacks:        []cloudformation.Stack{},
+			expectStacks: []cloudformation.Stack{
+				{
+					StackName:   aws.String("test-stack"),
+					StackId:     aws.String("test-stack/id0"),
+					StackStatus: aws.String(cloudformation.StackStatusImportComplete),
+				},
+			},
+		},
+		// Import into an existing stack
+		{
+			importInput:   `{"Bucket":{"BucketName":"my-bucket"}}`,
+			expectChanges: []string{"Bucket"},
+			stacks: []cloudformation.Stack{
+				{
+					StackName:   aws.String("test-stack"),
+					StackId:     aws.String("test-stack/id1"),
+					StackStatus: aws.String(cloudformation.StackStatusUpdateComplete),
+				},
+			},
+			expectStacks: []cloudformation.Stack{
+				{
+					StackName:   aws.String("test-stack"),
+					StackId:     aws.String("test-stack/id1"),
+					StackStatus: aws.String(cloudformation.StackStatusImportComplete),
+				},
+			},
+		},
+		// Resource without a DeletionPolicy
+		{
+			importInput:   `{"Topic":{"TopicArn":"arn:aws:sns:us-east-1:111111111111:topic"}}`,
+			stacks:        []cloudformation.Stack{},
+			expectFailure: true,
+		},
+		// Resource which isn't in the template
+		{
+			importInput:   `{"Queue":{"QueueUrl":"https://sqs.us-east-1.amazonaws.com/111111111111/queue"}}`,
+			stacks:        []cloudformation.Stack{},
+			expectFailure: true,
+		},
+		// Resource without identifiers
+		{
+			importInput:   `{"Bucket":{}}`,
+			stacks:        []cloudformation.Stack{},
+			expectFailure: true,
+		},
+		// No resources to import
+		{
+			importInput:   `{}`,
+			stacks:        []cloudformation.Stack{},
+			expectFailure: true,
+		},
+		// Change set creation fails
+		{
+			importInput:   `{"Bucket":{"BucketName":"my-bucket"}}`,
+			newStackID:    "test-stack/id0",
+			stacks:        []cloudformation.Stack{},
+			failChangeSet: true,
+			expectFailure: true,
+		},
+	}
+
+	oldCFNClient := defaultClient.cfnClient
+	defer func() { defaultClient.cfnClient = oldCFNClient }()
+	for i, c := range cases {
+		theseStacks := cases[i].stacks
+		theseChangeSets := map[string]*cloudformation.CreateChangeSetInput{}
+		defaultClient.cfnClient = mockCfn{
+			changeSets:    &theseChangeSets,
+			failChangeSet: c.failChangeSet,
+			newStackID:    c.newStackID,
+			stacks:        &theseStacks,
+		}
+
+		thisStack := Stack{
+			ResourcesToImportBody: c.importInput,
+			StackName:             "test-stack",
+			TemplateBody:          importTemplateBody,
+		}
+
+		output, err := thisStack.CreateImportChangeSet()
+		switch {
+		case err == nil && c.expectFailure:
+			t.Errorf("%d, expected error, got success", i)
+			continue
+		case err != nil && !c.expectFailure:
+			t.Fatalf("%d, unexpected error, %v", i, err)
+		case err != nil:
+			continue
+		}
+
+		changes := []string{}
+		for _, change := range output.Changes {
+			if a := *change.ResourceChange.Action; a != cloudformation.ChangeActionImport {
+				t.Errorf("%d, expected %s action, got %s", i, cloudformation.ChangeActionImport, a)
+			}
+			changes = append(changes, *change.ResourceChange.LogicalResourceId)
+		}
+		if !reflect.DeepEqual(c.expectChanges, changes) {
+			t.Errorf("%d, expected changes %v, got %v", i, c.expectChanges, changes)
+		}
+
+		if err := thisStack.ExecuteChangeSet(output.ChangeSetID); err != nil {
+			t.Fatalf("%d, unexpected error, %v", i, err)
+		}
+		for j := 0; j < len(c.expectStacks); j++ {
+			e := genFakeStackData(c.expectStacks[j])
+			g := genFakeStackData(theseStacks[j])
+			if !reflect.DeepEqual(e, g) {
+				t.Errorf("%d, expected %+v, got %+v", i, e, g)
+			}
+		}
+		if e, g := *c.expectStacks[0].StackId, thisStack.StackID; e != g {
+			t.Errorf("%d, expected stack ID \"%s\", got \"%s\"", i, e, g)
+		}
+	}
+}
+
+func TestDeleteChangeSet(t *testing.T) {
+	theseStacks := []cloudformation.Stack{}
+	theseChangeSets := map[string]*cloudformation.CreateChangeSetInput{}
+
+	oldCFNClient := defaultClient.cfnClient
+	defer func() { defaultClient.cfnClient = oldCFNClient }()
+	defaultClient.cfnClient = mockCfn{
+		changeSets: &theseChangeSets,
+		newStackID: "test-stack/id0",
+		stacks:     &theseStacks,
+	}
+
+	s := Stack{
+		ResourcesToImportBody: `{"Bucket":{"BucketName":"my-bucket"}}`,
+		StackName:             "test-stack",
+		TemplateBody:          importTemplateBody,
+	}
+	output, err := s.CreateImportChangeSet()
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	if err := s.DeleteChangeSet(output.ChangeSetID); err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	if g := len(theseChangeSets); g != 0 {
+		t.Errorf("expected no change sets, found %d", g)
+	}
+}
+
+func TestDiscardImportChangeSet(t *testing.T) {
+	cases := []struct {
+		expectStatus  string
+		failChangeSet bool
+		stacks        []cloudformation.Stack
+	}{
+		// The stack which was created with the change set is deleted
+		{
+			expectStatus: cloudformation.StackStatusDeleteComplete,
+			stacks:       []cloudformation.Stack{},
+		},
+		// Including when the change set failed
+		{
+			expectStatus:  cloudformation.StackStatusDeleteComplete,
+			failChangeSet: true,
+			stacks:        []cloudformation.Stack{},
+		},
+		// A stack which already existed is kept
+		{
+			expectStatus: cloudformation.StackStatusUpdateComplete,
+			stacks: []cloudformation.Stack{
+				{
+					StackName:   aws.String("test-stack"),
+					StackId:     aws.String("test-stack/id1"),
+					StackStatus: aws.String(cloudformation.StackStatusUpdateComplete),
+				},
+			},
+		},
+	}
+
+	oldCFNClient := defaultClient.cfnClient
+	defer func() { defaultClient.cfnClient = oldCFNClient }()
+	for i, c := range cases {
+		theseStacks := cases[i].stacks
+		theseChangeSets := map[string]*cloudformation.CreateChangeSetInput{}
+		defaultClient.cfnClient = mockCfn{
+			changeSets:    &theseChangeSets,
+			failChangeSet: c.failChangeSet,
+			newStackID:    "test-stack/id0",
+			stacks:        &theseStacks,
+		}
+
+		s := Stack{
+			ResourcesToImportBody: `{"Bucket":{"BucketName":"my-bucket"}}`,
+			StackName:             "test-stack",
+			TemplateBody:          importTemplateBody,
+		}
+		output, err := s.CreateImportChangeSet()
+		if err != nil && !c.failChangeSet {
+			t.Fatalf("%d, unexpected error, %v", i, err)
+		}
+		if err := s.DiscardImportChangeSet(output); err != nil {
+			t.Fatalf("%d, unexpected error, %v", i, err)
+		}
+
+		if g := len(theseChangeSets); g != 0 {
+			t.Errorf("%d, expected no change sets, found %d", i, g)
+		}
+		if g := len(theseStacks); g != 1 {
+			t.Fatalf("%d, expected 1 stack, found %d", i, g)
+		}
+		if e, g := c.expectStatus, *theseStacks[0].StackStatus; e != g {
+			t.Errorf("%d, expected stack status %s, got %s", i, e, g)
+		}
+	}
+}
+
+func TestCreateImportChangeSetWithCancelledContext(t *testing.T) {
+	theseStacks := []cloudformation.Stack{}
+	theseChangeSets := map[string]*cloudformation.CreateChangeSetInput{}
+
+	oldCFNClient := defaultClient.cfnClient
+	defer func() { defaultClient.cfnClient = oldCFNClient }()
+	defaultClient.cfnClient = mockCfn{
+		changeSets: &theseChangeSets,
+		newStackID: "test-stack/id0",
+		stacks:     &theseStacks,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	s := Stack{
+		ResourcesToImportBody: `{"Bucket":{"BucketName":"my-bucket"}}`,
+		StackName:             "test-stack",
+		TemplateBody:          importTemplateBody,
+	}
+	if _, err := s.CreateImportChangeSetWithContext(ctx); err != context.Canceled {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+	if g := len(theseChangeSets); g != 0 {
+		t.Errorf("expected no change sets, found %d", g)
+	}
+}
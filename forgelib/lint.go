@@ -0,0 +1,258 @@
+package forgelib
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LintSeverity is how serious a problem found by LintTemplate is
+type LintSeverity string
+
+// The severities of lint findings
+const (
+	// CloudFormation would reject the template
+	LintError LintSeverity = "error"
+	// The template is accepted, but probably doesn't do what was intended
+	LintWarning LintSeverity = "warning"
+)
+
+// LintFinding is a problem found in a template, with the position in the
+// template which it was found at
+type LintFinding struct {
+	Column   int
+	Line     int
+	Message  string
+	Rule     string
+	Severity LintSeverity
+}
+
+func (f LintFinding) String() string {
+	return fmt.Sprintf("%d:%d: %s: %s (%s)", f.Line, f.Column, f.Severity, f.Message, f.Rule)
+}
+
+// The limits which CloudFormation puts on templates. Forge sends templates in
+// the request rather than from S3, so the smaller body size applies
+const (
+	maxTemplateBodySize   = 51200
+	maxTemplateMappings   = 200
+	maxTemplateOutputs    = 200
+	maxTemplateParameters = 200
+	maxTemplateResources  = 500
+)
+
+// LintOptions are the optional settings for LintTemplateWithOptions
+type LintOptions struct {
+	// The specification which resource properties are checked against.
+	// Defaults to the one bundled with Forge
+	ResourceSpec *ResourceSpec
+}
+
+// LintTemplate checks a YAML or JSON template for problems which
+// ValidateTemplate doesn't catch, such as references to resources which don't
+// exist, entries which are never used, circular dependencies, templates over
+// the CloudFormation limits, and resource properties which don't match the
+// resource specification. Nothing is sent to AWS, so no credentials are
+// needed. An error is only returned if the template can't be parsed
+func LintTemplate(body []byte) ([]LintFinding, error) {
+	return LintTemplateWithOptions(body, LintOptions{})
+}
+
+// LintTemplateWithOptions performs the same function as LintTemplate, with
+// options for the checks
+func LintTemplateWithOptions(body []byte, options LintOptions) ([]LintFinding, error) {
+	spec := options.ResourceSpec
+	if spec == nil {
+		var err error
+		if spec, err = BundledResourceSpec(); err != nil {
+			return nil, err
+		}
+	}
+	t, err := parseTemplateNodes(body)
+	if err != nil {
+		return nil, err
+	}
+	l := linter{templateNodes: t}
+	l.checkLimits(body)
+	l.checkReferences()
+	l.checkResourceProperties(spec)
+
+	sort.SliceStable(l.findings, func(i, j int) bool {
+		a, b := l.findings[i], l.findings[j]
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return l.findings, nil
+}
+
+type linter struct {
+	*templateNodes
+	findings []LintFinding
+}
+
+func (l *linter) add(severity LintSeverity, rule string, n *yaml.Node, format string, a ...interface{}) {
+	f := LintFinding{
+		Message:  fmt.Sprintf(format, a...),
+		Rule:     rule,
+		Severity: severity,
+	}
+	if n != nil {
+		f.Line, f.Column = n.Line, n.Column
+	}
+	l.findings = append(l.findings, f)
+}
+
+func (l *linter) checkLimits(body []byte) {
+	if len(body) > maxTemplateBodySize {
+		l.add(LintError, "limit", nil, "Template body is %d bytes, over the limit of %d bytes", len(body), maxTemplateBodySize)
+	}
+	limits := []struct {
+		section string
+		entries []templateEntry
+		max     int
+	}{
+		{section: "Mappings", entries: l.mappings, max: maxTemplateMappings},
+		{section: "Outputs", entries: l.outputs, max: maxTemplateOutputs},
+		{section: "Parameters", entries: l.parameters, max: maxTemplateParameters},
+		{section: "Resources", entries: l.resources, max: maxTemplateResources},
+	}
+	for _, limit := range limits {
+		if len(limit.entries) > limit.max {
+			l.add(LintError, "limit", limit.entries[limit.max].key,
+				"Template has %d %s, over the limit of %d", len(limit.entries), strings.ToLower(limit.section), limit.max)
+		}
+	}
+	if _, ok := l.sections["Resources"]; !ok {
+		l.add(LintError, "limit", nil, "Template must declare at least one resource")
+	}
+}
+
+func (l *linter) checkReferences() {
+	defined := func(entries []templateEntry) map[string]bool {
+		names := map[string]bool{}
+		for _, e := range entries {
+			names[e.name] = true
+		}
+		return names
+	}
+	parameters, mappings := defined(l.parameters), defined(l.mappings)
+	conditions, resources := defined(l.conditions), defined(l.resources)
+
+	// Macros can add entries to the template, so missing references can't be
+	// known for certain
+	missing := LintError
+	if _, ok := l.sections["Transform"]; ok {
+		missing = LintWarning
+	}
+
+	used := map[string]bool{}
+	dependencies := map[string][]string{}
+	l.references(func(owner string, r reference) {
+		used[string(r.kind)+"/"+r.target] = true
+		switch r.kind {
+		case referenceRef:
+			if !parameters[r.target] && !resources[r.target] && !pseudoParameters[r.target] {
+				l.add(missing, "missing-reference", r.node, "Ref to %q, which is not a parameter or resource", r.target)
+				return
+			}
+		case referenceGetAtt, referenceDependsOn:
+			if !resources[r.target] {
+				l.add(missing, "missing-reference", r.node, "%s of %q, which is not a resource", r.kind, r.target)
+				return
+			}
+		case referenceFindInMap:
+			if !mappings[r.target] {
+				l.add(missing, "missing-reference", r.node, "Fn::FindInMap of %q, which is not a mapping", r.target)
+			}
+			return
+		case referenceCondition:
+			if !conditions[r.target] {
+				l.add(missing, "missing-reference", r.node, "Condition %q is not defined", r.target)
+			}
+			return
+		}
+		if owner != "" && resources[r.target] {
+			dependencies[owner] = appendUnique(dependencies[owner], r.target)
+		}
+	})
+	// Globals are expanded into the resources by the serverless transform
+	walkReferences(l.sections["Globals"], func(r reference) {
+		used[string(r.kind)+"/"+r.target] = true
+	})
+
+	for _, p := range l.parameters {
+		if !used[string(referenceRef)+"/"+p.name] {
+			l.add(LintWarning, "unused-parameter", p.key, "Parameter %q is not used", p.name)
+		}
+	}
+	for _, m := range l.mappings {
+		if !used[string(referenceFindInMap)+"/"+m.name] {
+			l.add(LintWarning, "unused-mapping", m.key, "Mapping %q is not used", m.name)
+		}
+	}
+	for _, c := range l.conditions {
+		if !used[string(referenceCondition)+"/"+c.name] {
+			l.add(LintWarning, "unused-condition", c.key, "Condition %q is not used", c.name)
+		}
+	}
+
+	l.checkCycles(dependencies)
+}
+
+func appendUnique(list []string, s string) []string {
+	for _, e := range list {
+		if e == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
+
+// checkCycles reports each circular dependency between resources once, at the
+// first resource in the template which is part of it
+func (l *linter) checkCycles(dependencies map[string][]string) {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := map[string]int{}
+	keys := map[string]*yaml.Node{}
+	for _, r := range l.resources {
+		keys[r.name] = r.key
+	}
+
+	var path []string
+	var visit func(name string)
+	visit = func(name string) {
+		state[name] = visiting
+		path = append(path, name)
+		for _, d := range dependencies[name] {
+			switch state[d] {
+			case unvisited:
+				visit(d)
+			case visiting:
+				var cycle []string
+				for i := len(path) - 1; i >= 0; i-- {
+					if path[i] == d {
+						cycle = append([]string{}, path[i:]...)
+						break
+					}
+				}
+				l.add(LintError, "circular-dependency", keys[cycle[0]],
+					"Circular dependency between resources: %s -> %s", strings.Join(cycle, " -> "), cycle[0])
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+	}
+	for _, r := range l.resources {
+		if state[r.name] == unvisited {
+			visit(r.name)
+		}
+	}
+}
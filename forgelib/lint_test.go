@@ -0,0 +1,152 @@
+package forgelib
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestLintTemplate(t *testing.T) {
+	manyResources := "Resources:\n"
+	for i := 0; i <= maxTemplateResources; i++ {
+		manyResources += fmt.Sprintf("  Topic%d: {Type: AWS::SNS::Topic}\n", i)
+	}
+
+	cases := []struct {
+		body           string
+		expectFindings []string
+	}{
+		// Short-form tags
+		{
+			body: `
+Parameters:
+  Env:
+    Type: String
+  Unused:
+    Type: String
+Mappings:
+  Regions:
+    us-east-1: {Name: virginia}
+Conditions:
+  IsProd: !Equals [!Ref Env, prod]
+  Unused: !Condition IsProd
+  Undefined: !Condition Missing
+Resources:
+  Bucket:
+    Type: AWS::S3::Bucket
+    Properties:
+      BucketName: !Sub "${Env}-${AWS::Region}-${!Literal}"
+  Topic:
+    Type: AWS::SNS::Topic
+    DependsOn: [Bucket, Ghost]
+    Properties:
+      DisplayName: !FindInMap [Regions, !Ref "AWS::Region", Name]
+      TopicName: !GetAtt Nope.Name
+Outputs:
+  Bucket:
+    Condition: IsProd
+    Value: !If [IsProd, !Ref Bucket, !Ref "AWS::NoValue"]
+`,
+			expectFindings: []string{
+				`5:3: warning: Parameter "Unused" is not used (unused-parameter)`,
+				`12:3: warning: Condition "Unused" is not used (unused-condition)`,
+				`13:3: warning: Condition "Undefined" is not used (unused-condition)`,
+				`13:14: error: Condition "Missing" is not defined (missing-reference)`,
+				`21:25: error: DependsOn of "Ghost", which is not a resource (missing-reference)`,
+				`24:18: error: Fn::GetAtt of "Nope", which is not a resource (missing-reference)`,
+			},
+		},
+		// Full-form functions in JSON, and local Fn::Sub variables
+		{
+			body: `{
+  "Mappings": {"Unused": {"a": {"b": "c"}}},
+  "Resources": {
+    "Role": {"Type": "AWS::IAM::Role", "Properties": {
+      "RoleName": {"Fn::Sub": ["${Prefix}-role", {"Prefix": {"Ref": "Missing"}}]},
+      "AssumeRolePolicyDocument": {"Statement": [{"Effect": "Allow", "Condition": {"Bool": {"aws:SecureTransport": "true"}}}]}
+    }}
+  }
+}`,
+			expectFindings: []string{
+				`2:16: warning: Mapping "Unused" is not used (unused-mapping)`,
+				`5:69: error: Ref to "Missing", which is not a parameter or resource (missing-reference)`,
+			},
+		},
+		// Circular dependencies are reported once
+		{
+			body: `
+Resources:
+  A:
+    Type: AWS::SNS::Topic
+    Properties:
+      TopicName: !Sub "${B.TopicName}"
+  B:
+    Type: AWS::SNS::Topic
+    DependsOn: C
+  C:
+    Type: AWS::SNS::Topic
+    Properties:
+      TopicName: !GetAtt [A, TopicName]
+  D:
+    Type: AWS::SNS::Topic
+    Properties:
+      TopicName: {Ref: D}
+`,
+			expectFindings: []string{
+				`3:3: error: Circular dependency between resources: A -> B -> C -> A (circular-dependency)`,
+				`14:3: error: Circular dependency between resources: D -> D (circular-dependency)`,
+			},
+		},
+		// Macros may add the missing entries
+		{
+			body: `
+Transform: AWS::Serverless-2016-10-31
+Resources:
+  Function:
+    Type: AWS::Serverless::Function
+Outputs:
+  Role:
+    Value: !GetAtt FunctionRole.Arn
+`,
+			expectFindings: []string{
+				`5:11: warning: Resource type "AWS::Serverless::Function" is not in the resource specification (resource-type)`,
+				`8:12: warning: Fn::GetAtt of "FunctionRole", which is not a resource (missing-reference)`,
+			},
+		},
+		{
+			body: manyResources,
+			expectFindings: []string{
+				`502:3: error: Template has 501 resources, over the limit of 500 (limit)`,
+			},
+		},
+		{
+			body: "Description: " + strings.Repeat("a", maxTemplateBodySize),
+			expectFindings: []string{
+				`0:0: error: Template body is 51213 bytes, over the limit of 51200 bytes (limit)`,
+				`0:0: error: Template must declare at least one resource (limit)`,
+			},
+		},
+	}
+
+	for i, c := range cases {
+		findings, err := LintTemplate([]byte(c.body))
+		if err != nil {
+			t.Fatalf("%d, unexpected error, %v", i, err)
+		}
+		got := []string{}
+		for _, f := range findings {
+			got = append(got, f.String())
+		}
+		if e, g := strings.Join(c.expectFindings, "\n"), strings.Join(got, "\n"); e != g {
+			t.Errorf("%d, expected findings:\n%s\ngot:\n%s", i, e, g)
+		}
+	}
+}
+
+func TestLintTemplateInvalid(t *testing.T) {
+	for i, body := range []string{"", "- a list", "Resources: ["} {
+		if _, err := LintTemplate([]byte(body)); err == nil {
+			t.Errorf("%d, expected error, got success", i)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package forgelib
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// cachedRoleProvider uses the cached credentials of a role assumed with MFA
+// while they last, and otherwise assumes the role and caches the credentials
+type cachedRoleProvider struct {
+	credentials.Expiry
+	provider *stscreds.AssumeRoleProvider
+}
+
+func newCachedRoleProvider(provider *stscreds.AssumeRoleProvider) *cachedRoleProvider {
+	return &cachedRoleProvider{provider: provider}
+}
+
+// Retrieve returns the cached credentials, or those of a new role session
+func (p *cachedRoleProvider) Retrieve() (credentials.Value, error) {
+	key := roleCacheKey{
+		roleArn:         p.provider.RoleARN,
+		roleSessionName: p.provider.RoleSessionName,
+		mfaSerial:       aws.StringValue(p.provider.SerialNumber),
+	}
+	if cached := readCachedRoleCredentials(key); cached != nil {
+		p.SetExpiration(aws.TimeValue(cached.Expiration), credentialsExpiryWindow)
+		return credentials.Value{
+			AccessKeyID:     aws.StringValue(cached.AccessKeyId),
+			SecretAccessKey: aws.StringValue(cached.SecretAccessKey),
+			SessionToken:    aws.StringValue(cached.SessionToken),
+			ProviderName:    stscreds.ProviderName,
+		}, nil
+	}
+
+	value, err := p.provider.Retrieve()
+	if err != nil {
+		return value, err
+	}
+	// The provider expires its credentials early by the expiry window
+	expiration := p.provider.ExpiresAt().Add(p.provider.ExpiryWindow)
+	p.SetExpiration(expiration, credentialsExpiryWindow)
+	// The cache only saves asking for another token, so the credentials can
+	// still be used if they can't be cached
+	_ = writeCachedRoleCredentials(key, &sts.Credentials{
+		AccessKeyId:     aws.String(value.AccessKeyID),
+		SecretAccessKey: aws.String(value.SecretAccessKey),
+		SessionToken:    aws.String(value.SessionToken),
+		Expiration:      aws.Time(expiration),
+	})
+	return value, nil
+}
+
+// roleCacheKey identifies the role session which credentials are cached for
+type roleCacheKey struct {
+	roleArn         string
+	roleSessionName string
+	mfaSerial       string
+}
+
+type cachedRoleCredentials struct {
+	AccessKeyID     string    `json:"AccessKeyId"`
+	SecretAccessKey string    `json:"SecretAccessKey"`
+	SessionToken    string    `json:"SessionToken"`
+	Expiration      time.Time `json:"Expiration"`
+}
+
+// roleCachePath returns the file which the credentials of a role session are
+// cached in, under the cache directory of the user
+func roleCachePath(key roleCacheKey) (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(key.roleArn + "\n" + key.roleSessionName + "\n" + key.mfaSerial))
+	return filepath.Join(cacheDir, "forge", "role-credentials", hex.EncodeToString(sum[:])+".json"), nil
+}
+
+// readCachedRoleCredentials returns the cached credentials of a role session,
+// or nil if there aren't any which are still usable. Credentials are usable
+// until they're inside of the same expiry window as any other credentials
+func readCachedRoleCredentials(key roleCacheKey) *sts.Credentials {
+	path, err := roleCachePath(key)
+	if err != nil {
+		return nil
+	}
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var cached cachedRoleCredentials
+	if err := json.Unmarshal(body, &cached); err != nil {
+		return nil
+	}
+	if cached.AccessKeyID == "" || time.Until(cached.Expiration) <= credentialsExpiryWindow {
+		return nil
+	}
+	return &sts.Credentials{
+		AccessKeyId:     aws.String(cached.AccessKeyID),
+		SecretAccessKey: aws.String(cached.SecretAccessKey),
+		SessionToken:    aws.String(cached.SessionToken),
+		Expiration:      aws.Time(cached.Expiration),
+	}
+}
+
+// writeCachedRoleCredentials caches the credentials of a role session, in a
+// file which only the current user can read
+func writeCachedRoleCredentials(key roleCacheKey, creds *sts.Credentials) error {
+	path, err := roleCachePath(key)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(cachedRoleCredentials{
+		AccessKeyID:     aws.StringValue(creds.AccessKeyId),
+		SecretAccessKey: aws.StringValue(creds.SecretAccessKey),
+		SessionToken:    aws.StringValue(creds.SessionToken),
+		Expiration:      aws.TimeValue(creds.Expiration),
+	})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first, so that a forge command running at the
+	// same time never reads a partially written file
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".role-credentials-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
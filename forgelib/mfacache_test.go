@@ -0,0 +1,156 @@
+package forgelib
+
+import (
+	"os"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+func TestCachedRoleCredentials(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("LocalAppData", t.TempDir())
+
+	key := roleCacheKey{
+		roleArn:         "arn:aws:iam::222222222222:role/test-role",
+		roleSessionName: "nathan",
+		mfaSerial:       "arn:aws:iam::111111111111:mfa/nathan",
+	}
+
+	cases := []struct {
+		expiry      time.Duration
+		key         roleCacheKey
+		expectCache bool
+	}{
+		{expiry: time.Hour, key: key, expectCache: true},
+		// Used until the credentials are inside of the expiry window
+		{expiry: 10 * time.Minute, key: key, expectCache: true},
+		{expiry: 5 * time.Minute, key: key, expectCache: false},
+		{expiry: -time.Hour, key: key, expectCache: false},
+		// Cached for a different role, session name or MFA device
+		{
+			expiry:      time.Hour,
+			key:         roleCacheKey{roleArn: "arn:aws:iam::222222222222:role/other-role", roleSessionName: key.roleSessionName, mfaSerial: key.mfaSerial},
+			expectCache: false,
+		},
+		{
+			expiry:      time.Hour,
+			key:         roleCacheKey{roleArn: key.roleArn, roleSessionName: "pipeline-1234", mfaSerial: key.mfaSerial},
+			expectCache: false,
+		},
+		{
+			expiry:      time.Hour,
+			key:         roleCacheKey{roleArn: key.roleArn, roleSessionName: key.roleSessionName, mfaSerial: "arn:aws:iam::111111111111:mfa/other"},
+			expectCache: false,
+		},
+	}
+
+	for i, c := range cases {
+		path, err := roleCachePath(key)
+		if err != nil {
+			t.Fatalf("%d, unexpected error, %v", i, err)
+		}
+		os.Remove(path)
+
+		creds := &sts.Credentials{
+			AccessKeyId:     aws.String("AKIACACHED"),
+			SecretAccessKey: aws.String("secret"),
+			SessionToken:    aws.String("token"),
+			Expiration:      aws.Time(time.Now().Add(c.expiry)),
+		}
+		if err := writeCachedRoleCredentials(c.key, creds); err != nil {
+			t.Fatalf("%d, unexpected error, %v", i, err)
+		}
+
+		cached := readCachedRoleCredentials(key)
+		if c.expectCache {
+			if cached == nil {
+				t.Fatalf("%d, expected cached credentials, got none", i)
+			}
+			if e, g := "AKIACACHED", aws.StringValue(cached.AccessKeyId); e != g {
+				t.Errorf("%d, expected access key %s, got %s", i, e, g)
+			}
+			if runtime.GOOS != "windows" {
+				info, err := os.Stat(path)
+				if err != nil {
+					t.Fatalf("%d, unexpected error, %v", i, err)
+				}
+				if e, g := os.FileMode(0600), info.Mode().Perm(); e != g {
+					t.Errorf("%d, expected file mode %v, got %v", i, e, g)
+				}
+			}
+		} else if cached != nil {
+			t.Errorf("%d, expected no cached credentials, got %v", i, cached)
+		}
+	}
+}
+
+func TestAssumeRoleWithCachedCredentials(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("LocalAppData", t.TempDir())
+
+	oldCFNClient, oldIAMClient, oldS3Client, oldSTSClient := defaultClient.cfnClient, defaultClient.iamClient, defaultClient.s3Client, defaultClient.stsClient
+	oldSTSClientFactory := defaultClient.stsClientFactory
+	defer func() {
+		defaultClient.cfnClient, defaultClient.iamClient, defaultClient.s3Client, defaultClient.stsClient = oldCFNClient, oldIAMClient, oldS3Client, oldSTSClient
+		defaultClient.stsClientFactory = oldSTSClientFactory
+	}()
+
+	var inputs []sts.AssumeRoleInput
+	thisSTSClient := mockSTS{
+		accountID:        "111111111111",
+		assumeRoleInputs: &inputs,
+		callerArn:        "arn:aws:iam::111111111111:user/nathan",
+	}
+	defaultClient.stsClientFactory = mockSTSClients(t, thisSTSClient)
+
+	tokenRequests := 0
+	options := AssumeRoleOptions{
+		CacheMFASession: true,
+		MFASerial:       "arn:aws:iam::111111111111:mfa/nathan",
+		MFATokenProvider: func() (string, error) {
+			tokenRequests++
+			return "123456", nil
+		},
+	}
+
+	// Each run of Forge starts again from the original credentials
+	for i := 0; i < 3; i++ {
+		defaultClient.stsClient = thisSTSClient
+		if err := AssumeRoleWithOptions("arn:aws:iam::222222222222:role/test-role", options); err != nil {
+			t.Fatalf("%d, unexpected error, %v", i, err)
+		}
+	}
+
+	if e, g := 1, tokenRequests; e != g {
+		t.Errorf("expected MFA token to be asked for %d time, got %d", e, g)
+	}
+	if e, g := 1, len(inputs); e != g {
+		t.Errorf("expected role to be assumed %d time, got %d", e, g)
+	}
+
+	// A different role session doesn't use the cached credentials
+	options.RoleSessionName = "pipeline-1234"
+	defaultClient.stsClient = thisSTSClient
+	if err := AssumeRoleWithOptions("arn:aws:iam::222222222222:role/test-role", options); err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	if e, g := 2, tokenRequests; e != g {
+		t.Errorf("expected MFA token to be asked for %d times, got %d", e, g)
+	}
+
+	// Without the cache, a token is needed every time
+	options.CacheMFASession = false
+	defaultClient.stsClient = thisSTSClient
+	if err := AssumeRoleWithOptions("arn:aws:iam::222222222222:role/test-role", options); err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	if e, g := 3, tokenRequests; e != g {
+		t.Errorf("expected MFA token to be asked for %d times, got %d", e, g)
+	}
+}
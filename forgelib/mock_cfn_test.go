@@ -5,21 +5,30 @@ import (
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/cloudformation"
 	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
 )
 
 type mockCfn struct {
-	capabilityIam      bool
-	failCreate         bool
-	failDescribe       bool
-	failValidate       bool
-	newStackID         string
-	noUpdates          bool
-	requiredParameters []string
-	stackEventsOutput  cloudformation.DescribeStackEventsOutput
-	stackPolicies      *map[string]string
-	stacks             *[]cloudformation.Stack
+	capabilityIam             bool
+	changeSets                *map[string]*cloudformation.CreateChangeSetInput
+	failChangeSet             bool
+	failCreate                bool
+	failDescribe              bool
+	failValidate              bool
+	imports                   map[string][]string
+	newStackID                string
+	noEchoParameters          []string
+	noUpdates                 bool
+	parameterDefaults         map[string]string
+	requiredParameters        []string
+	stackEventsOutput         cloudformation.DescribeStackEventsOutput
+	stackPolicies             *map[string]string
+	stackPoliciesDuringUpdate *map[string]string
+	stackResources            []*cloudformation.StackResourceSummary
+	stacks                    *[]cloudformation.Stack
+	templateBody              string
 	cloudformationiface.CloudFormationAPI
 }
 
@@ -52,6 +61,14 @@ func (m mockCfn) ValidateTemplate(*cloudformation.ValidateTemplateInput) (*cloud
 	}
 	for _, r := range m.requiredParameters {
 		thisParameter := cloudformation.TemplateParameter{ParameterKey: aws.String(r)}
+		for _, n := range m.noEchoParameters {
+			if n == r {
+				thisParameter.NoEcho = aws.Bool(true)
+			}
+		}
+		if d, ok := m.parameterDefaults[r]; ok {
+			thisParameter.DefaultValue = aws.String(d)
+		}
 		output.Parameters = append(output.Parameters, &thisParameter)
 	}
 	return &output, nil
@@ -78,6 +95,9 @@ func (m mockCfn) CreateStack(input *cloudformation.CreateStackInput) (*cloudform
 	// Check that all required parameters are supplied
 REQUIRED_PARAMETERS:
 	for _, r := range m.requiredParameters {
+		if _, ok := m.parameterDefaults[r]; ok {
+			continue
+		}
 		for _, s := range input.Parameters {
 			if r == *s.ParameterKey {
 				continue REQUIRED_PARAMETERS
@@ -108,6 +128,7 @@ REQUIRED_PARAMETERS:
 		StackStatus:                 aws.String(cloudformation.StackStatusCreateComplete),
 		Tags:                        input.Tags,
 		Parameters:                  input.Parameters,
+		NotificationARNs:            input.NotificationARNs,
 		RoleARN:                     input.RoleARN,
 		EnableTerminationProtection: input.EnableTerminationProtection,
 	}
@@ -141,6 +162,9 @@ func (m mockCfn) UpdateStack(input *cloudformation.UpdateStackInput) (*cloudform
 	// Check that all required parameters are supplied
 REQUIRED_PARAMETERS:
 	for _, r := range m.requiredParameters {
+		if _, ok := m.parameterDefaults[r]; ok {
+			continue
+		}
 		for _, s := range input.Parameters {
 			if r == *s.ParameterKey {
 				continue REQUIRED_PARAMETERS
@@ -168,10 +192,16 @@ REQUIRED_PARAMETERS:
 				(*m.stacks)[i].RoleARN = input.RoleARN
 				(*m.stacks)[i].Tags = input.Tags
 				(*m.stacks)[i].Parameters = input.Parameters
+				if input.NotificationARNs != nil {
+					(*m.stacks)[i].NotificationARNs = input.NotificationARNs
+				}
 
 				if input.StackPolicyBody != nil {
 					(*m.stackPolicies)[*(*m.stacks)[i].StackId] = *input.StackPolicyBody
 				}
+				if input.StackPolicyDuringUpdateBody != nil {
+					(*m.stackPoliciesDuringUpdate)[*(*m.stacks)[i].StackId] = *input.StackPolicyDuringUpdateBody
+				}
 
 				output.StackId = &m.newStackID
 				return &output, nil
@@ -252,6 +282,11 @@ func (m mockCfn) DescribeStackEventsPages(input *cloudformation.DescribeStackEve
 	return nil
 }
 
+func (m mockCfn) DescribeStackEvents(input *cloudformation.DescribeStackEventsInput) (*cloudformation.DescribeStackEventsOutput, error) {
+	output := m.stackEventsOutput
+	return &output, nil
+}
+
 func (m mockCfn) UpdateTerminationProtection(input *cloudformation.UpdateTerminationProtectionInput) (*cloudformation.UpdateTerminationProtectionOutput, error) {
 	output := cloudformation.UpdateTerminationProtectionOutput{}
 	// For each existing stack, match against the stack ID first, then the stack
@@ -278,3 +313,297 @@ STACK_LOOP:
 		nil,
 	)
 }
+
+func (m mockCfn) GetTemplate(input *cloudformation.GetTemplateInput) (*cloudformation.GetTemplateOutput, error) {
+	output := cloudformation.GetTemplateOutput{
+		TemplateBody: aws.String(m.templateBody),
+	}
+	return &output, nil
+}
+
+func (m mockCfn) ListStackResourcesPages(input *cloudformation.ListStackResourcesInput, function func(*cloudformation.ListStackResourcesOutput, bool) bool) error {
+	// Paginate resources to test that the destination functions concatenate
+	// the entries correctly
+	for i := 0; i < len(m.stackResources); i++ {
+		thisOutput := &cloudformation.ListStackResourcesOutput{
+			StackResourceSummaries: []*cloudformation.StackResourceSummary{
+				m.stackResources[i],
+			},
+		}
+		if nextPage := function(thisOutput, i == len(m.stackResources)-1); !nextPage {
+			return nil
+		}
+	}
+	return nil
+}
+
+func (m mockCfn) ListImportsPages(input *cloudformation.ListImportsInput, function func(*cloudformation.ListImportsOutput, bool) bool) error {
+	imports := m.imports[*input.ExportName]
+	if len(imports) == 0 {
+		return awserr.New(
+			"ValidationError",
+			fmt.Sprintf("Export '%s' is not imported by any stack.", *input.ExportName),
+			nil,
+		)
+	}
+	for i := 0; i < len(imports); i++ {
+		thisOutput := &cloudformation.ListImportsOutput{
+			Imports: []*string{aws.String(imports[i])},
+		}
+		if nextPage := function(thisOutput, i == len(imports)-1); !nextPage {
+			return nil
+		}
+	}
+	return nil
+}
+
+func (m mockCfn) GetStackPolicy(input *cloudformation.GetStackPolicyInput) (*cloudformation.GetStackPolicyOutput, error) {
+	output := cloudformation.GetStackPolicyOutput{}
+	if p, ok := (*m.stackPolicies)[*input.StackName]; ok {
+		output.StackPolicyBody = aws.String(p)
+	}
+	return &output, nil
+}
+
+func (m mockCfn) SetStackPolicy(input *cloudformation.SetStackPolicyInput) (*cloudformation.SetStackPolicyOutput, error) {
+	(*m.stackPolicies)[*input.StackName] = *input.StackPolicyBody
+	return &cloudformation.SetStackPolicyOutput{}, nil
+}
+
+func (m mockCfn) CreateChangeSet(input *cloudformation.CreateChangeSetInput) (*cloudformation.CreateChangeSetOutput, error) {
+	output := cloudformation.CreateChangeSetOutput{
+		Id:      aws.String(fmt.Sprintf("changeset/%s", *input.ChangeSetName)),
+		StackId: aws.String(m.newStackID),
+	}
+	var exists bool
+	for i := 0; i < len(*m.stacks); i++ {
+		if *(*m.stacks)[i].StackName == *input.StackName &&
+			*(*m.stacks)[i].StackStatus != cloudformation.StackStatusDeleteComplete {
+			output.StackId = (*m.stacks)[i].StackId
+			exists = true
+		}
+	}
+	// The stack is created straight away, but has no resources until the
+	// change set is executed
+	if !exists {
+		*m.stacks = append(*m.stacks, cloudformation.Stack{
+			StackName:   input.StackName,
+			StackId:     aws.String(m.newStackID),
+			StackStatus: aws.String(cloudformation.StackStatusReviewInProgress),
+			Tags:        input.Tags,
+			Parameters:  input.Parameters,
+			RoleARN:     input.RoleARN,
+		})
+	}
+	(*m.changeSets)[*output.Id] = input
+	return &output, nil
+}
+
+func (m mockCfn) WaitUntilChangeSetCreateComplete(input *cloudformation.DescribeChangeSetInput) error {
+	if m.failChangeSet {
+		return awserr.New("ResourceNotReady", "failed waiting for successful resource state", nil)
+	}
+	return nil
+}
+
+func (m mockCfn) DescribeChangeSet(input *cloudformation.DescribeChangeSetInput) (*cloudformation.DescribeChangeSetOutput, error) {
+	changeSet, ok := (*m.changeSets)[*input.ChangeSetName]
+	if !ok {
+		return nil, awserr.New(
+			cloudformation.ErrCodeChangeSetNotFoundException,
+			fmt.Sprintf("ChangeSet [%s] does not exist", *input.ChangeSetName),
+			nil,
+		)
+	}
+	output := cloudformation.DescribeChangeSetOutput{
+		ChangeSetId: input.ChangeSetName,
+		Status:      aws.String(cloudformation.ChangeSetStatusCreateComplete),
+	}
+	if m.failChangeSet {
+		output.Status = aws.String(cloudformation.ChangeSetStatusFailed)
+		output.StatusReason = aws.String("Simulated Failure")
+	}
+
+	// Paginate changes, one resource per page
+	var page int
+	if input.NextToken != nil {
+		fmt.Sscanf(*input.NextToken, "%d", &page)
+	}
+	if page < len(changeSet.ResourcesToImport) {
+		r := changeSet.ResourcesToImport[page]
+		output.Changes = []*cloudformation.Change{
+			{
+				Type: aws.String(cloudformation.ChangeTypeResource),
+				ResourceChange: &cloudformation.ResourceChange{
+					Action:            aws.String(cloudformation.ChangeActionImport),
+					LogicalResourceId: r.LogicalResourceId,
+					ResourceType:      r.ResourceType,
+				},
+			},
+		}
+	}
+	if page+1 < len(changeSet.ResourcesToImport) {
+		output.NextToken = aws.String(fmt.Sprintf("%d", page+1))
+	}
+	return &output, nil
+}
+
+func (m mockCfn) ExecuteChangeSet(input *cloudformation.ExecuteChangeSetInput) (*cloudformation.ExecuteChangeSetOutput, error) {
+	changeSet, ok := (*m.changeSets)[*input.ChangeSetName]
+	if !ok {
+		return nil, awserr.New(
+			cloudformation.ErrCodeChangeSetNotFoundException,
+			fmt.Sprintf("ChangeSet [%s] does not exist", *input.ChangeSetName),
+			nil,
+		)
+	}
+	for i := 0; i < len(*m.stacks); i++ {
+		if *(*m.stacks)[i].StackName == *changeSet.StackName &&
+			*(*m.stacks)[i].StackStatus != cloudformation.StackStatusDeleteComplete {
+			*(*m.stacks)[i].StackStatus = cloudformation.StackStatusImportComplete
+		}
+	}
+	delete(*m.changeSets, *input.ChangeSetName)
+	return &cloudformation.ExecuteChangeSetOutput{}, nil
+}
+
+func (m mockCfn) DeleteChangeSet(input *cloudformation.DeleteChangeSetInput) (*cloudformation.DeleteChangeSetOutput, error) {
+	delete(*m.changeSets, *input.ChangeSetName)
+	return &cloudformation.DeleteChangeSetOutput{}, nil
+}
+
+func (m mockCfn) CancelUpdateStack(input *cloudformation.CancelUpdateStackInput) (*cloudformation.CancelUpdateStackOutput, error) {
+	for i := 0; i < len(*m.stacks); i++ {
+		if *(*m.stacks)[i].StackId == *input.StackName {
+			if *(*m.stacks)[i].StackStatus != cloudformation.StackStatusUpdateInProgress {
+				return nil, awserr.New(
+					"ValidationError",
+					fmt.Sprintf("CancelUpdateStack cannot be called from current stack status %s", *(*m.stacks)[i].StackStatus),
+					nil,
+				)
+			}
+			(*m.stacks)[i].StackStatus = aws.String(cloudformation.StackStatusUpdateRollbackInProgress)
+			return &cloudformation.CancelUpdateStackOutput{}, nil
+		}
+	}
+	return nil, awserr.New(
+		"ValidationError",
+		fmt.Sprintf("Stack with id %s does not exist", *input.StackName),
+		nil,
+	)
+}
+
+// The context variants fail when the context is done, as the SDK would, and
+// otherwise behave the same as the calls above
+
+func (m mockCfn) ValidateTemplateWithContext(ctx aws.Context, input *cloudformation.ValidateTemplateInput, opts ...request.Option) (*cloudformation.ValidateTemplateOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return m.ValidateTemplate(input)
+}
+
+func (m mockCfn) CreateStackWithContext(ctx aws.Context, input *cloudformation.CreateStackInput, opts ...request.Option) (*cloudformation.CreateStackOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return m.CreateStack(input)
+}
+
+func (m mockCfn) UpdateStackWithContext(ctx aws.Context, input *cloudformation.UpdateStackInput, opts ...request.Option) (*cloudformation.UpdateStackOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return m.UpdateStack(input)
+}
+
+func (m mockCfn) DescribeStacksWithContext(ctx aws.Context, input *cloudformation.DescribeStacksInput, opts ...request.Option) (*cloudformation.DescribeStacksOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return m.DescribeStacks(input)
+}
+
+func (m mockCfn) DeleteStackWithContext(ctx aws.Context, input *cloudformation.DeleteStackInput, opts ...request.Option) (*cloudformation.DeleteStackOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return m.DeleteStack(input)
+}
+
+func (m mockCfn) DescribeStackEventsWithContext(ctx aws.Context, input *cloudformation.DescribeStackEventsInput, opts ...request.Option) (*cloudformation.DescribeStackEventsOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return m.DescribeStackEvents(input)
+}
+
+func (m mockCfn) DescribeStackEventsPagesWithContext(ctx aws.Context, input *cloudformation.DescribeStackEventsInput, function func(*cloudformation.DescribeStackEventsOutput, bool) bool, opts ...request.Option) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return m.DescribeStackEventsPages(input, function)
+}
+
+func (m mockCfn) UpdateTerminationProtectionWithContext(ctx aws.Context, input *cloudformation.UpdateTerminationProtectionInput, opts ...request.Option) (*cloudformation.UpdateTerminationProtectionOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return m.UpdateTerminationProtection(input)
+}
+
+func (m mockCfn) GetStackPolicyWithContext(ctx aws.Context, input *cloudformation.GetStackPolicyInput, opts ...request.Option) (*cloudformation.GetStackPolicyOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return m.GetStackPolicy(input)
+}
+
+func (m mockCfn) SetStackPolicyWithContext(ctx aws.Context, input *cloudformation.SetStackPolicyInput, opts ...request.Option) (*cloudformation.SetStackPolicyOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return m.SetStackPolicy(input)
+}
+
+func (m mockCfn) CancelUpdateStackWithContext(ctx aws.Context, input *cloudformation.CancelUpdateStackInput, opts ...request.Option) (*cloudformation.CancelUpdateStackOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return m.CancelUpdateStack(input)
+}
+
+func (m mockCfn) CreateChangeSetWithContext(ctx aws.Context, input *cloudformation.CreateChangeSetInput, opts ...request.Option) (*cloudformation.CreateChangeSetOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return m.CreateChangeSet(input)
+}
+
+func (m mockCfn) WaitUntilChangeSetCreateCompleteWithContext(ctx aws.Context, input *cloudformation.DescribeChangeSetInput, opts ...request.WaiterOption) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return m.WaitUntilChangeSetCreateComplete(input)
+}
+
+func (m mockCfn) DescribeChangeSetWithContext(ctx aws.Context, input *cloudformation.DescribeChangeSetInput, opts ...request.Option) (*cloudformation.DescribeChangeSetOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return m.DescribeChangeSet(input)
+}
+
+func (m mockCfn) ExecuteChangeSetWithContext(ctx aws.Context, input *cloudformation.ExecuteChangeSetInput, opts ...request.Option) (*cloudformation.ExecuteChangeSetOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return m.ExecuteChangeSet(input)
+}
+
+func (m mockCfn) DeleteChangeSetWithContext(ctx aws.Context, input *cloudformation.DeleteChangeSetInput, opts ...request.Option) (*cloudformation.DeleteChangeSetOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return m.DeleteChangeSet(input)
+}
@@ -0,0 +1,78 @@
+package forgelib
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+type mockS3 struct {
+	// Object versions by bucket name. Versions without a key are treated as
+	// delete markers
+	buckets      *map[string][]s3.ObjectIdentifier
+	deleteCalls  *int
+	largestBatch *int
+	s3iface.S3API
+}
+
+func (m mockS3) ListObjectVersionsPages(input *s3.ListObjectVersionsInput, function func(*s3.ListObjectVersionsOutput, bool) bool) error {
+	versions, ok := (*m.buckets)[*input.Bucket]
+	if !ok {
+		return awserr.New(s3.ErrCodeNoSuchBucket, "The specified bucket does not exist", nil)
+	}
+	// Copy the listing first, as deletions may happen while paginating
+	listing := append([]s3.ObjectIdentifier{}, versions...)
+
+	// Split versions and delete markers across pages the same way that S3
+	// does, with a maximum of 1000 entries per page
+	pageSize := 1000
+	for i := 0; i < len(listing); i += pageSize {
+		thisOutput := &s3.ListObjectVersionsOutput{}
+		end := i + pageSize
+		if end > len(listing) {
+			end = len(listing)
+		}
+		for _, v := range listing[i:end] {
+			if aws.StringValue(v.VersionId) == "delete-marker" {
+				thisOutput.DeleteMarkers = append(thisOutput.DeleteMarkers, &s3.DeleteMarkerEntry{
+					Key:       v.Key,
+					VersionId: v.VersionId,
+				})
+			} else {
+				thisOutput.Versions = append(thisOutput.Versions, &s3.ObjectVersion{
+					Key:       v.Key,
+					VersionId: v.VersionId,
+				})
+			}
+		}
+		if nextPage := function(thisOutput, end == len(listing)); !nextPage {
+			return nil
+		}
+	}
+	return nil
+}
+
+func (m mockS3) DeleteObjects(input *s3.DeleteObjectsInput) (*s3.DeleteObjectsOutput, error) {
+	output := s3.DeleteObjectsOutput{}
+	*m.deleteCalls++
+	if l := len(input.Delete.Objects); l > *m.largestBatch {
+		*m.largestBatch = l
+	}
+	if len(input.Delete.Objects) > 1000 {
+		return &output, awserr.New("MalformedXML", "The XML you provided was not well-formed", nil)
+	}
+
+	remaining := []s3.ObjectIdentifier{}
+EXISTING_OBJECTS:
+	for _, v := range (*m.buckets)[*input.Bucket] {
+		for _, d := range input.Delete.Objects {
+			if *v.Key == *d.Key && *v.VersionId == *d.VersionId {
+				continue EXISTING_OBJECTS
+			}
+		}
+		remaining = append(remaining, v)
+	}
+	(*m.buckets)[*input.Bucket] = remaining
+	return &output, nil
+}
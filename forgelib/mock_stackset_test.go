@@ -0,0 +1,236 @@
+package forgelib
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+)
+
+type mockStackSet struct {
+	instances      []*cloudformation.StackInstanceSummary
+	permissionMode string
+	templateBody   string
+}
+
+type mockStackSets struct {
+	failAccounts map[string]bool
+	operations   *map[string][]*cloudformation.StackSetOperationResultSummary
+	// Counts the request options which operations are polled with, if set
+	pollOptions *int
+	// How many more times operations are described as running, if set
+	runningPolls *int
+	stackSets    *map[string]*mockStackSet
+	cloudformationiface.CloudFormationAPI
+}
+
+func (m mockStackSets) ValidateTemplate(*cloudformation.ValidateTemplateInput) (*cloudformation.ValidateTemplateOutput, error) {
+	return &cloudformation.ValidateTemplateOutput{}, nil
+}
+
+func (m mockStackSets) DescribeStackSet(input *cloudformation.DescribeStackSetInput) (*cloudformation.DescribeStackSetOutput, error) {
+	if _, ok := (*m.stackSets)[*input.StackSetName]; !ok {
+		return nil, awserr.New(
+			cloudformation.ErrCodeStackSetNotFoundException,
+			fmt.Sprintf("StackSet %s not found", *input.StackSetName),
+			nil,
+		)
+	}
+	output := cloudformation.DescribeStackSetOutput{
+		StackSet: &cloudformation.StackSet{StackSetName: input.StackSetName},
+	}
+	return &output, nil
+}
+
+func (m mockStackSets) CreateStackSet(input *cloudformation.CreateStackSetInput) (*cloudformation.CreateStackSetOutput, error) {
+	(*m.stackSets)[*input.StackSetName] = &mockStackSet{
+		permissionMode: aws.StringValue(input.PermissionModel),
+		templateBody:   *input.TemplateBody,
+	}
+	return &cloudformation.CreateStackSetOutput{StackSetId: input.StackSetName}, nil
+}
+
+func (m mockStackSets) newOperation(results []*cloudformation.StackSetOperationResultSummary) *string {
+	operationID := fmt.Sprintf("operation-%d", len(*m.operations))
+	(*m.operations)[operationID] = results
+	return aws.String(operationID)
+}
+
+func (m mockStackSets) instanceResult(instance *cloudformation.StackInstanceSummary) *cloudformation.StackSetOperationResultSummary {
+	result := &cloudformation.StackSetOperationResultSummary{
+		Account:              instance.Account,
+		OrganizationalUnitId: instance.OrganizationalUnitId,
+		Region:               instance.Region,
+		Status:               aws.String(cloudformation.StackSetOperationResultStatusSucceeded),
+	}
+	if m.failAccounts[aws.StringValue(instance.Account)] {
+		result.Status = aws.String(cloudformation.StackSetOperationResultStatusFailed)
+		result.StatusReason = aws.String("Simulated Failure")
+	}
+	return result
+}
+
+func (m mockStackSets) UpdateStackSet(input *cloudformation.UpdateStackSetInput) (*cloudformation.UpdateStackSetOutput, error) {
+	stackSet, ok := (*m.stackSets)[*input.StackSetName]
+	if !ok {
+		return nil, awserr.New(
+			cloudformation.ErrCodeStackSetNotFoundException,
+			fmt.Sprintf("StackSet %s not found", *input.StackSetName),
+			nil,
+		)
+	}
+	stackSet.templateBody = *input.TemplateBody
+	results := []*cloudformation.StackSetOperationResultSummary{}
+	for _, i := range stackSet.instances {
+		results = append(results, m.instanceResult(i))
+	}
+	return &cloudformation.UpdateStackSetOutput{OperationId: m.newOperation(results)}, nil
+}
+
+func (m mockStackSets) CreateStackInstances(input *cloudformation.CreateStackInstancesInput) (*cloudformation.CreateStackInstancesOutput, error) {
+	stackSet := (*m.stackSets)[*input.StackSetName]
+	results := []*cloudformation.StackSetOperationResultSummary{}
+	for _, r := range input.Regions {
+		var instances []*cloudformation.StackInstanceSummary
+		if input.DeploymentTargets != nil {
+			if stackSet.permissionMode != cloudformation.PermissionModelsServiceManaged {
+				return nil, awserr.New("ValidationError", "Deployment targets require SERVICE_MANAGED permissions", nil)
+			}
+			for _, ou := range input.DeploymentTargets.OrganizationalUnitIds {
+				instances = append(instances, &cloudformation.StackInstanceSummary{
+					Account:              aws.String(fmt.Sprintf("account-in-%s", *ou)),
+					OrganizationalUnitId: ou,
+					Region:               r,
+				})
+			}
+		}
+		for _, a := range input.Accounts {
+			instances = append(instances, &cloudformation.StackInstanceSummary{
+				Account: a,
+				Region:  r,
+			})
+		}
+		for _, i := range instances {
+			result := m.instanceResult(i)
+			if *result.Status == cloudformation.StackSetOperationResultStatusSucceeded {
+				stackSet.instances = append(stackSet.instances, i)
+			}
+			results = append(results, result)
+		}
+	}
+	return &cloudformation.CreateStackInstancesOutput{OperationId: m.newOperation(results)}, nil
+}
+
+func (m mockStackSets) ListStackInstancesPages(input *cloudformation.ListStackInstancesInput, function func(*cloudformation.ListStackInstancesOutput, bool) bool) error {
+	instances := (*m.stackSets)[*input.StackSetName].instances
+	for i := 0; i < len(instances); i++ {
+		thisOutput := &cloudformation.ListStackInstancesOutput{
+			Summaries: []*cloudformation.StackInstanceSummary{instances[i]},
+		}
+		if nextPage := function(thisOutput, i == len(instances)-1); !nextPage {
+			return nil
+		}
+	}
+	return nil
+}
+
+func (m mockStackSets) DescribeStackSetOperation(input *cloudformation.DescribeStackSetOperationInput) (*cloudformation.DescribeStackSetOperationOutput, error) {
+	status := cloudformation.StackSetOperationStatusSucceeded
+	for _, r := range (*m.operations)[*input.OperationId] {
+		if *r.Status == cloudformation.StackSetOperationResultStatusFailed {
+			status = cloudformation.StackSetOperationStatusFailed
+		}
+	}
+	if m.runningPolls != nil && *m.runningPolls > 0 {
+		*m.runningPolls--
+		status = cloudformation.StackSetOperationStatusRunning
+	}
+	output := cloudformation.DescribeStackSetOperationOutput{
+		StackSetOperation: &cloudformation.StackSetOperation{
+			OperationId: input.OperationId,
+			Status:      aws.String(status),
+		},
+	}
+	return &output, nil
+}
+
+func (m mockStackSets) ListStackSetOperationResultsPages(input *cloudformation.ListStackSetOperationResultsInput, function func(*cloudformation.ListStackSetOperationResultsOutput, bool) bool) error {
+	results := (*m.operations)[*input.OperationId]
+	for i := 0; i < len(results); i++ {
+		thisOutput := &cloudformation.ListStackSetOperationResultsOutput{
+			Summaries: []*cloudformation.StackSetOperationResultSummary{results[i]},
+		}
+		if nextPage := function(thisOutput, i == len(results)-1); !nextPage {
+			return nil
+		}
+	}
+	return nil
+}
+
+// The context variants fail when the context is done, as the SDK would, and
+// otherwise behave the same as the calls above
+
+func (m mockStackSets) ValidateTemplateWithContext(ctx aws.Context, input *cloudformation.ValidateTemplateInput, opts ...request.Option) (*cloudformation.ValidateTemplateOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return m.ValidateTemplate(input)
+}
+
+func (m mockStackSets) DescribeStackSetWithContext(ctx aws.Context, input *cloudformation.DescribeStackSetInput, opts ...request.Option) (*cloudformation.DescribeStackSetOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return m.DescribeStackSet(input)
+}
+
+func (m mockStackSets) CreateStackSetWithContext(ctx aws.Context, input *cloudformation.CreateStackSetInput, opts ...request.Option) (*cloudformation.CreateStackSetOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return m.CreateStackSet(input)
+}
+
+func (m mockStackSets) UpdateStackSetWithContext(ctx aws.Context, input *cloudformation.UpdateStackSetInput, opts ...request.Option) (*cloudformation.UpdateStackSetOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return m.UpdateStackSet(input)
+}
+
+func (m mockStackSets) CreateStackInstancesWithContext(ctx aws.Context, input *cloudformation.CreateStackInstancesInput, opts ...request.Option) (*cloudformation.CreateStackInstancesOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return m.CreateStackInstances(input)
+}
+
+func (m mockStackSets) DescribeStackSetOperationWithContext(ctx aws.Context, input *cloudformation.DescribeStackSetOperationInput, opts ...request.Option) (*cloudformation.DescribeStackSetOperationOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if m.pollOptions != nil {
+		*m.pollOptions += len(opts)
+	}
+	return m.DescribeStackSetOperation(input)
+}
+
+func (m mockStackSets) ListStackInstancesPagesWithContext(ctx aws.Context, input *cloudformation.ListStackInstancesInput, function func(*cloudformation.ListStackInstancesOutput, bool) bool, opts ...request.Option) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return m.ListStackInstancesPages(input, function)
+}
+
+func (m mockStackSets) ListStackSetOperationResultsPagesWithContext(ctx aws.Context, input *cloudformation.ListStackSetOperationResultsInput, function func(*cloudformation.ListStackSetOperationResultsOutput, bool) bool, opts ...request.Option) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if m.pollOptions != nil {
+		*m.pollOptions += len(opts)
+	}
+	return m.ListStackSetOperationResultsPages(input, function)
+}
@@ -1,17 +1,41 @@
 package forgelib
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client/metadata"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/sts"
 	"github.com/aws/aws-sdk-go/service/sts/stsiface"
 )
 
 type mockSTS struct {
-	accountID string
-	callerArn string
+	accountID        string
+	assumeRoleInputs *[]sts.AssumeRoleInput
+	assumedRoles     *[]assumedRole
+	callerAccessKey  string
+	callerArn        string
+	// Credentials expire after this long, or after an hour when unset
+	credentialsExpiry time.Duration
+	webIdentityInputs *[]sts.AssumeRoleWithWebIdentityInput
 	stsiface.STSAPI
 }
 
+type assumedRole struct {
+	callerAccessKey string
+	roleArn         string
+	serialNumber    string
+}
+
+func (m mockSTS) expiration() *time.Time {
+	if m.credentialsExpiry == 0 {
+		return aws.Time(time.Now().Add(time.Hour))
+	}
+	return aws.Time(time.Now().Add(m.credentialsExpiry))
+}
+
 func (m mockSTS) GetCallerIdentity(*sts.GetCallerIdentityInput) (*sts.GetCallerIdentityOutput, error) {
 	output := sts.GetCallerIdentityOutput{
 		Account: aws.String(m.accountID),
@@ -20,13 +44,72 @@ func (m mockSTS) GetCallerIdentity(*sts.GetCallerIdentityInput) (*sts.GetCallerI
 	return &output, nil
 }
 
-func (m mockSTS) AssumeRole(*sts.AssumeRoleInput) (*sts.AssumeRoleOutput, error) {
+func (m mockSTS) GetCallerIdentityWithContext(ctx aws.Context, input *sts.GetCallerIdentityInput, opts ...request.Option) (*sts.GetCallerIdentityOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return m.GetCallerIdentity(input)
+}
+
+func (m mockSTS) AssumeRole(input *sts.AssumeRoleInput) (*sts.AssumeRoleOutput, error) {
+	if m.assumeRoleInputs != nil {
+		*m.assumeRoleInputs = append(*m.assumeRoleInputs, *input)
+	}
+	if m.assumedRoles != nil {
+		*m.assumedRoles = append(*m.assumedRoles, assumedRole{
+			callerAccessKey: m.callerAccessKey,
+			roleArn:         aws.StringValue(input.RoleArn),
+			serialNumber:    aws.StringValue(input.SerialNumber),
+		})
+		// Use the role ARN as the access key, so that the credentials used
+		// to assume the next role can be traced back to this one
+		output := sts.AssumeRoleOutput{
+			Credentials: &sts.Credentials{
+				AccessKeyId:     input.RoleArn,
+				Expiration:      m.expiration(),
+				SecretAccessKey: aws.String("RANDOM_SECRET_KEY_HERE"),
+				SessionToken:    aws.String("SESSION_TOKEN_HERE"),
+			},
+		}
+		return &output, nil
+	}
 	output := sts.AssumeRoleOutput{
 		Credentials: &sts.Credentials{
 			AccessKeyId:     aws.String("AKIABLAHBLAH"),
+			Expiration:      m.expiration(),
 			SecretAccessKey: aws.String("RANDOM_SECRET_KEY_HERE"),
 			SessionToken:    aws.String("SESSION_TOKEN_HERE"),
 		},
 	}
 	return &output, nil
 }
+
+// AssumeRoleWithContext is used by the assume role credentials provider
+func (m mockSTS) AssumeRoleWithContext(ctx aws.Context, input *sts.AssumeRoleInput, opts ...request.Option) (*sts.AssumeRoleOutput, error) {
+	return m.AssumeRole(input)
+}
+
+// AssumeRoleWithWebIdentityRequest is used by the web identity credentials
+// provider, which sends the request itself. The request has no handlers, so
+// sending it does nothing but return the output populated here
+func (m mockSTS) AssumeRoleWithWebIdentityRequest(input *sts.AssumeRoleWithWebIdentityInput) (*request.Request, *sts.AssumeRoleWithWebIdentityOutput) {
+	*m.webIdentityInputs = append(*m.webIdentityInputs, *input)
+	output := &sts.AssumeRoleWithWebIdentityOutput{
+		Credentials: &sts.Credentials{
+			AccessKeyId:     aws.String(fmt.Sprintf("AKIAWEBIDENTITY%d", len(*m.webIdentityInputs))),
+			Expiration:      m.expiration(),
+			SecretAccessKey: aws.String("RANDOM_SECRET_KEY_HERE"),
+			SessionToken:    aws.String("SESSION_TOKEN_HERE"),
+		},
+	}
+	req := request.New(
+		aws.Config{},
+		metadata.ClientInfo{},
+		request.Handlers{},
+		nil,
+		&request.Operation{Name: "AssumeRoleWithWebIdentity"},
+		input,
+		output,
+	)
+	return req, output
+}
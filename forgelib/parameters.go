@@ -0,0 +1,368 @@
+package forgelib
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+)
+
+// Where the values of ParameterOverrides, the defaults in the template, and
+// the values kept from the stack are said to come from
+const (
+	parameterOverrideSource = "parameter override"
+	previousValueSource     = "previous value"
+	templateDefaultSource   = "template default"
+)
+
+// RenderedParameter is the value which Deploy would give a template parameter,
+// and where the value came from. The values of NoEcho parameters are masked
+type RenderedParameter struct {
+	Key    string
+	NoEcho bool
+	// The values which were given before the final one and overridden by it,
+	// in the order they were given
+	Overridden []ParameterValue
+	ParameterValue
+}
+
+// ParameterValue is a value given for a parameter, and where it was given,
+// such as the parameters file which it came from. Source is empty if the
+// parameter has no value
+type ParameterValue struct {
+	Source string
+	// The value which the parameter already has on the stack is kept, either
+	// because it was given as "{{ previous }}" or because no value was given
+	// and UsePreviousParameters is set. Value is the previous value, when
+	// known
+	UsePrevious bool
+	Value       string
+}
+
+// parameter is the value as given to CloudFormation
+func (v ParameterValue) parameter(key string) *cloudformation.Parameter {
+	if v.UsePrevious {
+		return &cloudformation.Parameter{
+			ParameterKey:     aws.String(key),
+			UsePreviousValue: aws.Bool(true),
+		}
+	}
+	return &cloudformation.Parameter{
+		ParameterKey:   aws.String(key),
+		ParameterValue: aws.String(v.Value),
+	}
+}
+
+// RenderParameters resolves the values of the template parameters from the
+// parameter files and overrides exactly as Deploy would, with the same
+// checks, without creating or updating the stack. Parameters without a value
+// are given their template default
+func (s *Stack) RenderParameters() ([]RenderedParameter, error) {
+	return s.RenderParametersWithContext(context.Background())
+}
+
+// RenderParametersWithContext performs the same function as RenderParameters,
+// with a context to cancel the requests
+func (s *Stack) RenderParametersWithContext(ctx context.Context) ([]RenderedParameter, error) {
+	validationResult, err := s.cfn().ValidateTemplateWithContext(
+		ctx,
+		&cloudformation.ValidateTemplateInput{
+			TemplateBody: aws.String(s.TemplateBody),
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	// Previous values can only be kept from a stack which exists
+	if s.StackName != "" || s.StackID != "" {
+		if err := s.getStackInfoIfExists(ctx); err != nil {
+			return nil, err
+		}
+	}
+	values, err := resolveParameterValues(s.TemplateBody, validationResult.Parameters, s.parameterInputs())
+	if err != nil {
+		return nil, err
+	}
+	return renderParameters(validationResult.Parameters, values), nil
+}
+
+func renderParameters(templateParameters []*cloudformation.TemplateParameter, values map[string][]ParameterValue) []RenderedParameter {
+	rendered := []RenderedParameter{}
+	for _, p := range templateParameters {
+		r := RenderedParameter{
+			Key:    aws.StringValue(p.ParameterKey),
+			NoEcho: aws.BoolValue(p.NoEcho),
+		}
+		mask := func(value string) string {
+			if r.NoEcho {
+				return noEchoMask
+			}
+			return value
+		}
+		given := values[r.Key]
+		if p.DefaultValue != nil {
+			given = append([]ParameterValue{{Source: templateDefaultSource, Value: *p.DefaultValue}}, given...)
+		}
+		for i, v := range given {
+			value := ParameterValue{Source: v.Source, UsePrevious: v.UsePrevious, Value: mask(v.Value)}
+			if i == len(given)-1 {
+				r.ParameterValue = value
+			} else {
+				r.Overridden = append(r.Overridden, value)
+			}
+		}
+		rendered = append(rendered, r)
+	}
+	return rendered
+}
+
+// parameterInputs are the values given for the parameters of a template
+type parameterInputs struct {
+	bodies []string
+	// Take precedence over the values in bodies
+	overrides map[string]string
+	// Names for bodies, in the same order
+	sources []string
+	// The values of the parameters on the stack, which is nil if the stack
+	// doesn't exist yet
+	previous map[string]string
+	// Whether keys which aren't template parameters, and template parameters
+	// with neither a value nor a default, are errors
+	strict bool
+	// Whether parameters which aren't given a value keep their previous value
+	usePrevious bool
+}
+
+// values lists every value given for each parameter, in increasing order of
+// precedence
+func (in parameterInputs) values() (map[string][]ParameterValue, error) {
+	values, err := parseParameterValues(in.bodies, in.sources)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range in.overrides {
+		values[k] = append(values[k], ParameterValue{Source: parameterOverrideSource, Value: v})
+	}
+	return values, nil
+}
+
+// resolveParameters collects the values for the template parameters from the
+// parameter overrides and parameter files, in that order of precedence. Every
+// value which doesn't meet the constraints of its parameter in the template is
+// reported at once, as ParameterErrors. In strict mode, so are keys which
+// aren't parameters of the template and parameters which are left without a
+// value
+func resolveParameters(templateBody string, templateParameters []*cloudformation.TemplateParameter, in parameterInputs) (inputParams []*cloudformation.Parameter, err error) {
+	values, err := resolveParameterValues(templateBody, templateParameters, in)
+	if err != nil {
+		return inputParams, err
+	}
+	for _, p := range templateParameters {
+		parameterKey := aws.StringValue(p.ParameterKey)
+		if given := values[parameterKey]; len(given) > 0 {
+			inputParams = append(inputParams, given[len(given)-1].parameter(parameterKey))
+		}
+	}
+	return inputParams, nil
+}
+
+// resolveParameterValues performs the checks of resolveParameters, returning
+// every value given for each template parameter, in increasing order of
+// precedence
+func resolveParameterValues(templateBody string, templateParameters []*cloudformation.TemplateParameter, in parameterInputs) (map[string][]ParameterValue, error) {
+	values, err := in.values()
+	if err != nil {
+		return nil, err
+	}
+	constraints := templateParameterConstraints(templateBody)
+
+	var problems ParameterErrors
+	if in.strict {
+		problems = append(problems, unknownParameters(templateParameters, values)...)
+	}
+	resolved := map[string][]ParameterValue{}
+	for _, p := range templateParameters {
+		parameterKey := aws.StringValue(p.ParameterKey)
+		previous, hasPrevious := in.previous[parameterKey]
+		given := values[parameterKey]
+		if len(given) == 0 && in.usePrevious && hasPrevious {
+			given = []ParameterValue{{Source: previousValueSource, UsePrevious: true}}
+		}
+		for i := range given {
+			if given[i].UsePrevious {
+				given[i].Value = previous
+			}
+		}
+		if len(given) == 0 {
+			if in.strict && p.DefaultValue == nil {
+				problems = append(problems, ParameterError{Key: parameterKey, Message: "no value was given, and the parameter has no default"})
+			}
+			continue
+		}
+		resolved[parameterKey] = given
+		final := given[len(given)-1]
+		if final.UsePrevious {
+			// The previous value was accepted when the stack was deployed
+			if !hasPrevious {
+				problems = append(problems, ParameterError{Key: parameterKey, Message: "{{ previous }} was given, but the stack has no previous value for the parameter", Source: final.Source})
+			}
+			continue
+		}
+		for _, message := range constraints[parameterKey].check(final.Value, aws.BoolValue(p.NoEcho)) {
+			problems = append(problems, ParameterError{Key: parameterKey, Message: message, Source: final.Source})
+		}
+	}
+	if len(problems) > 0 {
+		return nil, problems
+	}
+	return resolved, nil
+}
+
+// unknownParameters reports each key which was given a value but isn't a
+// parameter of the template, such as a misspelt parameter name, once for each
+// place which it was given in
+func unknownParameters(templateParameters []*cloudformation.TemplateParameter, values map[string][]ParameterValue) (problems ParameterErrors) {
+	known := map[string]bool{}
+	for _, p := range templateParameters {
+		known[aws.StringValue(p.ParameterKey)] = true
+	}
+	var keys []string
+	for k := range values {
+		if !known[k] {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range values[k] {
+			problems = append(problems, ParameterError{Key: k, Message: "not a parameter of the template", Source: v.Source})
+		}
+	}
+	return problems
+}
+
+// parameterConstraints are the constraints which a template puts on the value
+// of a parameter
+type parameterConstraints struct {
+	AllowedPattern        string   `yaml:"AllowedPattern"`
+	AllowedValues         []string `yaml:"AllowedValues"`
+	ConstraintDescription string   `yaml:"ConstraintDescription"`
+	MaxLength             string   `yaml:"MaxLength"`
+	MaxValue              string   `yaml:"MaxValue"`
+	MinLength             string   `yaml:"MinLength"`
+	MinValue              string   `yaml:"MinValue"`
+	Type                  string   `yaml:"Type"`
+}
+
+// templateParameterConstraints reads the constraints of each parameter from
+// the template. Templates which can't be read here are left for CloudFormation
+// to check
+func templateParameterConstraints(templateBody string) map[string]parameterConstraints {
+	constraints := map[string]parameterConstraints{}
+	t, err := parseTemplateNodes([]byte(templateBody))
+	if err != nil {
+		return constraints
+	}
+	for _, p := range t.parameters {
+		c := parameterConstraints{}
+		if err := p.value.Decode(&c); err != nil {
+			continue
+		}
+		constraints[p.name] = c
+	}
+	return constraints
+}
+
+// check lists the ways in which a value doesn't meet the constraints, in the
+// way that CloudFormation applies them to each type of parameter. The values of
+// NoEcho parameters are masked in the problems
+func (c parameterConstraints) check(value string, noEcho bool) (problems []string) {
+	shown := func(v string) string {
+		if noEcho {
+			return noEchoMask
+		}
+		return v
+	}
+	switch c.Type {
+	case "String":
+		problems = append(problems, c.checkLength(value, shown(value))...)
+		problems = append(problems, c.checkAllowed(value, shown(value))...)
+	case "Number":
+		problems = append(problems, c.checkNumber(value, shown(value))...)
+		problems = append(problems, c.checkAllowed(value, shown(value))...)
+	case "List<Number>":
+		for _, item := range strings.Split(value, ",") {
+			item = strings.TrimSpace(item)
+			problems = append(problems, c.checkNumber(item, shown(item))...)
+		}
+	case "CommaDelimitedList":
+		for _, item := range strings.Split(value, ",") {
+			item = strings.TrimSpace(item)
+			problems = append(problems, c.checkAllowed(item, shown(item))...)
+		}
+		// Other types, such as AWS::EC2::KeyPair::KeyName, can only be
+		// checked against the account
+	}
+	if c.ConstraintDescription != "" {
+		for i := range problems {
+			problems[i] += " (" + c.ConstraintDescription + ")"
+		}
+	}
+	return problems
+}
+
+// The checks below are given the value, and how to show it in the problems
+
+func (c parameterConstraints) checkLength(value, shown string) (problems []string) {
+	length := utf8.RuneCountInString(value)
+	if min, err := strconv.Atoi(c.MinLength); err == nil && length < min {
+		problems = append(problems, fmt.Sprintf("%q is shorter than the minimum length of %d", shown, min))
+	}
+	if max, err := strconv.Atoi(c.MaxLength); err == nil && length > max {
+		problems = append(problems, fmt.Sprintf("%q is longer than the maximum length of %d", shown, max))
+	}
+	return problems
+}
+
+func (c parameterConstraints) checkNumber(value, shown string) (problems []string) {
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return []string{fmt.Sprintf("%q is not a number", shown)}
+	}
+	if min, err := strconv.ParseFloat(c.MinValue, 64); err == nil && number < min {
+		problems = append(problems, fmt.Sprintf("%s is less than the minimum value of %s", shown, c.MinValue))
+	}
+	if max, err := strconv.ParseFloat(c.MaxValue, 64); err == nil && number > max {
+		problems = append(problems, fmt.Sprintf("%s is greater than the maximum value of %s", shown, c.MaxValue))
+	}
+	return problems
+}
+
+func (c parameterConstraints) checkAllowed(value, shown string) (problems []string) {
+	if len(c.AllowedValues) > 0 {
+		allowed := false
+		for _, a := range c.AllowedValues {
+			if a == value {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			problems = append(problems, fmt.Sprintf("%q is not one of the allowed values [%s]", shown, strings.Join(c.AllowedValues, ", ")))
+		}
+	}
+	if c.AllowedPattern != "" {
+		// CloudFormation requires the pattern to match the whole value
+		pattern, err := regexp.Compile("^(?:" + c.AllowedPattern + ")$")
+		if err == nil && !pattern.MatchString(value) {
+			problems = append(problems, fmt.Sprintf("%q does not match the allowed pattern %s", shown, c.AllowedPattern))
+		}
+	}
+	return problems
+}
@@ -0,0 +1,313 @@
+package forgelib
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+)
+
+func TestResolveParameters(t *testing.T) {
+	templateBody := `
+Parameters:
+  Environment:
+    Type: String
+    AllowedValues: [dev, prod]
+  Name:
+    Type: String
+    AllowedPattern: "[a-z-]+"
+    ConstraintDescription: must be lowercase
+    MinLength: 3
+    MaxLength: 8
+  Count:
+    Type: Number
+    MinValue: 1
+    MaxValue: "10"
+  Ports:
+    Type: List<Number>
+  Zones:
+    Type: CommaDelimitedList
+    AllowedValues: [a, b, c]
+  KeyName:
+    Type: AWS::EC2::KeyPair::KeyName
+Resources:
+  Topic:
+    Type: AWS::SNS::Topic
+`
+	templateParameters := []*cloudformation.TemplateParameter{}
+	for _, k := range []string{"Environment", "Name", "Count", "Ports", "Zones", "KeyName"} {
+		templateParameters = append(templateParameters, &cloudformation.TemplateParameter{ParameterKey: aws.String(k)})
+	}
+
+	cases := []struct {
+		bodies       []string
+		expectErrors []string
+		expectValues map[string]string
+		overrides    map[string]string
+		sources      []string
+		templateBody string
+	}{
+		{
+			bodies: []string{
+				"Environment: test\nName: app\nCount: 20\nPorts: [80, http]\nZones: [a, d]\nKeyName: anything",
+				"Name: App",
+			},
+			sources:   []string{"common.yml", "app.yml"},
+			overrides: map[string]string{"Count": "0"},
+			expectErrors: []string{
+				`Environment (from common.yml): "test" is not one of the allowed values [dev, prod]`,
+				`Name (from app.yml): "App" does not match the allowed pattern [a-z-]+ (must be lowercase)`,
+				`Count (from parameter override): 0 is less than the minimum value of 1`,
+				`Ports (from common.yml): "http" is not a number`,
+				`Zones (from common.yml): "d" is not one of the allowed values [a, b, c]`,
+			},
+		},
+		{
+			bodies: []string{"Name: ab\nCount: 11"},
+			expectErrors: []string{
+				`Name (from parameters body 1): "ab" is shorter than the minimum length of 3 (must be lowercase)`,
+				`Count (from parameters body 1): 11 is greater than the maximum value of 10`,
+			},
+		},
+		{
+			bodies:       []string{"Environment: prod\nName: my-app\nCount: 5\nPorts: 80,443\nZones: [a, b]\nUnused: x"},
+			overrides:    map[string]string{"Environment": "dev"},
+			expectValues: map[string]string{"Environment": "dev", "Name": "my-app", "Count": "5", "Ports": "80,443", "Zones": "a,b"},
+		},
+		// Templates which can't be read are left for CloudFormation to check
+		{
+			bodies:       []string{"Environment: test"},
+			templateBody: "not: [valid",
+			expectValues: map[string]string{"Environment": "test"},
+		},
+	}
+
+	for i, c := range cases {
+		body := templateBody
+		if c.templateBody != "" {
+			body = c.templateBody
+		}
+		params, err := resolveParameters(body, templateParameters, parameterInputs{
+			bodies:    c.bodies,
+			overrides: c.overrides,
+			sources:   c.sources,
+		})
+		if len(c.expectErrors) > 0 {
+			var problems ParameterErrors
+			if !errors.As(err, &problems) {
+				t.Fatalf("%d, expected ParameterErrors, got %v", i, err)
+			}
+			if !errors.Is(err, ErrInvalidParameters) {
+				t.Errorf("%d, expected error to be %v", i, ErrInvalidParameters)
+			}
+			got := []string{}
+			for _, p := range problems {
+				got = append(got, p.Error())
+			}
+			if e, g := fmt.Sprintf("%q", c.expectErrors), fmt.Sprintf("%q", got); e != g {
+				t.Errorf("%d, expected errors %s, got %s", i, e, g)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%d, unexpected error, %v", i, err)
+		}
+		got := map[string]string{}
+		for _, p := range params {
+			got[*p.ParameterKey] = *p.ParameterValue
+		}
+		if e, g := fmt.Sprint(c.expectValues), fmt.Sprint(got); e != g {
+			t.Errorf("%d, expected values %s, got %s", i, e, g)
+		}
+	}
+}
+
+func TestResolveParametersNoEcho(t *testing.T) {
+	templateBody := `
+Parameters:
+  Password:
+    Type: String
+    NoEcho: true
+    AllowedPattern: "[A-Za-z0-9]+"
+    MinLength: 20
+  Pin:
+    Type: Number
+    NoEcho: true
+    MaxValue: 9999
+  Keys:
+    Type: CommaDelimitedList
+    NoEcho: true
+    AllowedValues: [a, b]
+Resources:
+  Topic:
+    Type: AWS::SNS::Topic
+`
+	templateParameters := []*cloudformation.TemplateParameter{
+		{ParameterKey: aws.String("Password"), NoEcho: aws.Bool(true)},
+		{ParameterKey: aws.String("Pin"), NoEcho: aws.Bool(true)},
+		{ParameterKey: aws.String("Keys"), NoEcho: aws.Bool(true)},
+	}
+
+	_, err := resolveParameters(templateBody, templateParameters, parameterInputs{
+		bodies:  []string{"Password: hunter2!\nPin: 123456\nKeys: [a, secret-key]"},
+		sources: []string{"secrets.yml"},
+	})
+	var problems ParameterErrors
+	if !errors.As(err, &problems) {
+		t.Fatalf("expected ParameterErrors, got %v", err)
+	}
+	got := []string{}
+	for _, p := range problems {
+		got = append(got, p.Error())
+	}
+	expectErrors := []string{
+		`Password (from secrets.yml): "****" is shorter than the minimum length of 20`,
+		`Password (from secrets.yml): "****" does not match the allowed pattern [A-Za-z0-9]+`,
+		`Pin (from secrets.yml): **** is greater than the maximum value of 9999`,
+		`Keys (from secrets.yml): "****" is not one of the allowed values [a, b]`,
+	}
+	if e, g := fmt.Sprintf("%q", expectErrors), fmt.Sprintf("%q", got); e != g {
+		t.Errorf("expected errors %s, got %s", e, g)
+	}
+	for _, secret := range []string{"hunter2!", "123456", "secret-key"} {
+		if strings.Contains(err.Error(), secret) {
+			t.Errorf("expected %q to be masked, got %s", secret, err)
+		}
+	}
+}
+
+func TestResolveParametersStrict(t *testing.T) {
+	templateParameters := []*cloudformation.TemplateParameter{
+		{ParameterKey: aws.String("DomainName")},
+		{ParameterKey: aws.String("Environment")},
+		{ParameterKey: aws.String("Size"), DefaultValue: aws.String("small")},
+	}
+
+	cases := []struct {
+		bodies       []string
+		expectErrors []string
+		overrides    map[string]string
+		strict       bool
+	}{
+		{
+			bodies:    []string{"DomianName: example.com\nEnvironment: dev", "DomianName: example.org\nOther: x"},
+			overrides: map[string]string{"Sise": "large"},
+			strict:    true,
+			expectErrors: []string{
+				"DomianName (from a.yml): not a parameter of the template",
+				"DomianName (from b.yml): not a parameter of the template",
+				"Other (from b.yml): not a parameter of the template",
+				"Sise (from parameter override): not a parameter of the template",
+				"DomainName: no value was given, and the parameter has no default",
+			},
+		},
+		{
+			bodies: []string{"Other: x"},
+			strict: true,
+			expectErrors: []string{
+				"Other (from a.yml): not a parameter of the template",
+				"DomainName: no value was given, and the parameter has no default",
+				"Environment: no value was given, and the parameter has no default",
+			},
+		},
+		{
+			bodies: []string{"DomainName: example.com\nEnvironment: dev"},
+			strict: true,
+		},
+		// Without strict mode, other keys are ignored and missing values are
+		// left for CloudFormation
+		{
+			bodies: []string{"DomianName: example.com"},
+		},
+	}
+
+	for i, c := range cases {
+		_, err := resolveParameters("", templateParameters, parameterInputs{
+			bodies:    c.bodies,
+			overrides: c.overrides,
+			sources:   []string{"a.yml", "b.yml"},
+			strict:    c.strict,
+		})
+		if len(c.expectErrors) == 0 {
+			if err != nil {
+				t.Fatalf("%d, unexpected error, %v", i, err)
+			}
+			continue
+		}
+		var problems ParameterErrors
+		if !errors.As(err, &problems) {
+			t.Fatalf("%d, expected ParameterErrors, got %v", i, err)
+		}
+		got := []string{}
+		for _, p := range problems {
+			got = append(got, p.Error())
+		}
+		if e, g := fmt.Sprintf("%q", c.expectErrors), fmt.Sprintf("%q", got); e != g {
+			t.Errorf("%d, expected errors %s, got %s", i, e, g)
+		}
+	}
+}
+
+func TestRenderParameters(t *testing.T) {
+	oldCFNClient := defaultClient.cfnClient
+	defer func() { defaultClient.cfnClient = oldCFNClient }()
+	defaultClient.cfnClient = mockCfn{
+		noEchoParameters:   []string{"Password"},
+		parameterDefaults:  map[string]string{"Size": "small", "Timeout": "30"},
+		requiredParameters: []string{"Environment", "Password", "Size", "Timeout", "Unset"},
+	}
+
+	s := Stack{
+		ParameterBodies: []string{
+			"Environment: dev\nPassword: first\nSize: medium\nOther: x",
+			"Environment: prod\nPassword: second",
+		},
+		ParameterOverrides: map[string]string{"Size": "large"},
+		ParameterSources:   []string{"common.yml", "prod.yml"},
+		TemplateBody:       "Resources: {Topic: {Type: AWS::SNS::Topic}}",
+	}
+	rendered, err := s.RenderParameters()
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	expected := []RenderedParameter{
+		{
+			Key:            "Environment",
+			Overridden:     []ParameterValue{{Source: "common.yml", Value: "dev"}},
+			ParameterValue: ParameterValue{Source: "prod.yml", Value: "prod"},
+		},
+		{
+			Key:            "Password",
+			NoEcho:         true,
+			Overridden:     []ParameterValue{{Source: "common.yml", Value: noEchoMask}},
+			ParameterValue: ParameterValue{Source: "prod.yml", Value: noEchoMask},
+		},
+		{
+			Key: "Size",
+			Overridden: []ParameterValue{
+				{Source: "template default", Value: "small"},
+				{Source: "common.yml", Value: "medium"},
+			},
+			ParameterValue: ParameterValue{Source: "parameter override", Value: "large"},
+		},
+		{
+			Key:            "Timeout",
+			ParameterValue: ParameterValue{Source: "template default", Value: "30"},
+		},
+		{
+			Key: "Unset",
+		},
+	}
+	if e, g := fmt.Sprintf("%+v", expected), fmt.Sprintf("%+v", rendered); e != g {
+		t.Errorf("expected %s, got %s", e, g)
+	}
+
+	// The same checks are made as for Deploy
+	s.StrictParameters = true
+	if _, err := s.RenderParameters(); !errors.Is(err, ErrInvalidParameters) {
+		t.Errorf("expected %v, got %v", ErrInvalidParameters, err)
+	}
+}
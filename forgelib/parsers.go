@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"fmt"
 	"os"
+	"sort"
+	"strings"
 	"text/template"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -37,39 +39,84 @@ func parseTags(input string) (output []*cloudformation.Tag, err error) {
 	return output, err
 }
 
-func parseParameters(input []string) (output []*cloudformation.Parameter, err error) {
-	paramCollection := map[string]string{}
-	for _, i := range input {
+// parseParameterValues lists every value given for each parameter in the
+// parameter bodies, with the name of the body from sources which it came from.
+// Values from later bodies come after those they override
+func parseParameterValues(input []string, sources []string) (map[string][]ParameterValue, error) {
+	values := map[string][]ParameterValue{}
+	for i, body := range input {
 		var parsedInput interface{}
-		if err := yaml.Unmarshal([]byte(i), &parsedInput); err != nil {
-			return []*cloudformation.Parameter{}, err
+		if err := yaml.Unmarshal([]byte(body), &parsedInput); err != nil {
+			return nil, err
 		}
 		parsedMap, ok := parsedInput.(map[string]interface{})
 		if !ok {
-			return []*cloudformation.Parameter{}, fmt.Errorf("Parameters must be a basic key-value object")
+			return nil, fmt.Errorf("Parameters must be a basic key-value object")
 		}
-		for k, v := range parsedMap {
+		// Sorted so that errors are consistent
+		keys := make([]string, 0, len(parsedMap))
+		for k := range parsedMap {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
 			var parsedVal string
-			if err := valueToString(v, &parsedVal, true, true); err != nil {
-				return []*cloudformation.Parameter{}, fmt.Errorf("Invalid Parameter %s: %s", k, err)
+			if err := valueToString(parsedMap[k], &parsedVal, true, true); err != nil {
+				return nil, fmt.Errorf("Invalid Parameter %s: %s", k, err)
 			}
-			envVarSub, err := parseEnvironmentVariables(parsedVal)
+			value, usePrevious, err := parseParameterValue(parsedVal)
 			if err != nil {
-				return []*cloudformation.Parameter{}, err
+				return nil, fmt.Errorf("Invalid Parameter %s: %s", k, err)
 			}
-			paramCollection[k] = envVarSub
+			values[k] = append(values[k], ParameterValue{
+				Source:      parameterSource(sources, i),
+				UsePrevious: usePrevious,
+				Value:       value,
+			})
 		}
 	}
-	for k, v := range paramCollection {
-		output = append(output, &cloudformation.Parameter{
-			ParameterKey:   aws.String(k),
-			ParameterValue: aws.String(v),
-		})
+	return values, nil
+}
+
+// parameterSource names the parameter body at an index, for bodies which
+// weren't given a name
+func parameterSource(sources []string, i int) string {
+	if i < len(sources) && sources[i] != "" {
+		return sources[i]
 	}
-	return output, err
+	return fmt.Sprintf("parameters body %d", i+1)
 }
 
 func parseEnvironmentVariables(input string) (string, error) {
+	return executeValueTemplate(input, nil)
+}
+
+// Stands in for "{{ previous }}" in a parameter value while it is parsed. It
+// can't be written in a parameters file, as YAML doesn't allow NUL characters
+const previousValueMarker = "\x00previous\x00"
+
+// parseParameterValue substitutes the environment variables in a parameter
+// value, and reports whether the value is "{{ previous }}", which keeps the
+// value which the parameter already has on the stack
+func parseParameterValue(input string) (value string, usePrevious bool, err error) {
+	value, err = executeValueTemplate(input, template.FuncMap{
+		"previous": func() string { return previousValueMarker },
+	})
+	if err != nil {
+		return "", false, err
+	}
+	if value == previousValueMarker {
+		return "", true, nil
+	}
+	if strings.Contains(value, previousValueMarker) {
+		return "", false, fmt.Errorf("{{ previous }} must be the whole of the value")
+	}
+	return value, false, nil
+}
+
+// executeValueTemplate executes a parameter or tag value as a Go template, with
+// the env function and any others given
+func executeValueTemplate(input string, funcs template.FuncMap) (string, error) {
 	funcMap := template.FuncMap{
 		"env": func(input string) (string, error) {
 			if v, present := os.LookupEnv(input); present {
@@ -78,6 +125,9 @@ func parseEnvironmentVariables(input string) (string, error) {
 			return "", fmt.Errorf("Environment variable by the name \"%s\" is not defined", input)
 		},
 	}
+	for name, f := range funcs {
+		funcMap[name] = f
+	}
 
 	envTemplate, err := template.New("envTemplate").Funcs(funcMap).Parse(input)
 	if err != nil {
@@ -91,3 +141,107 @@ func parseEnvironmentVariables(input string) (string, error) {
 
 	return outputBuffer.String(), nil
 }
+
+func parseTemplate(input string) (map[string]interface{}, error) {
+	var parsedInput interface{}
+	if err := yaml.Unmarshal([]byte(input), &parsedInput); err != nil {
+		return nil, err
+	}
+	parsedMap, ok := parsedInput.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Template must be a key-value object")
+	}
+	return parsedMap, nil
+}
+
+func parseTemplateResources(input string) (map[string]map[string]interface{}, error) {
+	parsedTemplate, err := parseTemplate(input)
+	if err != nil {
+		return nil, err
+	}
+	output := map[string]map[string]interface{}{}
+	resources, ok := parsedTemplate["Resources"].(map[string]interface{})
+	if !ok {
+		return output, nil
+	}
+	for k, v := range resources {
+		resource, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("Resource %s must be a key-value object", k)
+		}
+		output[k] = resource
+	}
+	return output, nil
+}
+
+func parseDeletionPolicies(input string) (map[string]string, error) {
+	resources, err := parseTemplateResources(input)
+	if err != nil {
+		return nil, err
+	}
+	output := map[string]string{}
+	for k, r := range resources {
+		if policy, ok := r["DeletionPolicy"].(string); ok {
+			output[k] = policy
+		}
+	}
+	return output, nil
+}
+
+func parseResourcesToImport(input string, templateBody string) (output []*cloudformation.ResourceToImport, err error) {
+	templateResources, err := parseTemplateResources(templateBody)
+	if err != nil {
+		return output, err
+	}
+
+	var parsedInput interface{}
+	if err := yaml.Unmarshal([]byte(input), &parsedInput); err != nil {
+		return output, err
+	}
+	parsedMap, ok := parsedInput.(map[string]interface{})
+	if !ok || len(parsedMap) == 0 {
+		return output, fmt.Errorf("Resources to import must be a key-value object of logical IDs to resource identifiers")
+	}
+
+	logicalIDs := []string{}
+	for k := range parsedMap {
+		logicalIDs = append(logicalIDs, k)
+	}
+	sort.Strings(logicalIDs)
+
+	for _, logicalID := range logicalIDs {
+		resource, ok := templateResources[logicalID]
+		if !ok {
+			return output, fmt.Errorf("Resource %s to import is not defined in the template", logicalID)
+		}
+		resourceType, ok := resource["Type"].(string)
+		if !ok {
+			return output, fmt.Errorf("Resource %s to import has no Type in the template", logicalID)
+		}
+		// CloudFormation requires this, so that the resource isn't
+		// accidentally deleted should the import be rolled back
+		if _, ok := resource["DeletionPolicy"].(string); !ok {
+			return output, fmt.Errorf("Resource %s to import must have a DeletionPolicy in the template", logicalID)
+		}
+
+		identifiers, ok := parsedMap[logicalID].(map[string]interface{})
+		if !ok || len(identifiers) == 0 {
+			return output, fmt.Errorf("Resource %s to import must have a key-value object of resource identifiers", logicalID)
+		}
+		resourceIdentifier := map[string]*string{}
+		for k, v := range identifiers {
+			var parsedVal string
+			if err := valueToString(v, &parsedVal, false, true); err != nil {
+				return output, fmt.Errorf("Invalid identifier %s for resource %s: %s", k, logicalID, err)
+			}
+			resourceIdentifier[k] = aws.String(parsedVal)
+		}
+
+		output = append(output, &cloudformation.ResourceToImport{
+			LogicalResourceId:  aws.String(logicalID),
+			ResourceIdentifier: resourceIdentifier,
+			ResourceType:       aws.String(resourceType),
+		})
+	}
+	return output, nil
+}
@@ -223,7 +223,7 @@ func TestParseTagsErrors(t *testing.T) {
 	}
 }
 
-func TestParseParameters(t *testing.T) {
+func TestParseParameterValues(t *testing.T) {
 	cases := []struct {
 		input              []string
 		expectedParameters []*cloudformation.Parameter
@@ -518,39 +518,29 @@ func TestParseParameters(t *testing.T) {
 			defer os.Unsetenv(k)
 		}
 
-		var parameters []*cloudformation.Parameter
-		parameters, err := parseParameters(c.input)
+		values, err := parseParameterValues(c.input, nil)
 		if err != nil {
 			t.Fatalf("%d, unexpected error, %v", i, err)
 		}
 
-		for j := 0; j < len(c.expectedParameters); j++ {
-			found := false
-			e := struct{ ParameterKey, ParameterValue string }{
-				*c.expectedParameters[j].ParameterKey,
-				*c.expectedParameters[j].ParameterValue,
+		// The value which takes precedence is the last one given
+		for _, p := range c.expectedParameters {
+			given := values[*p.ParameterKey]
+			if len(given) == 0 {
+				t.Errorf("%d, expected %s, but not found in output parameters", i, *p.ParameterKey)
+				continue
 			}
-			for k := 0; k < len(parameters); k++ {
-				g := struct{ ParameterKey, ParameterValue string }{
-					*parameters[k].ParameterKey,
-					*parameters[k].ParameterValue,
-				}
-				if e.ParameterKey == g.ParameterKey {
-					if e.ParameterValue == g.ParameterValue {
-						found = true
-					} else {
-						t.Errorf("%d, expected %+v, got %+v", i, e, g)
-					}
-				}
-			}
-			if !found {
-				t.Errorf("%d, expected %+v, but not found in output parameters", i, e)
+			if e, g := *p.ParameterValue, given[len(given)-1].Value; e != g {
+				t.Errorf("%d, expected %s to be %q, got %q", i, *p.ParameterKey, e, g)
 			}
 		}
+		if e, g := len(c.expectedParameters), len(values); e != g {
+			t.Errorf("%d, expected %d parameters, got %d", i, e, g)
+		}
 	}
 }
 
-func TestParseParametersErrors(t *testing.T) {
+func TestParseParameterValuesErrors(t *testing.T) {
 	cases := []string{
 		"bad:\nyaml",
 		`{"nested":{"objects":"here"}}`,
@@ -560,7 +550,7 @@ func TestParseParametersErrors(t *testing.T) {
 	}
 
 	for i, c := range cases {
-		_, err := parseParameters([]string{c})
+		_, err := parseParameterValues([]string{c}, nil)
 		if err == nil {
 			t.Errorf("%d, expected error, but got success", i)
 		}
@@ -639,3 +629,42 @@ func TestParseEnvironmentVariablesError(t *testing.T) {
 		}
 	}
 }
+
+func TestParseParameterValue(t *testing.T) {
+	cases := []struct {
+		input             string
+		expectError       bool
+		expectUsePrevious bool
+		expectValue       string
+	}{
+		{input: "{{ previous }}", expectUsePrevious: true},
+		{input: "{{previous}}", expectUsePrevious: true},
+		{input: "plain value", expectValue: "plain value"},
+		{input: "prefix-{{ previous }}", expectError: true},
+		{input: "{{ previous }} {{ previous }}", expectError: true},
+	}
+
+	for i, c := range cases {
+		value, usePrevious, err := parseParameterValue(c.input)
+		if c.expectError {
+			if err == nil {
+				t.Errorf("%d, expected error, but got success", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%d, unexpected error, %v", i, err)
+		}
+		if e, g := c.expectUsePrevious, usePrevious; e != g {
+			t.Errorf("%d, expected use previous %t, got %t", i, e, g)
+		}
+		if e, g := c.expectValue, value; e != g {
+			t.Errorf("%d, expected %q, got %q", i, e, g)
+		}
+	}
+
+	// Tags don't have previous values
+	if _, err := parseEnvironmentVariables("{{ previous }}"); err == nil {
+		t.Errorf("expected {{ previous }} to be rejected in tags")
+	}
+}
@@ -0,0 +1,102 @@
+package forgelib
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// The spacing of the polling requests made through a client, which is shared
+// by all of the stacks being followed with it so that following many stacks
+// at once doesn't exhaust the account's CloudFormation API limits
+const (
+	defaultPollRequestInterval = 200 * time.Millisecond
+	maxPollRequestInterval     = 5 * time.Second
+)
+
+// pollBudget spaces out the polling requests made through a client. The
+// spacing doubles each time a request is throttled, up to a limit, and
+// recovers gradually as requests succeed
+type pollBudget struct {
+	mutex    sync.Mutex
+	base     time.Duration
+	interval time.Duration
+	// When the next request may be made
+	next time.Time
+}
+
+func newPollBudget(interval time.Duration) *pollBudget {
+	return &pollBudget{base: interval, interval: interval}
+}
+
+// wait blocks until the next request may be made, or the context is done
+func (b *pollBudget) wait(ctx context.Context) error {
+	b.mutex.Lock()
+	now := time.Now()
+	if b.next.Before(now) {
+		b.next = now
+	}
+	delay := b.next.Sub(now)
+	b.next = b.next.Add(b.interval)
+	b.mutex.Unlock()
+
+	if delay <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// throttled slows requests down after one has been throttled
+func (b *pollBudget) throttled() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.interval *= 2
+	if b.interval > maxPollRequestInterval {
+		b.interval = maxPollRequestInterval
+	}
+}
+
+// succeeded speeds requests back up towards the base spacing
+func (b *pollBudget) succeeded() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.interval -= (b.interval - b.base) / 4
+	if b.interval-b.base < time.Millisecond {
+		b.interval = b.base
+	}
+}
+
+// currentInterval is the spacing which requests are made with at the moment
+func (b *pollBudget) currentInterval() time.Duration {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.interval
+}
+
+// requestOption applies the budget to a request. Every attempt is counted,
+// including each page and each retry made by the SDK
+func (b *pollBudget) requestOption() request.Option {
+	return func(r *request.Request) {
+		r.Handlers.Sign.PushFront(func(r *request.Request) {
+			if err := b.wait(r.Context()); err != nil {
+				r.Error = err
+			}
+		})
+		r.Handlers.CompleteAttempt.PushBack(func(r *request.Request) {
+			if request.IsErrorThrottle(r.Error) {
+				b.throttled()
+			} else if r.Error == nil {
+				b.succeeded()
+			}
+		})
+	}
+}
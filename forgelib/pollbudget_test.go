@@ -0,0 +1,56 @@
+package forgelib
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPollBudget(t *testing.T) {
+	base := 100 * time.Millisecond
+	cases := []struct {
+		throttles      int
+		successes      int
+		expectInterval time.Duration
+	}{
+		{expectInterval: base},
+		{throttles: 1, expectInterval: 2 * base},
+		{throttles: 3, expectInterval: 8 * base},
+		{throttles: 20, expectInterval: maxPollRequestInterval},
+		{throttles: 1, successes: 1, expectInterval: 175 * time.Millisecond},
+		{throttles: 3, successes: 100, expectInterval: base},
+	}
+	for i, c := range cases {
+		b := newPollBudget(base)
+		for j := 0; j < c.throttles; j++ {
+			b.throttled()
+		}
+		for j := 0; j < c.successes; j++ {
+			b.succeeded()
+		}
+		if e, g := c.expectInterval, b.currentInterval(); e != g {
+			t.Errorf("%d, expected interval %v, got %v", i, e, g)
+		}
+	}
+}
+
+func TestPollBudgetWait(t *testing.T) {
+	b := newPollBudget(20 * time.Millisecond)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := b.wait(context.Background()); err != nil {
+			t.Fatalf("%d, unexpected error, %v", i, err)
+		}
+	}
+	// The first request is made straight away
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("expected requests to be spaced out, took %v", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	b.throttled()
+	if err := b.wait(ctx); err != context.Canceled {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+}
@@ -0,0 +1,70 @@
+package forgelib
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+)
+
+// DeletionPolicyDelete is the deletion policy applied by CloudFormation when a
+// resource does not declare one
+const DeletionPolicyDelete = "Delete"
+
+// StackResource describes a resource belonging to a stack, along with the
+// deletion policy which CloudFormation will apply to it when the stack is
+// destroyed
+type StackResource struct {
+	DeletionPolicy     string
+	LogicalResourceID  string
+	PhysicalResourceID string
+	ResourceStatus     string
+	ResourceType       string
+}
+
+// Retained reports whether the resource will be left behind (or snapshotted)
+// rather than deleted when the stack is destroyed
+func (r StackResource) Retained() bool {
+	return r.DeletionPolicy != DeletionPolicyDelete
+}
+
+// ListResources will get all resources of the stack, including the deletion
+// policy declared for each of them in the deployed template
+func (s *Stack) ListResources() (resources []StackResource, err error) {
+	if s.StackID == "" {
+		return resources, ErrNoStackID
+	}
+
+	templateOut, err := s.cfn().GetTemplate(&cloudformation.GetTemplateInput{
+		StackName:     aws.String(s.StackID),
+		TemplateStage: aws.String(cloudformation.TemplateStageProcessed),
+	})
+	if err != nil {
+		return resources, err
+	}
+	deletionPolicies, err := parseDeletionPolicies(aws.StringValue(templateOut.TemplateBody))
+	if err != nil {
+		return resources, err
+	}
+
+	err = s.cfn().ListStackResourcesPages(
+		&cloudformation.ListStackResourcesInput{
+			StackName: aws.String(s.StackID),
+		}, func(page *cloudformation.ListStackResourcesOutput, lastPage bool) bool {
+			for _, r := range page.StackResourceSummaries {
+				policy, ok := deletionPolicies[*r.LogicalResourceId]
+				if !ok {
+					policy = DeletionPolicyDelete
+				}
+				resources = append(resources, StackResource{
+					DeletionPolicy:     policy,
+					LogicalResourceID:  aws.StringValue(r.LogicalResourceId),
+					PhysicalResourceID: aws.StringValue(r.PhysicalResourceId),
+					ResourceStatus:     aws.StringValue(r.ResourceStatus),
+					ResourceType:       aws.StringValue(r.ResourceType),
+				})
+			}
+			// Continue reading all pages
+			return true
+		},
+	)
+	return resources, err
+}
@@ -0,0 +1,115 @@
+package forgelib
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+)
+
+func TestListResources(t *testing.T) {
+	cases := []struct {
+		templateBody   string
+		stackResources []*cloudformation.StackResourceSummary
+		expected       []StackResource
+	}{
+		// JSON template with a retained bucket
+		{
+			templateBody: `{"Resources":{"Bucket":{"Type":"AWS::S3::Bucket","DeletionPolicy":"Retain"},"Topic":{"Type":"AWS::SNS::Topic"}}}`,
+			stackResources: []*cloudformation.StackResourceSummary{
+				{
+					LogicalResourceId:  aws.String("Bucket"),
+					PhysicalResourceId: aws.String("my-bucket"),
+					ResourceStatus:     aws.String(cloudformation.ResourceStatusCreateComplete),
+					ResourceType:       aws.String("AWS::S3::Bucket"),
+				},
+				{
+					LogicalResourceId:  aws.String("Topic"),
+					PhysicalResourceId: aws.String("arn:aws:sns:us-east-1:111111111111:topic"),
+					ResourceStatus:     aws.String(cloudformation.ResourceStatusCreateComplete),
+					ResourceType:       aws.String("AWS::SNS::Topic"),
+				},
+			},
+			expected: []StackResource{
+				{
+					DeletionPolicy:     "Retain",
+					LogicalResourceID:  "Bucket",
+					PhysicalResourceID: "my-bucket",
+					ResourceStatus:     cloudformation.ResourceStatusCreateComplete,
+					ResourceType:       "AWS::S3::Bucket",
+				},
+				{
+					DeletionPolicy:     DeletionPolicyDelete,
+					LogicalResourceID:  "Topic",
+					PhysicalResourceID: "arn:aws:sns:us-east-1:111111111111:topic",
+					ResourceStatus:     cloudformation.ResourceStatusCreateComplete,
+					ResourceType:       "AWS::SNS::Topic",
+				},
+			},
+		},
+		// YAML template with short-form functions and a snapshotted volume
+		{
+			templateBody: "---\nResources:\n  Volume:\n    Type: AWS::EC2::Volume\n    DeletionPolicy: Snapshot\n    Properties:\n      AvailabilityZone: !Select [0, !GetAZs '']\n",
+			stackResources: []*cloudformation.StackResourceSummary{
+				{
+					LogicalResourceId: aws.String("Volume"),
+					ResourceStatus:    aws.String(cloudformation.ResourceStatusCreateInProgress),
+					ResourceType:      aws.String("AWS::EC2::Volume"),
+				},
+			},
+			expected: []StackResource{
+				{
+					DeletionPolicy:    "Snapshot",
+					LogicalResourceID: "Volume",
+					ResourceStatus:    cloudformation.ResourceStatusCreateInProgress,
+					ResourceType:      "AWS::EC2::Volume",
+				},
+			},
+		},
+	}
+
+	oldCFNClient := defaultClient.cfnClient
+	defer func() { defaultClient.cfnClient = oldCFNClient }()
+	for i, c := range cases {
+		defaultClient.cfnClient = mockCfn{
+			templateBody:   c.templateBody,
+			stackResources: c.stackResources,
+		}
+
+		s := Stack{StackID: "whatever"}
+		resources, err := s.ListResources()
+		if err != nil {
+			t.Fatalf("%d, unexpected error, %v", i, err)
+		}
+		if !reflect.DeepEqual(c.expected, resources) {
+			t.Errorf("%d, expected %+v, got %+v", i, c.expected, resources)
+		}
+	}
+}
+
+func TestListResourcesNoStackID(t *testing.T) {
+	s := Stack{}
+
+	if _, err := s.ListResources(); err == nil {
+		t.Errorf("expected error, got success")
+	}
+}
+
+func TestStackResourceRetained(t *testing.T) {
+	cases := []struct {
+		deletionPolicy string
+		expected       bool
+	}{
+		{deletionPolicy: "Delete", expected: false},
+		{deletionPolicy: "Retain", expected: true},
+		{deletionPolicy: "Snapshot", expected: true},
+	}
+
+	for i, c := range cases {
+		r := StackResource{DeletionPolicy: c.deletionPolicy}
+		if e, g := c.expected, r.Retained(); e != g {
+			t.Errorf("%d, expected %t, got %t", i, e, g)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package forgelib
+
+import (
+	"bytes"
+	"compress/gzip"
+	_ "embed" // For the bundled resource specification
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The resource specification bundled with Forge, refreshed from the one
+// published by AWS with "make update-resource-spec"
+//
+//go:embed resourcespec.json
+var bundledResourceSpecBody []byte
+
+var (
+	bundledResourceSpec     *ResourceSpec
+	bundledResourceSpecErr  error
+	bundledResourceSpecOnce sync.Once
+)
+
+// ResourceSpec is the CloudFormation resource specification, which describes
+// the properties of each resource type
+type ResourceSpec struct {
+	PropertyTypes                map[string]ResourceSpecType
+	ResourceSpecificationVersion string
+	ResourceTypes                map[string]ResourceSpecType
+}
+
+// ResourceSpecType describes a resource type, or a property type which is
+// used by resource types
+type ResourceSpecType struct {
+	Properties map[string]ResourceSpecProperty
+	// A few property types are a list or primitive, rather than having
+	// properties of their own
+	ResourceSpecProperty
+}
+
+// ResourceSpecProperty describes the value of a property. Lists and maps have
+// an ItemType or PrimitiveItemType for their items
+type ResourceSpecProperty struct {
+	ItemType          string
+	PrimitiveItemType string
+	PrimitiveType     string
+	Required          bool
+	// "List", "Map", or the name of a property type
+	Type string
+}
+
+// ParseResourceSpec parses a resource specification as published by AWS, which
+// may be gzipped
+func ParseResourceSpec(body []byte) (*ResourceSpec, error) {
+	if bytes.HasPrefix(body, []byte{0x1f, 0x8b}) {
+		r, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		if body, err = ioutil.ReadAll(r); err != nil {
+			return nil, err
+		}
+	}
+	spec := ResourceSpec{}
+	if err := json.Unmarshal(body, &spec); err != nil {
+		return nil, fmt.Errorf("Invalid resource specification: %w", err)
+	}
+	if len(spec.ResourceTypes) == 0 {
+		return nil, fmt.Errorf("Invalid resource specification: no resource types are defined")
+	}
+	return &spec, nil
+}
+
+// BundledResourceSpec returns the resource specification bundled with Forge
+func BundledResourceSpec() (*ResourceSpec, error) {
+	bundledResourceSpecOnce.Do(func() {
+		bundledResourceSpec, bundledResourceSpecErr = ParseResourceSpec(bundledResourceSpecBody)
+	})
+	return bundledResourceSpec, bundledResourceSpecErr
+}
+
+// propertyType finds a property type used by a resource type, which is
+// either specific to the resource type or shared (such as Tag), returning its
+// full name
+func (spec *ResourceSpec) propertyType(resourceType, name string) (string, ResourceSpecType, bool) {
+	if t, ok := spec.PropertyTypes[resourceType+"."+name]; ok {
+		return resourceType + "." + name, t, true
+	}
+	t, ok := spec.PropertyTypes[name]
+	return name, t, ok
+}
+
+// Custom resources take any properties as well as those in the specification
+const customResourceType = "AWS::CloudFormation::CustomResource"
+
+func isCustomResourceType(resourceType string) bool {
+	return resourceType == customResourceType || strings.HasPrefix(resourceType, "Custom::")
+}
+
+// checkResourceProperties reports resources of types which aren't in the
+// specification, and properties which are unknown, missing or of the wrong type
+func (l *linter) checkResourceProperties(spec *ResourceSpec) {
+	for _, r := range l.resources {
+		typeNode := mappingValue(r.value, "Type")
+		if typeNode == nil || typeNode.Kind != yaml.ScalarNode {
+			l.add(LintError, "resource-type", r.key, "Resource %q has no Type", r.name)
+			continue
+		}
+		resourceType := typeNode.Value
+		specType, ok := spec.ResourceTypes[resourceType]
+		if isCustomResourceType(resourceType) {
+			specType, ok = spec.ResourceTypes[customResourceType]
+		}
+		if !ok {
+			if spec.ResourceSpecificationVersion != "" {
+				l.add(LintWarning, "resource-type", typeNode, "Resource type %q is not in version %s of the resource specification", resourceType, spec.ResourceSpecificationVersion)
+			} else {
+				l.add(LintWarning, "resource-type", typeNode, "Resource type %q is not in the resource specification", resourceType)
+			}
+			continue
+		}
+
+		properties := mappingValue(r.value, "Properties")
+		if properties == nil {
+			l.checkRequiredProperties(resourceType, specType, nil, typeNode)
+			continue
+		}
+		l.checkProperties(spec, resourceType, resourceType, specType, properties, !isCustomResourceType(resourceType))
+	}
+}
+
+// checkProperties checks the properties of a resource, or of a property which
+// has a property type
+func (l *linter) checkProperties(spec *ResourceSpec, resourceType, typeName string, specType ResourceSpecType, n *yaml.Node, strict bool) {
+	if name, _ := intrinsicFunction(n); name != "" {
+		return
+	}
+	if specType.Properties == nil && (specType.Type != "" || specType.PrimitiveType != "") {
+		l.checkPropertyValue(spec, resourceType, typeName, specType.ResourceSpecProperty, n)
+		return
+	}
+	if n.Kind != yaml.MappingNode {
+		l.add(LintError, "property-type", n, "%s must be a mapping of properties", typeName)
+		return
+	}
+	for _, e := range mappingEntries(n) {
+		property, ok := specType.Properties[e.name]
+		if !ok {
+			if strict {
+				l.add(LintError, "unknown-property", e.key, "%q is not a property of %s", e.name, typeName)
+			}
+			continue
+		}
+		l.checkPropertyValue(spec, resourceType, e.name, property, e.value)
+	}
+	l.checkRequiredProperties(typeName, specType, n, n)
+}
+
+func (l *linter) checkRequiredProperties(typeName string, specType ResourceSpecType, properties *yaml.Node, position *yaml.Node) {
+	var missing []string
+	for name, property := range specType.Properties {
+		if property.Required && mappingValue(properties, name) == nil {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(missing)
+	for _, name := range missing {
+		l.add(LintError, "missing-property", position, "%s requires the property %q", typeName, name)
+	}
+}
+
+func (l *linter) checkPropertyValue(spec *ResourceSpec, resourceType, name string, property ResourceSpecProperty, n *yaml.Node) {
+	// The values of functions aren't known until the stack is deployed
+	if fn, _ := intrinsicFunction(n); fn != "" || n.Tag == "!!null" {
+		return
+	}
+	switch {
+	case property.PrimitiveType != "":
+		l.checkPrimitiveValue(name, property.PrimitiveType, n)
+	case property.Type == "List":
+		if n.Kind != yaml.SequenceNode {
+			l.add(LintError, "property-type", n, "Property %q must be a list", name)
+			return
+		}
+		for _, item := range n.Content {
+			l.checkPropertyValue(spec, resourceType, name, itemProperty(property), item)
+		}
+	case property.Type == "Map":
+		if n.Kind != yaml.MappingNode {
+			l.add(LintError, "property-type", n, "Property %q must be a mapping", name)
+			return
+		}
+		for _, e := range mappingEntries(n) {
+			l.checkPropertyValue(spec, resourceType, name, itemProperty(property), e.value)
+		}
+	case property.Type != "":
+		// Property types missing from the specification aren't checked
+		typeName, specType, ok := spec.propertyType(resourceType, property.Type)
+		if !ok {
+			return
+		}
+		l.checkProperties(spec, resourceType, typeName, specType, n, true)
+	}
+}
+
+// itemProperty describes the items of a list or map property
+func itemProperty(property ResourceSpecProperty) ResourceSpecProperty {
+	return ResourceSpecProperty{
+		PrimitiveType: property.PrimitiveItemType,
+		Type:          property.ItemType,
+	}
+}
+
+func (l *linter) checkPrimitiveValue(name, primitiveType string, n *yaml.Node) {
+	if primitiveType == "Json" {
+		return
+	}
+	valid := n.Kind == yaml.ScalarNode
+	if valid {
+		// CloudFormation converts strings to numbers and booleans, so the
+		// values are checked as strings
+		switch primitiveType {
+		case "Integer", "Long":
+			_, err := strconv.ParseInt(n.Value, 10, 64)
+			valid = err == nil
+		case "Double":
+			_, err := strconv.ParseFloat(n.Value, 64)
+			valid = err == nil
+		case "Boolean":
+			valid = strings.EqualFold(n.Value, "true") || strings.EqualFold(n.Value, "false")
+		}
+	}
+	if !valid {
+		l.add(LintError, "property-type", n, "Property %q must be of type %s", name, primitiveType)
+	}
+}
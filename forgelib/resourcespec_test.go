@@ -0,0 +1,195 @@
+package forgelib
+
+import (
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+)
+
+func TestLintResourceProperties(t *testing.T) {
+	cases := []struct {
+		body           string
+		expectFindings []string
+	}{
+		{
+			body: `
+Resources:
+  Bucket:
+    Type: AWS::S3::Bucket
+    Properties:
+      BucketNme: test
+      VersioningConfiguration:
+        Statuz: Enabled
+      Tags:
+        - Key: team
+          Value: platform
+        - Key: 5
+  Function:
+    Type: AWS::Lambda::Function
+    Properties:
+      Code: {ZipFile: "exports.handler = () => {}"}
+      MemorySize: big
+      Timeout: "30"
+      Layers: !Ref AWS::NoValue
+      Environment:
+        Variables:
+          Nested: {Not: allowed}
+  Queue:
+    Type: AWS::SQS::Queue
+    Properties:
+      FifoQueue: yes
+      Tags: {team: platform}
+      VisibilityTimeout: !If [Always, 30, !Ref AWS::NoValue]
+  Key:
+    Type: AWS::KMS::Alias
+`,
+			expectFindings: []string{
+				`6:7: error: "BucketNme" is not a property of AWS::S3::Bucket (unknown-property)`,
+				`8:9: error: "Statuz" is not a property of AWS::S3::Bucket.VersioningConfiguration (unknown-property)`,
+				`8:9: error: AWS::S3::Bucket.VersioningConfiguration requires the property "Status" (missing-property)`,
+				`12:11: error: Tag requires the property "Value" (missing-property)`,
+				`16:7: error: AWS::Lambda::Function requires the property "Role" (missing-property)`,
+				`17:19: error: Property "MemorySize" must be of type Integer (property-type)`,
+				`22:19: error: Property "Variables" must be of type String (property-type)`,
+				`26:18: error: Property "FifoQueue" must be of type Boolean (property-type)`,
+				`27:13: error: Property "Tags" must be a list (property-type)`,
+				`28:31: error: Condition "Always" is not defined (missing-reference)`,
+				`30:11: error: AWS::KMS::Alias requires the property "AliasName" (missing-property)`,
+				`30:11: error: AWS::KMS::Alias requires the property "TargetKeyId" (missing-property)`,
+			},
+		},
+		{
+			// Custom resources accept properties beyond the service token
+			body: `
+Resources:
+  Custom:
+    Type: Custom::Thing
+    Properties:
+      ServiceToken: arn:aws:lambda:us-east-1:111111111111:function:thing
+      Anything: [1, 2]
+  MissingToken:
+    Type: AWS::CloudFormation::CustomResource
+    Properties:
+      Anything: 1
+  ThirdParty:
+    Type: Example::Service::Thing
+    Properties:
+      Anything: 1
+  Untyped:
+    Properties: {}
+`,
+			expectFindings: []string{
+				`11:7: error: AWS::CloudFormation::CustomResource requires the property "ServiceToken" (missing-property)`,
+				`13:11: warning: Resource type "Example::Service::Thing" is not in the resource specification (resource-type)`,
+				`16:3: error: Resource "Untyped" has no Type (resource-type)`,
+			},
+		},
+	}
+
+	for i, c := range cases {
+		findings, err := LintTemplate([]byte(c.body))
+		if err != nil {
+			t.Fatalf("%d, unexpected error, %v", i, err)
+		}
+		got := []string{}
+		for _, f := range findings {
+			got = append(got, f.String())
+		}
+		if e, g := strings.Join(c.expectFindings, "\n"), strings.Join(got, "\n"); e != g {
+			t.Errorf("%d, expected findings:\n%s\ngot:\n%s", i, e, g)
+		}
+	}
+}
+
+func TestParseResourceSpec(t *testing.T) {
+	specBody := `{
+  "ResourceSpecificationVersion": "1.0.0",
+  "ResourceTypes": {"Example::Thing": {"Properties": {"Name": {"PrimitiveType": "String", "Required": true}}}}
+}`
+	var gzipped bytes.Buffer
+	w := gzip.NewWriter(&gzipped)
+	w.Write([]byte(specBody))
+	w.Close()
+
+	cases := []struct {
+		body        []byte
+		expectError bool
+	}{
+		{body: []byte(specBody)},
+		{body: gzipped.Bytes()},
+		{body: []byte(`{"ResourceTypes": {}}`), expectError: true},
+		{body: []byte(`not json`), expectError: true},
+	}
+	for i, c := range cases {
+		spec, err := ParseResourceSpec(c.body)
+		if c.expectError {
+			if err == nil {
+				t.Errorf("%d, expected error, got success", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%d, unexpected error, %v", i, err)
+		}
+		if !spec.ResourceTypes["Example::Thing"].Properties["Name"].Required {
+			t.Errorf("%d, expected Name to be a required property of Example::Thing", i)
+		}
+
+		findings, err := LintTemplateWithOptions([]byte("Resources: {Thing: {Type: Example::Thing}}"), LintOptions{ResourceSpec: spec})
+		if err != nil {
+			t.Fatalf("%d, unexpected error, %v", i, err)
+		}
+		if len(findings) != 1 || findings[0].Rule != "missing-property" {
+			t.Errorf("%d, expected a missing property, got %v", i, findings)
+		}
+	}
+}
+
+func TestLintUnknownResourceType(t *testing.T) {
+	body := []byte("Resources: {Thing: {Type: Example::Other}}")
+	resourceTypes := map[string]ResourceSpecType{"Example::Thing": {}}
+
+	cases := []struct {
+		spec           ResourceSpec
+		expectFindings []string
+	}{
+		{
+			spec: ResourceSpec{ResourceSpecificationVersion: "1.0.0", ResourceTypes: resourceTypes},
+			expectFindings: []string{
+				`1:27: warning: Resource type "Example::Other" is not in version 1.0.0 of the resource specification (resource-type)`,
+			},
+		},
+		{
+			spec: ResourceSpec{ResourceTypes: resourceTypes},
+			expectFindings: []string{
+				`1:27: warning: Resource type "Example::Other" is not in the resource specification (resource-type)`,
+			},
+		},
+	}
+
+	for i, c := range cases {
+		spec := c.spec
+		findings, err := LintTemplateWithOptions(body, LintOptions{ResourceSpec: &spec})
+		if err != nil {
+			t.Fatalf("%d, unexpected error, %v", i, err)
+		}
+		got := []string{}
+		for _, f := range findings {
+			got = append(got, f.String())
+		}
+		if e, g := strings.Join(c.expectFindings, "\n"), strings.Join(got, "\n"); e != g {
+			t.Errorf("%d, expected findings:\n%s\ngot:\n%s", i, e, g)
+		}
+	}
+}
+
+func TestBundledResourceSpec(t *testing.T) {
+	spec, err := BundledResourceSpec()
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	if _, ok := spec.ResourceTypes["AWS::S3::Bucket"]; !ok {
+		t.Error("expected the bundled specification to include AWS::S3::Bucket")
+	}
+}
@@ -0,0 +1,176 @@
+package forgelib
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/ghodss/yaml"
+)
+
+// CloudFormation has no way to remove a stack policy once one is set, so
+// removing a policy is done by replacing it with one which allows everything
+const allowAllStackPolicy = `{"Statement":[{"Action":"Update:*","Effect":"Allow","Principal":"*","Resource":"*"}]}`
+
+// StackSettings declares the stack-level settings which Deploy will reconcile
+// the stack to. Settings which are nil are not managed, and are left as they
+// are on an existing stack
+type StackSettings struct {
+	CfnRoleName      *string
+	NotificationARNs *[]string
+	// The AWS profile and region to manage the stack with. These configure
+	// the session rather than the stack, so are never reconciled, and blank
+	// values leave them to the flags and environment
+	Profile string
+	Region  string
+	// A blank stack policy body removes the stack policy from the stack
+	StackPolicyBody       *string
+	TerminationProtection *bool
+}
+
+// ParseStackSettings will read stack settings from a YAML or JSON key-value
+// object. Only the keys present in the input are declared
+func ParseStackSettings(input string) (settings StackSettings, err error) {
+	var parsedInput interface{}
+	if err := yaml.Unmarshal([]byte(input), &parsedInput); err != nil {
+		return settings, err
+	}
+	if parsedInput == nil {
+		return settings, nil
+	}
+	parsedMap, ok := parsedInput.(map[string]interface{})
+	if !ok {
+		return settings, fmt.Errorf("Stack settings must be a basic key-value object")
+	}
+
+	for k, v := range parsedMap {
+		switch k {
+		case "CfnRoleName":
+			roleName, ok := v.(string)
+			if !ok {
+				return settings, fmt.Errorf("Stack setting CfnRoleName must be a string")
+			}
+			settings.CfnRoleName = &roleName
+		case "NotificationARNs":
+			arns := []string{}
+			if v != nil {
+				list, ok := v.([]interface{})
+				if !ok {
+					return settings, fmt.Errorf("Stack setting NotificationARNs must be a list")
+				}
+				for _, a := range list {
+					arn, ok := a.(string)
+					if !ok {
+						return settings, fmt.Errorf("Stack setting NotificationARNs must only contain strings")
+					}
+					arns = append(arns, arn)
+				}
+			}
+			settings.NotificationARNs = &arns
+		case "Profile", "Region":
+			value, ok := v.(string)
+			if !ok {
+				return settings, fmt.Errorf("Stack setting %s must be a string", k)
+			}
+			if k == "Profile" {
+				settings.Profile = value
+			} else {
+				settings.Region = value
+			}
+		case "StackPolicy":
+			policyBody := ""
+			if v != nil {
+				jsonPolicy, err := json.Marshal(v)
+				if err != nil {
+					return settings, err
+				}
+				policyBody = string(jsonPolicy)
+			}
+			settings.StackPolicyBody = &policyBody
+		case "TerminationProtection":
+			terminationProtection, ok := v.(bool)
+			if !ok {
+				return settings, fmt.Errorf("Stack setting TerminationProtection must be a boolean")
+			}
+			settings.TerminationProtection = &terminationProtection
+		default:
+			return settings, fmt.Errorf("Unknown stack setting \"%s\"", k)
+		}
+	}
+	return settings, nil
+}
+
+// declaredSettings merges the individually set fields of the stack into its
+// declared settings, with the individual fields taking precedence. The stack
+// policy is converted to JSON
+func (s *Stack) declaredSettings() (settings StackSettings, err error) {
+	settings = s.Settings
+
+	// The TerminationProtection field is only ever used to turn protection on
+	if s.TerminationProtection {
+		settings.TerminationProtection = aws.Bool(true)
+	}
+	if s.CfnRoleName != "" {
+		settings.CfnRoleName = aws.String(s.CfnRoleName)
+	}
+	if s.StackPolicyBody != "" {
+		settings.StackPolicyBody = aws.String(s.StackPolicyBody)
+	}
+
+	if p := settings.StackPolicyBody; p != nil {
+		if *p == "" {
+			settings.StackPolicyBody = aws.String(allowAllStackPolicy)
+		} else {
+			jsonStackPolicy, err := yaml.YAMLToJSON([]byte(*p))
+			if err != nil {
+				return settings, err
+			}
+			settings.StackPolicyBody = aws.String(string(jsonStackPolicy))
+		}
+	}
+	return settings, nil
+}
+
+// ProtectionReductions lists the changes which reconciling the declared
+// settings would make that reduce the protection of the existing stack. Deploy
+// will refuse to make these changes unless AllowProtectionReduction is set
+func (s *Stack) ProtectionReductions() ([]string, error) {
+	return s.ProtectionReductionsWithContext(context.Background())
+}
+
+// ProtectionReductionsWithContext performs the same function as
+// ProtectionReductions, with a context to cancel the requests
+func (s *Stack) ProtectionReductionsWithContext(ctx context.Context) (reductions []string, err error) {
+	settings, err := s.declaredSettings()
+	if err != nil {
+		return reductions, err
+	}
+	return s.protectionReductions(ctx, settings)
+}
+
+func (s *Stack) protectionReductions(ctx context.Context, settings StackSettings) (reductions []string, err error) {
+	if s.StackInfo == nil {
+		return reductions, nil
+	}
+
+	if t := settings.TerminationProtection; t != nil && !*t &&
+		aws.BoolValue(s.StackInfo.EnableTerminationProtection) {
+		reductions = append(reductions, "Termination protection will be disabled")
+	}
+
+	if p := settings.StackPolicyBody; p != nil && *p == allowAllStackPolicy {
+		currentPolicy, err := s.cfn().GetStackPolicyWithContext(ctx, &cloudformation.GetStackPolicyInput{
+			StackName: aws.String(s.StackID),
+		})
+		if err != nil {
+			return reductions, err
+		}
+		if b := aws.StringValue(currentPolicy.StackPolicyBody); b != "" && b != allowAllStackPolicy {
+			reductions = append(reductions, "Stack policy will be removed")
+		}
+	}
+
+	return reductions, nil
+}
@@ -0,0 +1,161 @@
+package forgelib
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+)
+
+func TestParseStackSettings(t *testing.T) {
+	cases := []struct {
+		input    string
+		expected StackSettings
+	}{
+		// Nothing declared
+		{
+			input:    "",
+			expected: StackSettings{},
+		},
+		// Everything declared in YAML
+		{
+			input: `---
+TerminationProtection: true
+CfnRoleName: deploy-role
+Profile: deploy
+Region: ap-southeast-2
+NotificationARNs:
+  - arn:aws:sns:us-east-1:111111111111:events
+StackPolicy:
+  Statement:
+  - Effect: Deny
+    Action: Update:Replace
+    Principal: '*'
+    Resource: LogicalResourceId/Database`,
+			expected: StackSettings{
+				CfnRoleName:           aws.String("deploy-role"),
+				NotificationARNs:      &[]string{"arn:aws:sns:us-east-1:111111111111:events"},
+				Profile:               "deploy",
+				Region:                "ap-southeast-2",
+				StackPolicyBody:       aws.String(`{"Statement":[{"Action":"Update:Replace","Effect":"Deny","Principal":"*","Resource":"LogicalResourceId/Database"}]}`),
+				TerminationProtection: aws.Bool(true),
+			},
+		},
+		// Removal of settings in JSON
+		{
+			input: `{"TerminationProtection":false,"NotificationARNs":[],"StackPolicy":null}`,
+			expected: StackSettings{
+				NotificationARNs:      &[]string{},
+				StackPolicyBody:       aws.String(""),
+				TerminationProtection: aws.Bool(false),
+			},
+		},
+	}
+
+	for i, c := range cases {
+		settings, err := ParseStackSettings(c.input)
+		if err != nil {
+			t.Fatalf("%d, unexpected error, %v", i, err)
+		}
+		if !reflect.DeepEqual(c.expected, settings) {
+			t.Errorf("%d, expected %+v, got %+v", i, c.expected, settings)
+		}
+	}
+}
+
+func TestParseStackSettingsErrors(t *testing.T) {
+	cases := []string{
+		`["not", "an", "object"]`,
+		`{"TerminationProtection":"yes please"}`,
+		`{"NotificationARNs":"arn:aws:sns:us-east-1:111111111111:events"}`,
+		`{"NotificationARNs":[1]}`,
+		`{"CfnRoleName":["deploy-role"]}`,
+		`{"Region":["us-east-1"]}`,
+		`{"TerminationProtecton":true}`,
+	}
+
+	for i, c := range cases {
+		if _, err := ParseStackSettings(c); err == nil {
+			t.Errorf("%d, expected error, got success", i)
+		}
+	}
+}
+
+func TestProtectionReductions(t *testing.T) {
+	denyReplace := `{"Statement":[{"Action":"Update:Replace","Effect":"Deny","Principal":"*","Resource":"*"}]}`
+	cases := []struct {
+		stack         Stack
+		stackPolicies map[string]string
+		expected      []string
+	}{
+		// New stack
+		{
+			stack: Stack{
+				Settings: StackSettings{
+					StackPolicyBody:       aws.String(""),
+					TerminationProtection: aws.Bool(false),
+				},
+			},
+		},
+		// Nothing declared
+		{
+			stack: Stack{
+				StackID: "test-stack/id0",
+				StackInfo: &cloudformation.Stack{
+					EnableTerminationProtection: aws.Bool(true),
+				},
+			},
+			stackPolicies: map[string]string{"test-stack/id0": denyReplace},
+		},
+		// Everything removed
+		{
+			stack: Stack{
+				Settings: StackSettings{
+					StackPolicyBody:       aws.String(""),
+					TerminationProtection: aws.Bool(false),
+				},
+				StackID: "test-stack/id0",
+				StackInfo: &cloudformation.Stack{
+					EnableTerminationProtection: aws.Bool(true),
+				},
+			},
+			stackPolicies: map[string]string{"test-stack/id0": denyReplace},
+			expected: []string{
+				"Termination protection will be disabled",
+				"Stack policy will be removed",
+			},
+		},
+		// Removing settings which are already absent
+		{
+			stack: Stack{
+				Settings: StackSettings{
+					StackPolicyBody:       aws.String(""),
+					TerminationProtection: aws.Bool(false),
+				},
+				StackID: "test-stack/id0",
+				StackInfo: &cloudformation.Stack{
+					EnableTerminationProtection: aws.Bool(false),
+				},
+			},
+		},
+	}
+
+	oldCFNClient := defaultClient.cfnClient
+	defer func() { defaultClient.cfnClient = oldCFNClient }()
+	for i, c := range cases {
+		theseStackPolicies := c.stackPolicies
+		if theseStackPolicies == nil {
+			theseStackPolicies = map[string]string{}
+		}
+		defaultClient.cfnClient = mockCfn{stackPolicies: &theseStackPolicies}
+
+		reductions, err := c.stack.ProtectionReductions()
+		if err != nil {
+			t.Fatalf("%d, unexpected error, %v", i, err)
+		}
+		if !reflect.DeepEqual(c.expected, reductions) {
+			t.Errorf("%d, expected %+v, got %+v", i, c.expected, reductions)
+		}
+	}
+}
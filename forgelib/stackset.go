@@ -0,0 +1,441 @@
+package forgelib
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+	"github.com/ghodss/yaml"
+)
+
+// StackSet represents the attributes of a StackSet deployment, and the
+// accounts (or organizational units) and regions which its stack instances are
+// deployed to
+type StackSet struct {
+	Accounts              []string
+	AdministrationRoleARN string
+	// Defaults to the package-level client
+	Client                *Client
+	ExecutionRoleName     string
+	FailureToleranceCount int64
+	MaxConcurrentCount    int64
+	OperationCallback     func(StackSetOperation)
+	OrganizationalUnitIDs []string
+	ParameterBodies       []string
+	ParameterOverrides    map[string]string
+	// Names for ParameterBodies, in the same order, such as the files which
+	// they were read from
+	ParameterSources []string
+	// How often operations are checked on. Defaults to DefaultWaitInterval
+	PollingPeriod time.Duration
+	// The AWS profile and region to manage the StackSet from, as read by
+	// ParseStackSetConfig. Deploy doesn't use these; they are for configuring
+	// the session
+	Profile      string
+	Region       string
+	Regions      []string
+	StackSetName string
+	// Reject parameter keys which aren't in the template, and template
+	// parameters which have neither a value nor a default, before deploying
+	StrictParameters bool
+	TagsBody         string
+	TemplateBody     string
+}
+
+// StackSetOperation describes the outcome of an operation against a StackSet
+type StackSetOperation struct {
+	Action      string
+	OperationID string
+	Results     []StackInstanceResult
+	Status      string
+}
+
+// StackInstanceResult describes the outcome of an operation for a single stack
+// instance of a StackSet
+type StackInstanceResult struct {
+	Account              string
+	OrganizationalUnitID string
+	Region               string
+	Status               string
+	StatusReason         string
+}
+
+// ParseStackSetConfig will read the deployment targets and operation
+// preferences for a StackSet from a YAML or JSON key-value object
+func ParseStackSetConfig(input string) (s StackSet, err error) {
+	var parsedInput interface{}
+	if err := yaml.Unmarshal([]byte(input), &parsedInput); err != nil {
+		return s, err
+	}
+	if parsedInput == nil {
+		return s, nil
+	}
+	parsedMap, ok := parsedInput.(map[string]interface{})
+	if !ok {
+		return s, fmt.Errorf("StackSet config must be a basic key-value object")
+	}
+
+	for k, v := range parsedMap {
+		switch k {
+		case "Accounts", "OrganizationalUnitIds", "Regions":
+			list, ok := v.([]interface{})
+			if !ok {
+				return s, fmt.Errorf("StackSet config %s must be a list", k)
+			}
+			var values []string
+			for _, i := range list {
+				// Account IDs must be quoted, as YAML would otherwise read
+				// them as numbers and lose any leading zeros
+				value, ok := i.(string)
+				if !ok {
+					return s, fmt.Errorf("StackSet config %s must only contain strings", k)
+				}
+				values = append(values, value)
+			}
+			switch k {
+			case "Accounts":
+				s.Accounts = values
+			case "OrganizationalUnitIds":
+				s.OrganizationalUnitIDs = values
+			case "Regions":
+				s.Regions = values
+			}
+		case "FailureToleranceCount", "MaxConcurrentCount":
+			count, ok := v.(float64)
+			if !ok || count < 0 || count != float64(int64(count)) {
+				return s, fmt.Errorf("StackSet config %s must be a whole number", k)
+			}
+			if k == "FailureToleranceCount" {
+				s.FailureToleranceCount = int64(count)
+			} else {
+				s.MaxConcurrentCount = int64(count)
+			}
+		case "AdministrationRoleARN", "ExecutionRoleName", "Profile", "Region":
+			value, ok := v.(string)
+			if !ok {
+				return s, fmt.Errorf("StackSet config %s must be a string", k)
+			}
+			switch k {
+			case "AdministrationRoleARN":
+				s.AdministrationRoleARN = value
+			case "ExecutionRoleName":
+				s.ExecutionRoleName = value
+			case "Profile":
+				s.Profile = value
+			case "Region":
+				s.Region = value
+			}
+		default:
+			return s, fmt.Errorf("Unknown StackSet config \"%s\"", k)
+		}
+	}
+	return s, nil
+}
+
+// Deploy will create or update the StackSet, then create stack instances in
+// each of the target accounts (or organizational units) and regions which don't
+// have one yet. Updating the StackSet also updates all of its existing stack
+// instances, including those in the target accounts and regions, as part of
+// the same UPDATE operation. Each operation is followed until it finishes, and
+// an error is returned if any of them failed
+func (s *StackSet) Deploy() ([]StackSetOperation, error) {
+	return s.DeployWithContext(context.Background())
+}
+
+// DeployWithContext performs the same function as Deploy, with a context to
+// cancel the requests and stop following the operations. Cancelling the
+// context doesn't stop an operation which has already started
+func (s *StackSet) DeployWithContext(ctx context.Context) (operations []StackSetOperation, err error) {
+	if s.StackSetName == "" {
+		return operations, ErrNoStackSetName
+	}
+	if len(s.Accounts) > 0 && len(s.OrganizationalUnitIDs) > 0 {
+		return operations, fmt.Errorf("StackSet instances can target either accounts or organizational units, not both")
+	}
+
+	validationResult, err := s.cfn().ValidateTemplateWithContext(
+		ctx,
+		&cloudformation.ValidateTemplateInput{
+			TemplateBody: aws.String(s.TemplateBody),
+		},
+	)
+	if err != nil {
+		return operations, err
+	}
+
+	var tags []*cloudformation.Tag
+	if s.TagsBody != "" {
+		tags, err = parseTags(s.TagsBody)
+		if err != nil {
+			return operations, err
+		}
+	}
+
+	inputParams, err := resolveParameters(s.TemplateBody, validationResult.Parameters, parameterInputs{
+		bodies:    s.ParameterBodies,
+		overrides: s.ParameterOverrides,
+		sources:   s.ParameterSources,
+		strict:    s.StrictParameters,
+	})
+	if err != nil {
+		return operations, err
+	}
+
+	var administrationRoleARN, executionRoleName *string
+	if s.AdministrationRoleARN != "" {
+		administrationRoleARN = aws.String(s.AdministrationRoleARN)
+	}
+	if s.ExecutionRoleName != "" {
+		executionRoleName = aws.String(s.ExecutionRoleName)
+	}
+
+	_, err = s.cfn().DescribeStackSetWithContext(ctx, &cloudformation.DescribeStackSetInput{
+		StackSetName: aws.String(s.StackSetName),
+	})
+	if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == cloudformation.ErrCodeStackSetNotFoundException {
+		createInput := &cloudformation.CreateStackSetInput{
+			StackSetName:          aws.String(s.StackSetName),
+			TemplateBody:          aws.String(s.TemplateBody),
+			Capabilities:          validationResult.Capabilities,
+			Tags:                  tags,
+			Parameters:            inputParams,
+			AdministrationRoleARN: administrationRoleARN,
+			ExecutionRoleName:     executionRoleName,
+		}
+		if s.serviceManaged() {
+			createInput.PermissionModel = aws.String(cloudformation.PermissionModelsServiceManaged)
+			createInput.AutoDeployment = &cloudformation.AutoDeployment{Enabled: aws.Bool(false)}
+		}
+		if _, err := s.cfn().CreateStackSetWithContext(ctx, createInput); err != nil {
+			return operations, err
+		}
+	} else if err != nil {
+		return operations, err
+	} else {
+		updateOut, err := s.cfn().UpdateStackSetWithContext(
+			ctx,
+			&cloudformation.UpdateStackSetInput{
+				StackSetName:          aws.String(s.StackSetName),
+				TemplateBody:          aws.String(s.TemplateBody),
+				Capabilities:          validationResult.Capabilities,
+				Tags:                  tags,
+				Parameters:            inputParams,
+				AdministrationRoleARN: administrationRoleARN,
+				ExecutionRoleName:     executionRoleName,
+				OperationPreferences:  s.operationPreferences(),
+			},
+		)
+		if err != nil {
+			return operations, err
+		}
+		operation, err := s.waitForOperation(ctx, "UPDATE", *updateOut.OperationId)
+		operations = append(operations, operation)
+		if err != nil {
+			return operations, err
+		}
+	}
+
+	missingInstances, err := s.missingInstances(ctx)
+	if err != nil {
+		return operations, err
+	}
+	for _, m := range missingInstances {
+		createInput := &cloudformation.CreateStackInstancesInput{
+			StackSetName:         aws.String(s.StackSetName),
+			Regions:              aws.StringSlice(m.regions),
+			OperationPreferences: s.operationPreferences(),
+		}
+		if s.serviceManaged() {
+			createInput.DeploymentTargets = &cloudformation.DeploymentTargets{
+				OrganizationalUnitIds: aws.StringSlice(m.targets),
+			}
+		} else {
+			createInput.Accounts = aws.StringSlice(m.targets)
+		}
+		createOut, err := s.cfn().CreateStackInstancesWithContext(ctx, createInput)
+		if err != nil {
+			return operations, err
+		}
+		operation, err := s.waitForOperation(ctx, "CREATE", *createOut.OperationId)
+		operations = append(operations, operation)
+		if err != nil {
+			return operations, err
+		}
+	}
+	return operations, nil
+}
+
+// client returns the client which the StackSet is managed with
+func (s *StackSet) client() *Client {
+	if s.Client != nil {
+		return s.Client
+	}
+	return defaultClient
+}
+
+// cfn returns the CloudFormation client used to manage the StackSet
+func (s *StackSet) cfn() cloudformationiface.CloudFormationAPI {
+	return s.client().cfn()
+}
+
+// StackSets which target organizational units have their permissions managed
+// by AWS Organizations
+func (s *StackSet) serviceManaged() bool {
+	return len(s.OrganizationalUnitIDs) > 0
+}
+
+func (s *StackSet) operationPreferences() *cloudformation.StackSetOperationPreferences {
+	preferences := &cloudformation.StackSetOperationPreferences{
+		FailureToleranceCount: aws.Int64(s.FailureToleranceCount),
+	}
+	if s.MaxConcurrentCount > 0 {
+		preferences.MaxConcurrentCount = aws.Int64(s.MaxConcurrentCount)
+	}
+	if len(s.Regions) > 0 {
+		preferences.RegionOrder = aws.StringSlice(s.Regions)
+	}
+	return preferences
+}
+
+type stackInstanceTargets struct {
+	targets []string
+	regions []string
+}
+
+// missingInstances groups the target accounts (or organizational units) which
+// don't have a stack instance yet by the regions they are missing from, so
+// that they can be created with as few operations as possible
+func (s *StackSet) missingInstances(ctx context.Context) (missing []stackInstanceTargets, err error) {
+	existing := map[string]bool{}
+	err = s.cfn().ListStackInstancesPagesWithContext(
+		ctx,
+		&cloudformation.ListStackInstancesInput{
+			StackSetName: aws.String(s.StackSetName),
+		}, func(page *cloudformation.ListStackInstancesOutput, lastPage bool) bool {
+			for _, i := range page.Summaries {
+				target := aws.StringValue(i.Account)
+				if s.serviceManaged() {
+					target = aws.StringValue(i.OrganizationalUnitId)
+				}
+				existing[target+"/"+aws.StringValue(i.Region)] = true
+			}
+			// Continue reading all pages
+			return true
+		},
+	)
+	if err != nil {
+		return missing, err
+	}
+
+	targets := s.Accounts
+	if s.serviceManaged() {
+		targets = s.OrganizationalUnitIDs
+	}
+
+	groupIndex := map[string]int{}
+	for _, r := range s.Regions {
+		var regionTargets []string
+		for _, t := range targets {
+			if !existing[t+"/"+r] {
+				regionTargets = append(regionTargets, t)
+			}
+		}
+		if len(regionTargets) == 0 {
+			continue
+		}
+		key := strings.Join(regionTargets, ",")
+		if i, ok := groupIndex[key]; ok {
+			missing[i].regions = append(missing[i].regions, r)
+			continue
+		}
+		groupIndex[key] = len(missing)
+		missing = append(missing, stackInstanceTargets{targets: regionTargets, regions: []string{r}})
+	}
+	return missing, nil
+}
+
+// waitForOperation polls the StackSet operation until it finishes, then
+// collects the result for each of the stack instances. Polling shares the
+// budget of the client with any stacks being followed
+func (s *StackSet) waitForOperation(ctx context.Context, action, operationID string) (operation StackSetOperation, err error) {
+	operation = StackSetOperation{Action: action, OperationID: operationID}
+	interval := s.PollingPeriod
+	if interval == 0 {
+		interval = DefaultWaitInterval
+	}
+	budget := s.client().pollBudget()
+	for {
+		describeOut, err := s.cfn().DescribeStackSetOperationWithContext(
+			ctx,
+			&cloudformation.DescribeStackSetOperationInput{
+				StackSetName: aws.String(s.StackSetName),
+				OperationId:  aws.String(operationID),
+			},
+			budget.requestOption(),
+		)
+		if err != nil {
+			return operation, err
+		}
+		operation.Status = aws.StringValue(describeOut.StackSetOperation.Status)
+		if operation.Status != cloudformation.StackSetOperationStatusRunning &&
+			operation.Status != cloudformation.StackSetOperationStatusQueued &&
+			operation.Status != cloudformation.StackSetOperationStatusStopping {
+			break
+		}
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return operation, ctx.Err()
+		}
+	}
+
+	var failed int
+	err = s.cfn().ListStackSetOperationResultsPagesWithContext(
+		ctx,
+		&cloudformation.ListStackSetOperationResultsInput{
+			StackSetName: aws.String(s.StackSetName),
+			OperationId:  aws.String(operationID),
+		}, func(page *cloudformation.ListStackSetOperationResultsOutput, lastPage bool) bool {
+			for _, r := range page.Summaries {
+				result := StackInstanceResult{
+					Account:              aws.StringValue(r.Account),
+					OrganizationalUnitID: aws.StringValue(r.OrganizationalUnitId),
+					Region:               aws.StringValue(r.Region),
+					Status:               aws.StringValue(r.Status),
+					StatusReason:         aws.StringValue(r.StatusReason),
+				}
+				if result.Status != cloudformation.StackSetOperationResultStatusSucceeded {
+					failed++
+				}
+				operation.Results = append(operation.Results, result)
+			}
+			// Continue reading all pages
+			return true
+		},
+		budget.requestOption(),
+	)
+	if err != nil {
+		return operation, err
+	}
+
+	if s.OperationCallback != nil {
+		s.OperationCallback(operation)
+	}
+
+	if operation.Status != cloudformation.StackSetOperationStatusSucceeded || failed > 0 {
+		return operation, fmt.Errorf(
+			"StackSet %s operation %s finished with status %s, with %d of %d stack instances unsuccessful",
+			strings.ToLower(action),
+			operationID,
+			operation.Status,
+			failed,
+			len(operation.Results),
+		)
+	}
+	return operation, nil
+}
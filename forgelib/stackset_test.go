@@ -0,0 +1,325 @@
+package forgelib
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+)
+
+type fakeOperation struct {
+	Action  string
+	Results []string
+	Status  string
+}
+
+func genFakeOperations(operations []StackSetOperation) (output []fakeOperation) {
+	for _, o := range operations {
+		thisOperation := fakeOperation{Action: o.Action, Status: o.Status}
+		for _, r := range o.Results {
+			target := r.Account
+			if r.OrganizationalUnitID != "" {
+				target = r.OrganizationalUnitID
+			}
+			thisOperation.Results = append(thisOperation.Results, target+"/"+r.Region+"/"+r.Status)
+		}
+		output = append(output, thisOperation)
+	}
+	return output
+}
+
+func TestStackSetDeploy(t *testing.T) {
+	cases := []struct {
+		accounts          []string
+		expectFailure     bool
+		expectOperations  []fakeOperation
+		failAccounts      map[string]bool
+		organizationalIDs []string
+		regions           []string
+		stackSets         map[string]*mockStackSet
+	}{
+		// Create new StackSet with instances in every account and region
+		{
+			accounts:  []string{"111111111111", "222222222222"},
+			regions:   []string{"us-east-1", "eu-west-1"},
+			stackSets: map[string]*mockStackSet{},
+			expectOperations: []fakeOperation{
+				{
+					Action: "CREATE",
+					Status: cloudformation.StackSetOperationStatusSucceeded,
+					Results: []string{
+						"111111111111/us-east-1/SUCCEEDED",
+						"222222222222/us-east-1/SUCCEEDED",
+						"111111111111/eu-west-1/SUCCEEDED",
+						"222222222222/eu-west-1/SUCCEEDED",
+					},
+				},
+			},
+		},
+		// Update existing StackSet, which updates its existing instance, then
+		// add instances for a new account and a new region
+		{
+			accounts: []string{"111111111111", "222222222222"},
+			regions:  []string{"us-east-1", "eu-west-1"},
+			stackSets: map[string]*mockStackSet{
+				"test-stackset": {
+					instances: []*cloudformation.StackInstanceSummary{
+						{Account: aws.String("111111111111"), Region: aws.String("us-east-1")},
+					},
+				},
+			},
+			expectOperations: []fakeOperation{
+				{
+					Action:  "UPDATE",
+					Status:  cloudformation.StackSetOperationStatusSucceeded,
+					Results: []string{"111111111111/us-east-1/SUCCEEDED"},
+				},
+				{
+					Action:  "CREATE",
+					Status:  cloudformation.StackSetOperationStatusSucceeded,
+					Results: []string{"222222222222/us-east-1/SUCCEEDED"},
+				},
+				{
+					Action: "CREATE",
+					Status: cloudformation.StackSetOperationStatusSucceeded,
+					Results: []string{
+						"111111111111/eu-west-1/SUCCEEDED",
+						"222222222222/eu-west-1/SUCCEEDED",
+					},
+				},
+			},
+		},
+		// Create new StackSet targeting organizational units
+		{
+			organizationalIDs: []string{"ou-abcd-11111111"},
+			regions:           []string{"us-east-1"},
+			stackSets:         map[string]*mockStackSet{},
+			expectOperations: []fakeOperation{
+				{
+					Action:  "CREATE",
+					Status:  cloudformation.StackSetOperationStatusSucceeded,
+					Results: []string{"ou-abcd-11111111/us-east-1/SUCCEEDED"},
+				},
+			},
+		},
+		// Failed stack instance
+		{
+			accounts:     []string{"111111111111", "222222222222"},
+			regions:      []string{"us-east-1"},
+			failAccounts: map[string]bool{"222222222222": true},
+			stackSets:    map[string]*mockStackSet{},
+			expectOperations: []fakeOperation{
+				{
+					Action: "CREATE",
+					Status: cloudformation.StackSetOperationStatusFailed,
+					Results: []string{
+						"111111111111/us-east-1/SUCCEEDED",
+						"222222222222/us-east-1/FAILED",
+					},
+				},
+			},
+			expectFailure: true,
+		},
+		// Both accounts and organizational units
+		{
+			accounts:          []string{"111111111111"},
+			organizationalIDs: []string{"ou-abcd-11111111"},
+			regions:           []string{"us-east-1"},
+			stackSets:         map[string]*mockStackSet{},
+			expectFailure:     true,
+		},
+	}
+
+	oldCFNClient := defaultClient.cfnClient
+	defer func() { defaultClient.cfnClient = oldCFNClient }()
+	for i, c := range cases {
+		theseOperations := map[string][]*cloudformation.StackSetOperationResultSummary{}
+		theseStackSets := c.stackSets
+		defaultClient.cfnClient = mockStackSets{
+			failAccounts: c.failAccounts,
+			operations:   &theseOperations,
+			stackSets:    &theseStackSets,
+		}
+
+		var callbackOperations []StackSetOperation
+		thisStackSet := StackSet{
+			Accounts:              c.accounts,
+			OperationCallback:     func(o StackSetOperation) { callbackOperations = append(callbackOperations, o) },
+			OrganizationalUnitIDs: c.organizationalIDs,
+			Regions:               c.regions,
+			StackSetName:          "test-stackset",
+			TemplateBody:          `{"Resources":{"SNS":{"Type":"AWS::SNS::Topic"}}}`,
+		}
+
+		operations, err := thisStackSet.Deploy()
+		switch {
+		case err == nil && c.expectFailure:
+			t.Errorf("%d, expected error, got success", i)
+		case err != nil && !c.expectFailure:
+			t.Fatalf("%d, unexpected error, %v", i, err)
+		}
+
+		if e, g := c.expectOperations, genFakeOperations(operations); !reflect.DeepEqual(e, g) {
+			t.Errorf("%d, expected operations %+v, got %+v", i, e, g)
+		}
+		if e, g := operations, callbackOperations; !reflect.DeepEqual(e, g) {
+			t.Errorf("%d, expected callback for operations %+v, got %+v", i, e, g)
+		}
+	}
+}
+
+func TestStackSetDeployNoName(t *testing.T) {
+	s := StackSet{}
+
+	if _, err := s.Deploy(); err == nil {
+		t.Errorf("expected error, got success")
+	}
+}
+
+func TestStackSetDeployPolling(t *testing.T) {
+	oldCFNClient := defaultClient.cfnClient
+	defer func() { defaultClient.cfnClient = oldCFNClient }()
+
+	cases := []struct {
+		cancelAfter   time.Duration
+		expectErr     error
+		pollingPeriod time.Duration
+		runningPolls  int
+	}{
+		// Operations which are still running are checked on again
+		{pollingPeriod: time.Millisecond, runningPolls: 2},
+		// Without a polling period, DefaultWaitInterval is waited between
+		// checks rather than polling continuously, and the wait stops when
+		// the context is cancelled
+		{cancelAfter: 50 * time.Millisecond, expectErr: context.Canceled, runningPolls: 1000},
+	}
+
+	for i, c := range cases {
+		theseOperations := map[string][]*cloudformation.StackSetOperationResultSummary{}
+		theseStackSets := map[string]*mockStackSet{}
+		runningPolls := c.runningPolls
+		pollOptions := 0
+		defaultClient.cfnClient = mockStackSets{
+			operations:   &theseOperations,
+			pollOptions:  &pollOptions,
+			runningPolls: &runningPolls,
+			stackSets:    &theseStackSets,
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		if c.cancelAfter > 0 {
+			time.AfterFunc(c.cancelAfter, cancel)
+		}
+		s := StackSet{
+			Accounts:      []string{"111111111111"},
+			PollingPeriod: c.pollingPeriod,
+			Regions:       []string{"us-east-1"},
+			StackSetName:  "test-stackset",
+			TemplateBody:  `{"Resources":{"SNS":{"Type":"AWS::SNS::Topic"}}}`,
+		}
+		_, err := s.DeployWithContext(ctx)
+		cancel()
+		if !errors.Is(err, c.expectErr) {
+			t.Errorf("%d, expected error %v, got %v", i, c.expectErr, err)
+		}
+		if c.expectErr != nil {
+			if e, g := c.runningPolls-1, runningPolls; e != g {
+				t.Errorf("%d, expected the operation to be checked once, got %d checks", i, c.runningPolls-g)
+			}
+		} else if runningPolls != 0 {
+			t.Errorf("%d, expected the operation to be checked until it finished", i)
+		} else if e, g := c.runningPolls+2, pollOptions; e != g {
+			// Each check, and the listing of results, is spaced out by the
+			// poll budget of the client
+			t.Errorf("%d, expected %d requests with the poll budget, got %d", i, e, g)
+		}
+	}
+}
+
+func TestParseStackSetConfig(t *testing.T) {
+	cases := []struct {
+		input         string
+		expectOutput  StackSet
+		expectFailure bool
+	}{
+		{
+			input: `---
+Accounts:
+  - "111111111111"
+  - "022222222222"
+Regions: [us-east-1, eu-west-1]
+FailureToleranceCount: 2
+MaxConcurrentCount: 5
+ExecutionRoleName: StackSetExecution
+AdministrationRoleARN: arn:aws:iam::123456789012:role/StackSetAdministration
+Profile: management
+Region: us-east-1
+`,
+			expectOutput: StackSet{
+				Accounts:              []string{"111111111111", "022222222222"},
+				AdministrationRoleARN: "arn:aws:iam::123456789012:role/StackSetAdministration",
+				ExecutionRoleName:     "StackSetExecution",
+				FailureToleranceCount: 2,
+				MaxConcurrentCount:    5,
+				Profile:               "management",
+				Region:                "us-east-1",
+				Regions:               []string{"us-east-1", "eu-west-1"},
+			},
+		},
+		{
+			input: `{"OrganizationalUnitIds": ["ou-abcd-11111111"], "Regions": ["us-east-1"]}`,
+			expectOutput: StackSet{
+				OrganizationalUnitIDs: []string{"ou-abcd-11111111"},
+				Regions:               []string{"us-east-1"},
+			},
+		},
+		{
+			input:        ``,
+			expectOutput: StackSet{},
+		},
+		{
+			input:         `FailureToleranceCount: 1.5`,
+			expectFailure: true,
+		},
+		{
+			input:         `Regions: us-east-1`,
+			expectFailure: true,
+		},
+		{
+			input:         `Accounts: [111111111111]`,
+			expectFailure: true,
+		},
+		{
+			input:         `Region: [us-east-1]`,
+			expectFailure: true,
+		},
+		{
+			input:         `StackSetName: foo`,
+			expectFailure: true,
+		},
+		{
+			input:         `- Regions`,
+			expectFailure: true,
+		},
+	}
+
+	for i, c := range cases {
+		output, err := ParseStackSetConfig(c.input)
+		if err != nil {
+			if !c.expectFailure {
+				t.Fatalf("%d, unexpected error, %v", i, err)
+			}
+			continue
+		}
+		if c.expectFailure {
+			t.Errorf("%d, expected error, got success", i)
+		}
+		if !reflect.DeepEqual(c.expectOutput, output) {
+			t.Errorf("%d, expected %+v, got %+v", i, c.expectOutput, output)
+		}
+	}
+}
@@ -0,0 +1,299 @@
+package forgelib
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// templateNodes is a CloudFormation template parsed with the position of each of
+// its nodes. YAML templates may use the short form of intrinsic functions
+// (e.g. !Ref), and JSON templates are parsed as YAML
+type templateNodes struct {
+	// The top-level sections of the template, such as Resources
+	sections   map[string]*yaml.Node
+	parameters []templateEntry
+	mappings   []templateEntry
+	conditions []templateEntry
+	resources  []templateEntry
+	outputs    []templateEntry
+}
+
+// templateEntry is a named entry in a section of a template, such as a
+// resource
+type templateEntry struct {
+	name  string
+	key   *yaml.Node
+	value *yaml.Node
+}
+
+// mappingValue returns the value of a key in a mapping node, or nil if it
+// isn't set
+func mappingValue(n *yaml.Node, key string) *yaml.Node {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// mappingEntries lists the keys and values of a mapping node in order
+func mappingEntries(n *yaml.Node) (entries []templateEntry) {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return entries
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		entries = append(entries, templateEntry{
+			name:  n.Content[i].Value,
+			key:   n.Content[i],
+			value: n.Content[i+1],
+		})
+	}
+	return entries
+}
+
+func parseTemplateNodes(body []byte) (*templateNodes, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(body, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return nil, fmt.Errorf("Template is empty")
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("line %d: Template must be a mapping", root.Line)
+	}
+
+	t := &templateNodes{sections: map[string]*yaml.Node{}}
+	for _, e := range mappingEntries(root) {
+		t.sections[e.name] = e.value
+	}
+	t.parameters = mappingEntries(t.sections["Parameters"])
+	t.mappings = mappingEntries(t.sections["Mappings"])
+	t.conditions = mappingEntries(t.sections["Conditions"])
+	t.resources = mappingEntries(t.sections["Resources"])
+	t.outputs = mappingEntries(t.sections["Outputs"])
+	return t, nil
+}
+
+// The kinds of reference which can be made between the entries of a template
+type referenceKind string
+
+const (
+	referenceRef       referenceKind = "Ref"
+	referenceGetAtt    referenceKind = "Fn::GetAtt"
+	referenceFindInMap referenceKind = "Fn::FindInMap"
+	referenceCondition referenceKind = "Condition"
+	referenceDependsOn referenceKind = "DependsOn"
+)
+
+// reference is a use of a parameter, resource, mapping or condition
+type reference struct {
+	kind      referenceKind
+	target    string
+	attribute string
+	node      *yaml.Node
+}
+
+// Parameters which CloudFormation defines in every template
+var pseudoParameters = map[string]bool{
+	"AWS::AccountId":        true,
+	"AWS::NotificationARNs": true,
+	"AWS::NoValue":          true,
+	"AWS::Partition":        true,
+	"AWS::Region":           true,
+	"AWS::StackId":          true,
+	"AWS::StackName":        true,
+	"AWS::URLSuffix":        true,
+}
+
+// intrinsicName returns the full name of the function which a short-form tag
+// stands for, or "" if the tag isn't one (e.g. "!Sub" is "Fn::Sub")
+func intrinsicName(tag string) string {
+	if !strings.HasPrefix(tag, "!") || strings.HasPrefix(tag, "!!") || len(tag) < 2 {
+		return ""
+	}
+	switch name := tag[1:]; name {
+	case "Ref", "Condition":
+		return name
+	default:
+		return "Fn::" + name
+	}
+}
+
+// intrinsicFunction returns the name and argument of the intrinsic function
+// which a node calls, in either its full or short form, or "" if it isn't one
+func intrinsicFunction(n *yaml.Node) (name string, arg *yaml.Node) {
+	if name := intrinsicName(n.Tag); name != "" {
+		return name, n
+	}
+	if n.Kind == yaml.MappingNode && len(n.Content) == 2 {
+		key, value := n.Content[0].Value, n.Content[1]
+		// A "Condition" key with a mapping is part of an IAM policy instead
+		if key == "Ref" || strings.HasPrefix(key, "Fn::") ||
+			(key == "Condition" && value.Kind == yaml.ScalarNode) {
+			return key, value
+		}
+	}
+	return "", nil
+}
+
+// references lists the entries which are used by the template, owned by the
+// resource which they were made from (or "" outside of Resources)
+func (t *templateNodes) references(visit func(owner string, r reference)) {
+	for _, c := range t.conditions {
+		walkReferences(c.value, func(r reference) { visit("", r) })
+	}
+	for _, r := range t.resources {
+		owner := r.name
+		ownerVisit := func(ref reference) { visit(owner, ref) }
+		for _, e := range mappingEntries(r.value) {
+			switch e.name {
+			case "Condition":
+				if e.value.Kind == yaml.ScalarNode {
+					ownerVisit(reference{kind: referenceCondition, target: e.value.Value, node: e.value})
+				}
+			case "DependsOn":
+				dependencies := []*yaml.Node{e.value}
+				if e.value.Kind == yaml.SequenceNode {
+					dependencies = e.value.Content
+				}
+				for _, d := range dependencies {
+					if d.Kind == yaml.ScalarNode {
+						ownerVisit(reference{kind: referenceDependsOn, target: d.Value, node: d})
+					}
+				}
+			default:
+				walkReferences(e.value, ownerVisit)
+			}
+		}
+	}
+	for _, o := range t.outputs {
+		for _, e := range mappingEntries(o.value) {
+			if e.name == "Condition" && e.value.Kind == yaml.ScalarNode {
+				visit("", reference{kind: referenceCondition, target: e.value.Value, node: e.value})
+				continue
+			}
+			walkReferences(e.value, func(r reference) { visit("", r) })
+		}
+	}
+	walkReferences(t.sections["Rules"], func(r reference) { visit("", r) })
+}
+
+// walkReferences finds the references made by intrinsic functions within a
+// node, in either their full or short form
+func walkReferences(n *yaml.Node, visit func(reference)) {
+	if n == nil {
+		return
+	}
+	if name, arg := intrinsicFunction(n); name != "" {
+		intrinsicReferences(name, arg, visit)
+		return
+	}
+	for _, c := range n.Content {
+		walkReferences(c, visit)
+	}
+}
+
+// The variables of Fn::Sub, which aren't escaped as ${!Literal}
+var subVariableRegexp = regexp.MustCompile(`\$\{([^!}][^}]*)\}`)
+
+func intrinsicReferences(name string, arg *yaml.Node, visit func(reference)) {
+	switch name {
+	case "Ref":
+		if arg.Kind == yaml.ScalarNode {
+			visit(reference{kind: referenceRef, target: arg.Value, node: arg})
+			return
+		}
+	case "Condition":
+		if arg.Kind == yaml.ScalarNode {
+			visit(reference{kind: referenceCondition, target: arg.Value, node: arg})
+			return
+		}
+	case "Fn::GetAtt":
+		if arg.Kind == yaml.ScalarNode {
+			parts := strings.SplitN(arg.Value, ".", 2)
+			r := reference{kind: referenceGetAtt, target: parts[0], node: arg}
+			if len(parts) == 2 {
+				r.attribute = parts[1]
+			}
+			visit(r)
+			return
+		}
+		if arg.Kind == yaml.SequenceNode && len(arg.Content) > 0 && arg.Content[0].Kind == yaml.ScalarNode {
+			r := reference{kind: referenceGetAtt, target: arg.Content[0].Value, node: arg.Content[0]}
+			if len(arg.Content) > 1 && arg.Content[1].Kind == yaml.ScalarNode && intrinsicName(arg.Content[1].Tag) == "" {
+				r.attribute = arg.Content[1].Value
+			}
+			visit(r)
+			for _, c := range arg.Content[1:] {
+				walkReferences(c, visit)
+			}
+			return
+		}
+	case "Fn::Sub":
+		if arg.Kind == yaml.ScalarNode {
+			subReferences(arg, nil, visit)
+			return
+		}
+		if arg.Kind == yaml.SequenceNode && len(arg.Content) > 0 && arg.Content[0].Kind == yaml.ScalarNode {
+			local := map[string]bool{}
+			if len(arg.Content) > 1 {
+				for _, e := range mappingEntries(arg.Content[1]) {
+					local[e.name] = true
+					walkReferences(e.value, visit)
+				}
+			}
+			subReferences(arg.Content[0], local, visit)
+			return
+		}
+	case "Fn::FindInMap":
+		if arg.Kind == yaml.SequenceNode && len(arg.Content) > 0 && arg.Content[0].Kind == yaml.ScalarNode &&
+			intrinsicName(arg.Content[0].Tag) == "" {
+			visit(reference{kind: referenceFindInMap, target: arg.Content[0].Value, node: arg.Content[0]})
+			for _, c := range arg.Content[1:] {
+				walkReferences(c, visit)
+			}
+			return
+		}
+	case "Fn::If":
+		if arg.Kind == yaml.SequenceNode && len(arg.Content) > 0 && arg.Content[0].Kind == yaml.ScalarNode {
+			visit(reference{kind: referenceCondition, target: arg.Content[0].Value, node: arg.Content[0]})
+			for _, c := range arg.Content[1:] {
+				walkReferences(c, visit)
+			}
+			return
+		}
+	}
+	// Arguments which are themselves functions, or functions which don't
+	// reference anything by name
+	if arg.Kind == yaml.ScalarNode {
+		return
+	}
+	for _, c := range arg.Content {
+		walkReferences(c, visit)
+	}
+}
+
+// subReferences finds the variables of a Fn::Sub string, other than the local
+// variables given with it. "${Resource.Attribute}" is a Fn::GetAtt
+func subReferences(n *yaml.Node, local map[string]bool, visit func(reference)) {
+	for _, m := range subVariableRegexp.FindAllStringSubmatch(n.Value, -1) {
+		variable := strings.TrimSpace(m[1])
+		if local[variable] {
+			continue
+		}
+		if parts := strings.SplitN(variable, ".", 2); len(parts) == 2 {
+			visit(reference{kind: referenceGetAtt, target: parts[0], attribute: parts[1], node: n})
+			continue
+		}
+		visit(reference{kind: referenceRef, target: variable, node: n})
+	}
+}
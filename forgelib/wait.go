@@ -0,0 +1,186 @@
+package forgelib
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+)
+
+// StackOperation is a kind of operation against a stack, which decides the
+// statuses that it succeeds in
+type StackOperation string
+
+// The operations which Wait can classify the outcome of
+const (
+	OperationCreate StackOperation = "create"
+	OperationUpdate StackOperation = "update"
+	// Either a create or an update, as made by Deploy
+	OperationDeploy StackOperation = "deploy"
+	OperationDelete StackOperation = "delete"
+	OperationImport StackOperation = "import"
+)
+
+var operationSuccessStatuses = map[StackOperation][]string{
+	OperationCreate: {cloudformation.StackStatusCreateComplete},
+	OperationUpdate: {cloudformation.StackStatusUpdateComplete},
+	OperationDeploy: {cloudformation.StackStatusCreateComplete, cloudformation.StackStatusUpdateComplete},
+	OperationDelete: {cloudformation.StackStatusDeleteComplete},
+	OperationImport: {cloudformation.StackStatusImportComplete},
+}
+
+// WaitOutcome classifies the status which a stack operation finished in
+type WaitOutcome string
+
+// The outcomes of a stack operation
+const (
+	WaitSucceeded WaitOutcome = "succeeded"
+	// The operation failed, and the stack was returned to its previous state
+	WaitRolledBack WaitOutcome = "rolled back"
+	WaitFailed     WaitOutcome = "failed"
+)
+
+// DefaultWaitInterval is how often Wait checks on the stack, unless given an
+// interval
+const DefaultWaitInterval = 10 * time.Second
+
+// The longest that Wait backs off to while its requests are being throttled
+const maxThrottledWaitInterval = 2 * time.Minute
+
+// WaitOptions are the optional settings for Wait
+type WaitOptions struct {
+	// Events after this time are passed to EventHandler. Defaults to when Wait
+	// is called, so give the time from GetLastEventTime before starting the
+	// operation to see all of its events
+	After time.Time
+	// Called with each new stack event, in chronological order. Returning an
+	// error stops the wait with that error
+	EventHandler func(*cloudformation.StackEvent) error
+	// Defaults to DefaultWaitInterval. The interval doubles while requests
+	// are being throttled, and returns to this once they succeed
+	Interval time.Duration
+	// The operation which is being waited on. Defaults to any status ending in
+	// _COMPLETE, other than a rollback or a deletion, being a success. Set
+	// OperationDelete for a deletion to succeed
+	Operation StackOperation
+}
+
+// WaitResult describes the status which a stack operation finished in
+type WaitResult struct {
+	// The time of the last event which was seen, to follow on from
+	LastEventTime time.Time
+	Outcome       WaitOutcome
+	Status        string
+	StatusReason  string
+}
+
+// Succeeded reports whether the operation finished in one of its success
+// statuses
+func (r WaitResult) Succeeded() bool {
+	return r.Outcome == WaitSucceeded
+}
+
+// Wait follows the stack until its operation is no longer in progress, passing
+// each new event to the event handler along the way. The final status is
+// classified by the operation in options; a failed operation isn't an error, so
+// check the Outcome of the result. StackInfo is kept up to date while waiting.
+//
+// Requests are spaced out by a budget shared by all of the stacks which are
+// followed with the same client, and throttled requests back off rather than
+// failing the wait.
+//
+// If the context is cancelled, Wait returns the context's error with the last
+// status seen, leaving the operation running
+func (s *Stack) Wait(ctx context.Context, options WaitOptions) (result WaitResult, err error) {
+	if s.StackID == "" {
+		return result, ErrNoStackID
+	}
+	interval := options.Interval
+	if interval == 0 {
+		interval = DefaultWaitInterval
+	}
+	result.LastEventTime = options.After
+	if result.LastEventTime.IsZero() {
+		result.LastEventTime = time.Now()
+	}
+
+	budget := s.client().pollBudget()
+	stream := s.NewEventStream(result.LastEventTime)
+	delay := interval
+	for {
+		err := s.waitPoll(ctx, budget, stream, options.EventHandler, &result)
+		if request.IsErrorThrottle(err) {
+			// The SDK has already retried, so give the API longer to recover
+			delay *= 2
+			if delay > maxThrottledWaitInterval {
+				delay = maxThrottledWaitInterval
+			}
+		} else if err != nil {
+			return result, err
+		} else {
+			if !strings.HasSuffix(result.Status, "_IN_PROGRESS") {
+				result.Outcome = classifyStackStatus(options.Operation, result.Status)
+				return result, nil
+			}
+			delay = interval
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return result, ctx.Err()
+		}
+	}
+}
+
+// waitPoll updates the result with the current status of the stack, passing
+// any new events to the event handler
+func (s *Stack) waitPoll(ctx context.Context, budget *pollBudget, stream *EventStream, eventHandler func(*cloudformation.StackEvent) error, result *WaitResult) error {
+	if err := s.getStackInfo(ctx, budget.requestOption()); err != nil {
+		return err
+	}
+	result.Status = aws.StringValue(s.StackInfo.StackStatus)
+	result.StatusReason = aws.StringValue(s.StackInfo.StackStatusReason)
+
+	events, err := stream.Next(ctx)
+	if err != nil {
+		return err
+	}
+	for _, e := range events {
+		if eventHandler != nil {
+			if err := eventHandler(e); err != nil {
+				return err
+			}
+		}
+		result.LastEventTime = *e.Timestamp
+	}
+	return nil
+}
+
+// classifyStackStatus decides the outcome of an operation which finished in
+// the given status
+func classifyStackStatus(operation StackOperation, status string) WaitOutcome {
+	if strings.HasSuffix(status, "ROLLBACK_COMPLETE") {
+		return WaitRolledBack
+	}
+	if successStatuses, ok := operationSuccessStatuses[operation]; ok {
+		for _, ss := range successStatuses {
+			if status == ss {
+				return WaitSucceeded
+			}
+		}
+		return WaitFailed
+	}
+	// Without an operation, a deleted stack is most likely a failed creation
+	// which was cleaned up, so only a delete operation succeeds with it
+	if status == cloudformation.StackStatusDeleteComplete {
+		return WaitFailed
+	}
+	if strings.HasSuffix(status, "_COMPLETE") {
+		return WaitSucceeded
+	}
+	return WaitFailed
+}
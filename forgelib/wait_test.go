@@ -0,0 +1,232 @@
+package forgelib
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+)
+
+// mockWait moves the stack through a status, with one new event, each time it
+// is described
+type mockWait struct {
+	describes *int
+	start     time.Time
+	statuses  []string
+	// The number of requests to throttle before describing the stack
+	throttles *int
+	cloudformationiface.CloudFormationAPI
+}
+
+func (m mockWait) DescribeStacksWithContext(ctx aws.Context, input *cloudformation.DescribeStacksInput, opts ...request.Option) (*cloudformation.DescribeStacksOutput, error) {
+	if m.throttles != nil && *m.throttles > 0 {
+		*m.throttles--
+		return nil, awserr.New("Throttling", "Rate exceeded", nil)
+	}
+	status := m.statuses[*m.describes]
+	if *m.describes < len(m.statuses)-1 {
+		*m.describes++
+	}
+	return &cloudformation.DescribeStacksOutput{
+		Stacks: []*cloudformation.Stack{
+			{
+				StackId:           input.StackName,
+				StackName:         aws.String("test-stack"),
+				StackStatus:       aws.String(status),
+				StackStatusReason: aws.String(fmt.Sprintf("reason %d", *m.describes)),
+			},
+		},
+	}, nil
+}
+
+func (m mockWait) DescribeStackEventsPagesWithContext(ctx aws.Context, input *cloudformation.DescribeStackEventsInput, function func(*cloudformation.DescribeStackEventsOutput, bool) bool, opts ...request.Option) error {
+	var events []*cloudformation.StackEvent
+	for i := *m.describes; i >= 0; i-- {
+		events = append(events, &cloudformation.StackEvent{
+			EventId:   aws.String(fmt.Sprintf("event%d", i)),
+			Timestamp: aws.Time(m.start.Add(time.Duration(i) * time.Second)),
+		})
+	}
+	function(&cloudformation.DescribeStackEventsOutput{StackEvents: events}, true)
+	return nil
+}
+
+func TestWait(t *testing.T) {
+	oldCFNClient := defaultClient.cfnClient
+	defer func() { defaultClient.cfnClient = oldCFNClient }()
+
+	start := time.Unix(1500000000, 0)
+	cases := []struct {
+		expectEvents  []string
+		expectOutcome WaitOutcome
+		expectStatus  string
+		operation     StackOperation
+		statuses      []string
+	}{
+		{
+			statuses: []string{
+				cloudformation.StackStatusUpdateInProgress,
+				cloudformation.StackStatusUpdateCompleteCleanupInProgress,
+				cloudformation.StackStatusUpdateComplete,
+			},
+			operation:     OperationDeploy,
+			expectEvents:  []string{"event1", "event2"},
+			expectOutcome: WaitSucceeded,
+			expectStatus:  cloudformation.StackStatusUpdateComplete,
+		},
+		{
+			statuses: []string{
+				cloudformation.StackStatusUpdateRollbackInProgress,
+				cloudformation.StackStatusUpdateRollbackComplete,
+			},
+			operation:     OperationUpdate,
+			expectEvents:  []string{"event1"},
+			expectOutcome: WaitRolledBack,
+			expectStatus:  cloudformation.StackStatusUpdateRollbackComplete,
+		},
+		{
+			statuses:      []string{cloudformation.StackStatusDeleteFailed},
+			operation:     OperationDelete,
+			expectEvents:  []string{},
+			expectOutcome: WaitFailed,
+			expectStatus:  cloudformation.StackStatusDeleteFailed,
+		},
+		{
+			// A failed creation is deleted when deploying
+			statuses: []string{
+				cloudformation.StackStatusDeleteInProgress,
+				cloudformation.StackStatusDeleteComplete,
+			},
+			operation:     OperationDeploy,
+			expectEvents:  []string{"event1"},
+			expectOutcome: WaitFailed,
+			expectStatus:  cloudformation.StackStatusDeleteComplete,
+		},
+		// Without an operation, only a deletion succeeds in DELETE_COMPLETE
+		{
+			statuses:      []string{cloudformation.StackStatusDeleteComplete},
+			expectEvents:  []string{},
+			expectOutcome: WaitFailed,
+			expectStatus:  cloudformation.StackStatusDeleteComplete,
+		},
+		{
+			statuses:      []string{cloudformation.StackStatusDeleteComplete},
+			operation:     OperationDelete,
+			expectEvents:  []string{},
+			expectOutcome: WaitSucceeded,
+			expectStatus:  cloudformation.StackStatusDeleteComplete,
+		},
+		{
+			statuses:      []string{cloudformation.StackStatusImportComplete},
+			expectEvents:  []string{},
+			expectOutcome: WaitSucceeded,
+			expectStatus:  cloudformation.StackStatusImportComplete,
+		},
+	}
+
+	for i, c := range cases {
+		describes := 0
+		defaultClient.cfnClient = mockWait{describes: &describes, start: start, statuses: c.statuses}
+
+		events := []string{}
+		s := Stack{StackID: "test-stack/id0"}
+		result, err := s.Wait(context.Background(), WaitOptions{
+			After: start,
+			EventHandler: func(e *cloudformation.StackEvent) error {
+				events = append(events, *e.EventId)
+				return nil
+			},
+			Interval:  time.Millisecond,
+			Operation: c.operation,
+		})
+		if err != nil {
+			t.Fatalf("%d, unexpected error, %v", i, err)
+		}
+		if e, g := c.expectOutcome, result.Outcome; e != g {
+			t.Errorf("%d, expected outcome %s, got %s", i, e, g)
+		}
+		if e, g := c.expectStatus, result.Status; e != g {
+			t.Errorf("%d, expected status %s, got %s", i, e, g)
+		}
+		if e, g := c.expectStatus, *s.StackInfo.StackStatus; e != g {
+			t.Errorf("%d, expected StackInfo status %s, got %s", i, e, g)
+		}
+		if e, g := fmt.Sprint(c.expectEvents), fmt.Sprint(events); e != g {
+			t.Errorf("%d, expected events %s, got %s", i, e, g)
+		}
+	}
+}
+
+func TestWaitCancelled(t *testing.T) {
+	oldCFNClient := defaultClient.cfnClient
+	defer func() { defaultClient.cfnClient = oldCFNClient }()
+	describes := 0
+	defaultClient.cfnClient = mockWait{
+		describes: &describes,
+		start:     time.Unix(1500000000, 0),
+		statuses:  []string{cloudformation.StackStatusUpdateInProgress},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	s := Stack{StackID: "test-stack/id0"}
+	result, err := s.Wait(ctx, WaitOptions{Interval: time.Hour})
+	if err != context.DeadlineExceeded {
+		t.Errorf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	if e, g := cloudformation.StackStatusUpdateInProgress, result.Status; e != g {
+		t.Errorf("expected status %s, got %s", e, g)
+	}
+}
+
+func TestWaitThrottled(t *testing.T) {
+	oldCFNClient := defaultClient.cfnClient
+	defer func() { defaultClient.cfnClient = oldCFNClient }()
+	describes, throttles := 0, 3
+	start := time.Unix(1500000000, 0)
+	defaultClient.cfnClient = mockWait{
+		describes: &describes,
+		start:     start,
+		statuses: []string{
+			cloudformation.StackStatusUpdateInProgress,
+			cloudformation.StackStatusUpdateComplete,
+		},
+		throttles: &throttles,
+	}
+
+	events := []string{}
+	s := Stack{StackID: "test-stack/id0"}
+	result, err := s.Wait(context.Background(), WaitOptions{
+		After: start,
+		EventHandler: func(e *cloudformation.StackEvent) error {
+			events = append(events, *e.EventId)
+			return nil
+		},
+		Interval: time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error, %v", err)
+	}
+	if e, g := WaitSucceeded, result.Outcome; e != g {
+		t.Errorf("expected outcome %s, got %s", e, g)
+	}
+	if e, g := fmt.Sprint([]string{"event1"}), fmt.Sprint(events); e != g {
+		t.Errorf("expected events %s, got %s", e, g)
+	}
+	if throttles != 0 {
+		t.Errorf("expected all throttled requests to be retried, %d left", throttles)
+	}
+}
+
+func TestWaitNoStackID(t *testing.T) {
+	s := Stack{}
+	if _, err := s.Wait(context.Background(), WaitOptions{}); err == nil {
+		t.Error("expected error, got success")
+	}
+}